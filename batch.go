@@ -0,0 +1,165 @@
+package main
+
+import "fmt"
+
+// authorKey identifies an author the same way upsertAuthor matches one
+type authorKey struct {
+	agentID      string
+	name         string
+	birth, death int
+}
+
+// newAuthorKey builds the key of an author: its agent ID when known, otherwise
+// its name and life dates, with -1 standing in for unknown years
+func newAuthorKey(author Author) authorKey {
+	if author.AgentID != "" {
+		return authorKey{agentID: author.AgentID}
+	}
+	key := authorKey{name: author.Name, birth: -1, death: -1}
+	if author.BirthYear != nil {
+		key.birth = *author.BirthYear
+	}
+	if author.DeathYear != nil {
+		key.death = *author.DeathYear
+	}
+	return key
+}
+
+// relationIDs holds author and subject IDs resolved ahead of inserting a batch
+type relationIDs struct {
+	authors  map[authorKey]int64
+	subjects map[string]int64
+}
+
+// author returns the resolved ID of an author, if known
+func (ids *relationIDs) author(author Author) (int64, bool) {
+	if ids == nil {
+		return 0, false
+	}
+	id, ok := ids.authors[newAuthorKey(author)]
+	return id, ok
+}
+
+// subject returns the resolved ID of a subject, if known
+func (ids *relationIDs) subject(subject string) (int64, bool) {
+	if ids == nil {
+		return 0, false
+	}
+	id, ok := ids.subjects[subject]
+	return id, ok
+}
+
+// BatchInsertBooks inserts a batch of books in a single transaction, preparing
+// each statement once and committing once. If any book fails, the transaction
+// is rolled back and every book is retried in its own transaction so one bad
+// record doesn't lose the batch. The returned slice holds one error (or nil)
+// per book, in order.
+func (db *DB) BatchInsertBooks(books []*Book) []error {
+	errs := make([]error, len(books))
+	err := db.withRetry(func() error {
+		return db.insertBooksInOneTx(books)
+	})
+	if err == nil {
+		return errs
+	}
+
+	for i, book := range books {
+		errs[i] = db.InsertBook(book)
+	}
+	return errs
+}
+
+// insertBooksInOneTx inserts every book within one prepared transaction,
+// stopping at the first failure
+func (db *DB) insertBooksInOneTx(books []*Book) error {
+	tx, err := db.beginPrepared()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, book := range books {
+		if err := db.insertBook(tx, book, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit batch: %w", err)
+	}
+	return nil
+}
+
+// InsertBooksTwoPhase inserts a batch in two phases to keep transactions small.
+// First every distinct author, contributor and subject across the batch is upserted in one
+// committed transaction; then each book is inserted in its own transaction and
+// linked to the now-stable IDs. The returned slice holds one error (or nil)
+// per book, in order.
+func (db *DB) InsertBooksTwoPhase(books []*Book) []error {
+	errs := make([]error, len(books))
+
+	var ids *relationIDs
+	err := db.withRetry(func() error {
+		var err error
+		ids, err = db.upsertRelations(books)
+		return err
+	})
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	for i, book := range books {
+		errs[i] = db.insertBookWithIDs(book, ids)
+	}
+	return errs
+}
+
+// upsertRelations upserts the authors and subjects of a batch in a single
+// transaction and returns their IDs
+func (db *DB) upsertRelations(books []*Book) (*relationIDs, error) {
+	tx, err := db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := &relationIDs{
+		authors:  make(map[authorKey]int64),
+		subjects: make(map[string]int64),
+	}
+	for _, book := range books {
+		// Every occurrence is upserted so each one can fill missing author fields
+		for _, author := range book.Authors {
+			authorID, err := db.upsertAuthor(tx, author)
+			if err != nil {
+				return nil, err
+			}
+			ids.authors[newAuthorKey(author)] = authorID
+		}
+		for _, contributor := range book.Contributors {
+			authorID, err := db.upsertAuthor(tx, contributor.Author)
+			if err != nil {
+				return nil, err
+			}
+			ids.authors[newAuthorKey(contributor.Author)] = authorID
+		}
+		for _, subject := range book.Subjects {
+			if _, ok := ids.subjects[subject]; ok {
+				continue
+			}
+			subjectID, err := db.upsertSubject(tx, subject)
+			if err != nil {
+				return nil, err
+			}
+			ids.subjects[subject] = subjectID
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit authors and subjects: %w", err)
+	}
+	return ids, nil
+}
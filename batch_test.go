@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// catalogLinks lists every book's author and subject links as
+// "gutenberg_id author|subject name", in order
+func catalogLinks(t testing.TB, db *DB) []string {
+	t.Helper()
+	links, err := db.queryStrings(`
+		SELECT b.gutenberg_id || ' author ' || a.name FROM book_authors ba
+		JOIN books b ON b.id = ba.book_id JOIN authors a ON a.id = ba.author_id
+		UNION ALL
+		SELECT b.gutenberg_id || ' subject ' || s.subject FROM book_subjects bs
+		JOIN books b ON b.id = bs.book_id JOIN subjects s ON s.id = bs.subject_id
+		ORDER BY 1
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return links
+}
+
+func TestInsertBooksTwoPhase(t *testing.T) {
+	twain := Author{Name: "Twain, Mark", AgentID: "53"}
+	warner := Author{Name: "Warner, Charles Dudley", AgentID: "1145"}
+	batch := func() []*Book {
+		return []*Book{
+			{GutenbergID: "74", Title: "Tom Sawyer", Authors: []Author{twain}, Subjects: []string{"Boys -- Fiction"}},
+			{GutenbergID: "76", Title: "Huckleberry Finn", Authors: []Author{twain}, Subjects: []string{"Boys -- Fiction", "Race relations -- Fiction"}},
+			{GutenbergID: "3178", Title: "The Gilded Age", Authors: []Author{twain, warner}, Subjects: []string{"Satire"}},
+			{GutenbergID: "3179", Title: "Gilded Age Part 2", Contributors: []Contributor{{Author: warner, Role: "editor"}}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		insert func(db *DB, books []*Book) []error
+	}{
+		{"one transaction per book", func(db *DB, books []*Book) []error {
+			errs := make([]error, len(books))
+			for i, book := range books {
+				errs[i] = db.InsertBook(book)
+			}
+			return errs
+		}},
+		{"batch", (*DB).BatchInsertBooks},
+		{"two phase", (*DB).InsertBooksTwoPhase},
+	}
+
+	want := []string{
+		"3178 author Twain, Mark",
+		"3178 author Warner, Charles Dudley",
+		"3178 subject Satire",
+		"74 author Twain, Mark",
+		"74 subject Boys -- Fiction",
+		"76 author Twain, Mark",
+		"76 subject Boys -- Fiction",
+		"76 subject Race relations -- Fiction",
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			// Inserting the batch twice checks that existing relations are reused
+			for round := 0; round < 2; round++ {
+				for i, err := range tt.insert(db, batch()) {
+					if err != nil {
+						t.Fatalf("round %d book %d: %v", round, i, err)
+					}
+				}
+			}
+
+			if got := catalogLinks(t, db); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("links:\n%q\nwant:\n%q", got, want)
+			}
+			for table, n := range map[string]int{"books": 4, "authors": 2, "subjects": 3, "book_contributors": 1} {
+				if got := queryInt(t, db, "SELECT COUNT(*) FROM "+table); got != n {
+					t.Errorf("%d rows in %s, want %d", got, table, n)
+				}
+			}
+		})
+	}
+}
+
+func TestTwoPhaseImport(t *testing.T) {
+	creator := `<dcterms:creator><pgterms:agent rdf:about="2009/agents/53"><pgterms:name>Twain, Mark</pgterms:name></pgterms:agent></dcterms:creator>`
+	docs := map[string]string{}
+	for i := 1; i <= 10; i++ {
+		id := fmt.Sprint(i)
+		docs[id] = rdfXML(ebookXML(id, "Book "+id, creator+subjectXML("Humor")))
+	}
+
+	db := newTestDB(t)
+	importer := newTestImporter(db)
+	importer.SetTwoPhase(true)
+	importTestDocs(t, importer, docs)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"SELECT COUNT(*) FROM books", 10},
+		{"SELECT COUNT(*) FROM authors", 1},
+		{"SELECT COUNT(*) FROM subjects", 1},
+		{"SELECT COUNT(*) FROM book_authors", 10},
+		{"SELECT COUNT(*) FROM book_subjects", 10},
+	}
+	for _, tt := range tests {
+		if got := queryInt(t, db, tt.query); got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestBatchFallbackWarnsOnce(t *testing.T) {
+	const url = "https://www.gutenberg.org/ebooks/7.txt.utf-8"
+	resized := func(size int64) *Book {
+		return &Book{GutenbergID: "7", Title: "Seven", Formats: []Format{{Type: "text/plain", FileURL: url, FileSize: &size}}}
+	}
+	tests := []struct {
+		name         string
+		books        func() []*Book
+		wantFailed   []bool
+		wantWarnings []string
+	}{
+		{"batch succeeds", func() []*Book { return []*Book{resized(250)} }, []bool{false}, []string{"7: file size of " + url + " changed from 100 to 250"}},
+		{"batch falls back per book", func() []*Book { return []*Book{resized(250), {GutenbergID: "666", Title: "Rejected"}} }, []bool{false, true}, []string{"7: file size of " + url + " changed from 100 to 250"}},
+		{"book rolled back", func() []*Book {
+			book := resized(250)
+			book.RawRDFGzip = []byte("rejected")
+			return []*Book{book}
+		}, []bool{true}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			insertTestBooks(t, db, resized(100))
+			// Fail book 666 and any raw RDF, after book 7's formats are written
+			for _, trigger := range []string{
+				`CREATE TRIGGER reject_book BEFORE INSERT ON books WHEN NEW.gutenberg_id = '666' BEGIN SELECT RAISE(ABORT, 'rejected'); END`,
+				`CREATE TRIGGER reject_raw BEFORE INSERT ON raw_rdf BEGIN SELECT RAISE(ABORT, 'rejected'); END`,
+			} {
+				if _, err := db.conn.Exec(trigger); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var warnings []string
+			db.SetWarningHandler(func(gutenbergID, message string) {
+				warnings = append(warnings, gutenbergID+": "+message)
+			})
+
+			errs := db.BatchInsertBooks(tt.books())
+			for i, err := range errs {
+				if (err != nil) != tt.wantFailed[i] {
+					t.Errorf("book %d error = %v, want failed %v", i, err, tt.wantFailed[i])
+				}
+			}
+			if fmt.Sprint(warnings) != fmt.Sprint(tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+// benchmarkBooks parses n copies of the fixture record, numbered from first
+func benchmarkBooks(b *testing.B, first, n int) []*Book {
+	b.Helper()
+	books := make([]*Book, n)
+	for i := range books {
+		books[i] = parseTestRDF(b, fixtureRDF(b, fmt.Sprint(first+i)))
+	}
+	return books
+}
+
+func BenchmarkInsertBooks(b *testing.B) {
+	const batchSize = 100
+	tests := []struct {
+		name   string
+		insert func(db *DB, books []*Book) []error
+	}{
+		{"per book", func(db *DB, books []*Book) []error {
+			errs := make([]error, len(books))
+			for i, book := range books {
+				errs[i] = db.InsertBook(book)
+			}
+			return errs
+		}},
+		{"batch", (*DB).BatchInsertBooks},
+		{"two phase", (*DB).InsertBooksTwoPhase},
+	}
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			db, err := NewDB(filepath.Join(b.TempDir(), "bench.db"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// New books every iteration, so each one is an insert
+				b.StopTimer()
+				books := benchmarkBooks(b, i*batchSize+1, batchSize)
+				b.StartTimer()
+				for _, err := range tt.insert(db, books) {
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*batchSize), "ns/book")
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// windows1252High maps the bytes 0x80-0x9F of windows-1252 to runes; the
+// five bytes it leaves undefined map to the C1 control of the same value.
+// Every other byte is the Latin-1 code point of the same value.
+var windows1252High = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// charsetLabels maps the encoding names legacy RDF declares, lowercased, to
+// whether the document needs decoding from windows-1252. ISO-8859-1 is
+// decoded as windows-1252, its superset, as browsers do: documents labelled
+// Latin-1 routinely contain windows-1252 quotes and dashes. ASCII is a
+// subset of UTF-8 and passes through.
+var charsetLabels = map[string]bool{
+	"iso-8859-1": true, "iso8859-1": true, "iso_8859-1": true, "latin1": true, "latin-1": true,
+	"l1": true, "cp819": true, "ibm819": true,
+	"windows-1252": true, "cp1252": true, "x-cp1252": true,
+	"us-ascii": false, "ascii": false, "utf8": false,
+}
+
+// charsetReader is the xml.Decoder CharsetReader for RDF declaring an
+// encoding other than UTF-8. It supports Latin-1, windows-1252 and ASCII;
+// any other encoding is an error, failing the file as before.
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	decode, ok := charsetLabels[strings.ToLower(strings.TrimSpace(label))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported character encoding %q", label)
+	}
+	if !decode {
+		return input, nil
+	}
+
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var decoded bytes.Buffer
+	decoded.Grow(len(data) + len(data)/8)
+	for _, b := range data {
+		switch {
+		case b < utf8.RuneSelf:
+			decoded.WriteByte(b)
+		case b < 0xA0:
+			decoded.WriteRune(windows1252High[b-0x80])
+		default:
+			decoded.WriteRune(rune(b))
+		}
+	}
+	return &decoded, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// encodedRDF returns a document declaring encoding whose ebook has an author
+// and title given as raw bytes in that encoding
+func encodedRDF(encoding, author, title string) string {
+	doc := rdfXML(ebookXML("1", title, `<dcterms:creator><pgterms:agent rdf:about="2009/agents/1"><pgterms:name>`+author+`</pgterms:name></pgterms:agent></dcterms:creator>`))
+	return strings.Replace(doc, `encoding="utf-8"`, `encoding="`+encoding+`"`, 1)
+}
+
+func TestParseRDFDeclaredEncoding(t *testing.T) {
+	tests := []struct {
+		name        string
+		doc         string
+		wantAuthor  string
+		wantTitle   string
+		wantCharset string
+		wantErr     bool
+	}{
+		{"ISO-8859-1", encodedRDF("ISO-8859-1", "Bront\xeb, Charlotte", "Jane Eyre"), "Brontë, Charlotte", "Jane Eyre", "iso-8859-1", false},
+		{"latin1 label", encodedRDF("latin1", "Dumas, Alexandre (p\xe8re)", "Les Mis\xe9rables"), "Dumas, Alexandre (père)", "Les Misérables", "latin1", false},
+		{"windows-1252 quotes in Latin-1", encodedRDF("iso-8859-1", "Author", "\x93Quoted\x94 \x96 Dashed"), "Author", "“Quoted” – Dashed", "iso-8859-1", false},
+		{"windows-1252", encodedRDF("windows-1252", "Sm\xf8rgrav, \x8aime", "Title"), "Smørgrav, Šime", "Title", "windows-1252", false},
+		{"US-ASCII", encodedRDF("US-ASCII", "Austen, Jane", "Emma"), "Austen, Jane", "Emma", "us-ascii", false},
+		{"UTF-8", encodedRDF("utf-8", "Brontë, Charlotte", "Jane Eyre"), "Brontë, Charlotte", "Jane Eyre", "", false},
+		{"unsupported encoding", encodedRDF("shift_jis", "Author", "Title"), "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book, err := ParseRDF(strings.NewReader(tt.doc))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ParseRDF succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(book.Authors) != 1 || book.Authors[0].Name != tt.wantAuthor {
+				t.Errorf("authors = %+v, want %q", book.Authors, tt.wantAuthor)
+			}
+			if book.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", book.Title, tt.wantTitle)
+			}
+			if book.Charset != tt.wantCharset {
+				t.Errorf("Charset = %q, want %q", book.Charset, tt.wantCharset)
+			}
+		})
+	}
+}
+
+func TestImportCountsRecoded(t *testing.T) {
+	db := newTestDB(t)
+	importer := newTestImporter(db)
+	docs := map[string]string{
+		"1": encodedRDF("ISO-8859-1", "Bront\xeb, Charlotte", "Jane Eyre"),
+		"2": strings.Replace(encodedRDF("windows-1252", "Verne, Jules", "Vingt mille lieues"), `"ebooks/1"`, `"ebooks/2"`, 1),
+		"3": strings.Replace(encodedRDF("utf-8", "Hugo, Victor", "Les Misérables"), `"ebooks/1"`, `"ebooks/3"`, 1),
+	}
+	importTestDocs(t, importer, docs)
+
+	stats := importer.Stats()
+	if stats.Successful != 3 || stats.Recoded != 2 {
+		t.Errorf("successful %d, recoded %d; want 3, 2", stats.Successful, stats.Recoded)
+	}
+	book, err := db.GetBook("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book.Authors) != 1 || book.Authors[0].Name != "Brontë, Charlotte" {
+		t.Errorf("stored authors = %+v, want Brontë, Charlotte", book.Authors)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Format URL problems reported by CheckFormats
+const (
+	problemMissingURL   = "missing URL"
+	problemMalformedURL = "malformed URL"
+)
+
+// FormatCheckOptions configures CheckFormats
+type FormatCheckOptions struct {
+	// HTTP enables HEAD requests against every well-formed URL
+	HTTP bool
+	// Concurrency is the number of requests in flight at once
+	Concurrency int
+	// RequestsPerSecond caps the request rate; 0 means unlimited
+	RequestsPerSecond float64
+	// Client is the HTTP client to use; http.DefaultClient when nil
+	Client *http.Client
+}
+
+// FormatIssue is a format whose URL is missing, malformed or dead
+type FormatIssue struct {
+	GutenbergID string
+	FormatType  string
+	FileURL     string
+	Problem     string
+}
+
+// formatLink is a stored format URL to check
+type formatLink struct {
+	gutenbergID string
+	formatType  string
+	fileURL     string
+}
+
+// CheckFormats lists formats with an empty or malformed file_url and, with
+// opts.HTTP, those whose URL does not answer a HEAD request successfully.
+// Issues are returned in book order along with the number of formats checked.
+func (db *DB) CheckFormats(opts FormatCheckOptions) ([]FormatIssue, int, error) {
+	rows, err := db.conn.Query(`
+		SELECT b.gutenberg_id, f.format_type, COALESCE(f.file_url, '')
+		FROM formats f
+		JOIN books b ON b.id = f.book_id
+		ORDER BY b.id, f.id
+	`)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query formats: %w", err)
+	}
+	defer rows.Close()
+
+	var links []formatLink
+	for rows.Next() {
+		var link formatLink
+		if err := rows.Scan(&link.gutenbergID, &link.formatType, &link.fileURL); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan format: %w", err)
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	problems := make([]string, len(links))
+	var reachable []int
+	for i, link := range links {
+		if problem := checkFormatURL(link.fileURL); problem != "" {
+			problems[i] = problem
+		} else {
+			reachable = append(reachable, i)
+		}
+	}
+
+	if opts.HTTP {
+		checkFormatLinks(links, reachable, problems, opts)
+	}
+
+	var issues []FormatIssue
+	for i, link := range links {
+		if problems[i] != "" {
+			issues = append(issues, FormatIssue{
+				GutenbergID: link.gutenbergID,
+				FormatType:  link.formatType,
+				FileURL:     link.fileURL,
+				Problem:     problems[i],
+			})
+		}
+	}
+	return issues, len(links), nil
+}
+
+// checkFormatURL returns the problem with a stored URL, or "" if it is well formed
+func checkFormatURL(fileURL string) string {
+	if fileURL == "" {
+		return problemMissingURL
+	}
+	parsed, err := url.Parse(fileURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return problemMalformedURL
+	}
+	return ""
+}
+
+// checkFormatLinks sends a HEAD request for each indexed link, recording dead
+// links in problems. Requests are spread over opts.Concurrency workers and
+// paced to opts.RequestsPerSecond.
+func checkFormatLinks(links []formatLink, indexes []int, problems []string, opts FormatCheckOptions) {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	var tick <-chan time.Time
+	if opts.RequestsPerSecond > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.RequestsPerSecond))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				problems[i] = headProblem(client, links[i].fileURL)
+			}
+		}()
+	}
+
+	for _, i := range indexes {
+		if tick != nil {
+			<-tick
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// headProblem returns why a URL is dead, or "" if a HEAD request succeeds
+func headProblem(client *http.Client, fileURL string) string {
+	resp, err := client.Head(fileURL)
+	if err != nil {
+		return fmt.Sprintf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return "HTTP " + resp.Status
+	}
+	return ""
+}
+
+// PrintFormatIssues writes one line per issue followed by a summary
+func PrintFormatIssues(w io.Writer, issues []FormatIssue, checked int) {
+	for _, issue := range issues {
+		fmt.Fprintf(w, "%-8s %-30s %s: %s\n", issue.GutenbergID, issue.FormatType, issue.Problem, issue.FileURL)
+	}
+	fmt.Fprintf(w, "\nChecked %d formats, %d with problems\n", checked, len(issues))
+}
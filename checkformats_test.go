@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestCheckFormats(t *testing.T) {
+	var mu sync.Mutex
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		if r.URL.Path == "/missing.epub" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db := newTestDB(t)
+	insertTestBooks(t, db,
+		&Book{GutenbergID: "1", Title: "One", Formats: []Format{
+			{Type: "text/plain", FileURL: server.URL + "/ok.txt"},
+			{Type: "application/epub+zip", FileURL: server.URL + "/missing.epub"},
+		}},
+		&Book{GutenbergID: "2", Title: "Two", Formats: []Format{
+			{Type: "text/html", FileURL: "ebooks/2.html"},
+			{Type: "text/plain", FileURL: "ftp://example.org/2.txt"},
+		}},
+	)
+	if _, err := db.conn.Exec("INSERT INTO formats (book_id, format_type, file_url) SELECT id, 'image/jpeg', '' FROM books WHERE gutenberg_id = '2'"); err != nil {
+		t.Fatal(err)
+	}
+
+	malformed := []string{
+		"2 text/html malformed URL ebooks/2.html",
+		"2 text/plain malformed URL ftp://example.org/2.txt",
+		"2 image/jpeg missing URL ",
+	}
+	tests := []struct {
+		name      string
+		opts      FormatCheckOptions
+		want      []string
+		wantHeads int
+	}{
+		{"without HTTP", FormatCheckOptions{}, malformed, 0},
+		{"with HTTP", FormatCheckOptions{HTTP: true, Concurrency: 2, RequestsPerSecond: 100, Client: server.Client()},
+			append([]string{"1 application/epub+zip HTTP 404 Not Found " + server.URL + "/missing.epub"}, malformed...), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			methods = nil
+			mu.Unlock()
+			issues, checked, err := db.CheckFormats(tt.opts)
+			if err != nil {
+				t.Fatalf("CheckFormats: %v", err)
+			}
+			if checked != 5 {
+				t.Errorf("checked %d formats, want 5", checked)
+			}
+			var got []string
+			for _, issue := range issues {
+				got = append(got, fmt.Sprintf("%s %s %s %s", issue.GutenbergID, issue.FormatType, issue.Problem, issue.FileURL))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("issues:\n%q\nwant:\n%q", got, tt.want)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(methods) != tt.wantHeads {
+				t.Errorf("%d requests sent, want %d", len(methods), tt.wantHeads)
+			}
+			for _, method := range methods {
+				if method != http.MethodHead {
+					t.Errorf("sent a %s request, want HEAD", method)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckFormatURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.gutenberg.org/ebooks/1.epub", ""},
+		{"http://www.gutenberg.org/files/1/1.txt", ""},
+		{"", problemMissingURL},
+		{"ebooks/1.epub", problemMalformedURL},
+		{"https://", problemMalformedURL},
+		{"mailto:help@gutenberg.org", problemMalformedURL},
+		{"http://[::1", problemMalformedURL},
+	}
+	for _, tt := range tests {
+		if got := checkFormatURL(tt.url); got != tt.want {
+			t.Errorf("checkFormatURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
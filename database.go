@@ -3,21 +3,127 @@ package main
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
 	"strings"
 	"time"
 
+	_ "github.com/lib/pq"
 	_ "modernc.org/sqlite"
 )
 
+// schemaVersion is recorded in PRAGMA user_version after migrations run.
+// Bump it whenever initSchema or migrateSchema changes.
+const schemaVersion = 25
+
 // DB wraps the database connection and provides methods for database operations
 type DB struct {
 	conn *sql.DB
+	// driver is DriverSQLite or DriverPostgres; SQL is written for SQLite and rebound for PostgreSQL
+	driver string
+	// emptyAsNull stores empty or whitespace-only text values as NULL
+	emptyAsNull bool
+	// onWarning receives non-fatal data issues found while inserting
+	onWarning func(gutenbergID, message string)
+	// runID is the current import run, recorded on newly created subjects and bookshelves
+	runID sql.NullInt64
+	// maxRetries and retryDelay control retrying transactions on a busy or locked database
+	maxRetries int
+	retryDelay time.Duration
+
+	// Statements prepared once in NewDB for the lookups and inserts insertBook
+	// runs most often; bound to a transaction with dbTx.use
+	authorLookup    *sql.Stmt
+	agentLookup     *sql.Stmt
+	subjectLookup   *sql.Stmt
+	bookshelfLookup *sql.Stmt
+	formatUpsert    *sql.Stmt
+}
+
+// MemoryDSN opens an in-memory SQLite database with NewDB, for tests and other
+// ephemeral use. Each DB opened with it is empty and separate, and its
+// contents are lost on Close.
+const MemoryDSN = ":memory:"
+
+// isMemoryDSN reports whether a SQLite dsn names an in-memory database rather
+// than a file, either as ":memory:" or as a "file::memory:" or mode=memory URI
+func isMemoryDSN(dsn string) bool {
+	return dsn == MemoryDSN || strings.HasPrefix(dsn, "file::memory:") || strings.Contains(dsn, "mode=memory")
+}
+
+// NewDB opens the database named by dsn and initializes the schema. A
+// postgres:// or postgresql:// URL selects PostgreSQL; anything else is a
+// SQLite file path, or MemoryDSN for a private in-memory database.
+func NewDB(dsn string) (*DB, error) {
+	return NewDBWithDriver(DetectDriver(dsn), dsn)
+}
+
+// SQLiteOptions sets the journal and synchronous modes SQLite database files
+// are opened with; each connection runs the matching PRAGMA when it opens
+type SQLiteOptions struct {
+	// JournalMode is one of DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF
+	JournalMode string
+	// Synchronous is one of OFF, NORMAL, FULL or EXTRA
+	Synchronous string
+}
+
+// DefaultSQLiteOptions returns WAL journaling with synchronous=NORMAL, which
+// is durable across application crashes and much faster than FULL
+func DefaultSQLiteOptions() SQLiteOptions {
+	return SQLiteOptions{JournalMode: "WAL", Synchronous: "NORMAL"}
 }
 
-// NewDB creates a new database connection and initializes the schema
-func NewDB(dbPath string) (*DB, error) {
-	conn, err := sql.Open("sqlite", dbPath+"?_journal_mode=WAL&_synchronous=NORMAL")
+// sqliteJournalModes and sqliteSynchronousModes are the values SQLite accepts
+var (
+	sqliteJournalModes     = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+	sqliteSynchronousModes = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+)
+
+// ParseSQLiteOptions validates a journal and synchronous mode, case-insensitively
+func ParseSQLiteOptions(journalMode, synchronous string) (SQLiteOptions, error) {
+	opts := SQLiteOptions{
+		JournalMode: strings.ToUpper(strings.TrimSpace(journalMode)),
+		Synchronous: strings.ToUpper(strings.TrimSpace(synchronous)),
+	}
+	if !containsString(sqliteJournalModes, opts.JournalMode) {
+		return SQLiteOptions{}, fmt.Errorf("invalid journal mode %q (use %s)", journalMode, strings.Join(sqliteJournalModes, ", "))
+	}
+	if !containsString(sqliteSynchronousModes, opts.Synchronous) {
+		return SQLiteOptions{}, fmt.Errorf("invalid synchronous mode %q (use %s)", synchronous, strings.Join(sqliteSynchronousModes, ", "))
+	}
+	return opts, nil
+}
+
+// dsn appends the options to a SQLite file path as _pragma parameters
+func (o SQLiteOptions) dsn(path string) string {
+	return fmt.Sprintf("%s?_pragma=journal_mode(%s)&_pragma=synchronous(%s)", path, o.JournalMode, o.Synchronous)
+}
+
+// NewDBWithDriver opens dsn with the given driver (DriverSQLite or
+// DriverPostgres) and initializes the schema. SQLite files use
+// DefaultSQLiteOptions.
+func NewDBWithDriver(driver, dsn string) (*DB, error) {
+	return NewDBWithOptions(driver, dsn, DefaultSQLiteOptions())
+}
+
+// NewDBWithOptions is NewDBWithDriver with the journal and synchronous modes
+// for a SQLite file; they are ignored for PostgreSQL and in-memory databases
+func NewDBWithOptions(driver, dsn string, opts SQLiteOptions) (*DB, error) {
+	var conn *sql.DB
+	var err error
+	switch driver {
+	case DriverSQLite:
+		if isMemoryDSN(dsn) {
+			// There's no file to journal, so the journal settings don't apply
+			conn, err = sql.Open("sqlite", dsn)
+		} else {
+			conn, err = sql.Open("sqlite", opts.dsn(dsn))
+		}
+	case DriverPostgres:
+		conn, err = sql.Open("postgres", dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -25,6 +131,10 @@ func NewDB(dbPath string) (*DB, error) {
 	// Configure connection pool
 	// SQLite works best with a single connection or very few connections
 	// due to its file-level locking model. Using too many connections causes contention.
+	// PostgreSQL gets the same single writer so lookups of authors, subjects
+	// and bookshelves never race with their inserts. An in-memory database
+	// lives only as long as its connection, so it relies on that one
+	// connection never being replaced.
 	conn.SetMaxOpenConns(1)
 	conn.SetMaxIdleConns(1)
 	conn.SetConnMaxLifetime(0) // Connections don't expire
@@ -35,7 +145,7 @@ func NewDB(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	db := &DB{conn: conn}
+	db := &DB{conn: conn, driver: driver, maxRetries: DefaultMaxRetries, retryDelay: DefaultRetryDelay}
 	if err := db.initSchema(); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
@@ -47,33 +157,186 @@ func NewDB(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to migrate schema: %w", err)
 	}
 
+	if err := db.prepareStatements(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return db, nil
 }
 
-// Close closes the database connection
+// Queries prepared by prepareStatements
+const (
+	// Missing years compare equal through a sentinel outside any real year,
+	// BCE years being negative
+	authorLookupQuery = `
+		SELECT id FROM authors 
+		WHERE name = ? AND 
+		      COALESCE(birth_year, -99999) = COALESCE(?, -99999) AND
+		      COALESCE(death_year, -99999) = COALESCE(?, -99999)
+	`
+	agentLookupQuery     = "SELECT id FROM authors WHERE agent_id = ? ORDER BY id LIMIT 1"
+	subjectLookupQuery   = "SELECT id FROM subjects WHERE subject = ?"
+	bookshelfLookupQuery = "SELECT id FROM bookshelves WHERE bookshelf = ?"
+	formatUpsertQuery    = `
+		INSERT INTO formats (book_id, format_type, file_url, file_size, checksum, modified_date)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(book_id, format_type, file_url) DO UPDATE SET
+			file_size = excluded.file_size,
+			checksum = excluded.checksum,
+			modified_date = excluded.modified_date
+		WHERE (formats.file_size, formats.checksum, formats.modified_date)
+		      IS DISTINCT FROM (excluded.file_size, excluded.checksum, excluded.modified_date)
+	`
+)
+
+// prepareStatements prepares the statements reused by every insertBook call
+func (db *DB) prepareStatements() error {
+	statements := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&db.authorLookup, authorLookupQuery},
+		{&db.agentLookup, agentLookupQuery},
+		{&db.subjectLookup, subjectLookupQuery},
+		{&db.bookshelfLookup, bookshelfLookupQuery},
+		{&db.formatUpsert, formatUpsertQuery},
+	}
+	for _, s := range statements {
+		stmt, err := db.conn.Prepare(db.rebind(s.query))
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		*s.stmt = stmt
+	}
+	return nil
+}
+
+// OpenReadOnly opens an existing database without creating or migrating it
+func OpenReadOnly(dbPath string) (*DB, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	conn, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return &DB{conn: conn, driver: DriverSQLite}, nil
+}
+
+// Close closes the prepared statements and the database connection
 func (db *DB) Close() error {
+	for _, stmt := range []*sql.Stmt{db.authorLookup, db.agentLookup, db.subjectLookup, db.bookshelfLookup, db.formatUpsert} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
 	return db.conn.Close()
 }
 
-// initSchema creates all necessary tables and indexes
-func (db *DB) initSchema() error {
-	schema := `
+// StartImportRun records a new import run and tags subjects and bookshelves
+// first seen from now on with its ID
+func (db *DB) StartImportRun(source string) (int64, error) {
+	var runID int64
+	err := db.conn.QueryRow(db.rebind(`
+		INSERT INTO import_runs (source, status, started_at)
+		VALUES (?, 'running', ?)
+		RETURNING id
+	`), source, time.Now()).Scan(&runID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record import run: %w", err)
+	}
+	db.runID = sql.NullInt64{Int64: runID, Valid: true}
+	return runID, nil
+}
+
+// FinishImportRun marks the current import run with a final status such as
+// "completed" or "failed". It is a no-op when no run was started.
+func (db *DB) FinishImportRun(status string) error {
+	if !db.runID.Valid {
+		return nil
+	}
+	_, err := db.conn.Exec(db.rebind(`
+		UPDATE import_runs SET status = ?, finished_at = ? WHERE id = ?
+	`), status, time.Now(), db.runID.Int64)
+	if err != nil {
+		return fmt.Errorf("failed to finish import run: %w", err)
+	}
+	db.runID = sql.NullInt64{}
+	return nil
+}
+
+// SetEmptyAsNull controls whether empty or whitespace-only text values are
+// stored as NULL instead of empty strings
+func (db *DB) SetEmptyAsNull(enabled bool) {
+	db.emptyAsNull = enabled
+}
+
+// SetWarningHandler sets the function called for non-fatal data issues found
+// while inserting, such as a format whose file size changed. By default
+// warnings are logged.
+func (db *DB) SetWarningHandler(handler func(gutenbergID, message string)) {
+	db.onWarning = handler
+}
+
+// warn reports a non-fatal data issue for a book
+func (db *DB) warn(gutenbergID, message string) {
+	if db.onWarning != nil {
+		db.onWarning(gutenbergID, message)
+		return
+	}
+	slog.Warn("book data issue", "gutenberg_id", gutenbergID, "issue", message)
+}
+
+// text returns the value to bind for a text column, honoring emptyAsNull
+func (db *DB) text(value string) interface{} {
+	if db.emptyAsNull && strings.TrimSpace(value) == "" {
+		return nil
+	}
+	return value
+}
+
+// catalogSchema creates every table, index and view of a new catalog. It is
+// written for SQLite; ddl adapts it to PostgreSQL.
+const catalogSchema = `
+	-- Publishers table
+	CREATE TABLE IF NOT EXISTS publishers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
 	-- Books table
 	CREATE TABLE IF NOT EXISTS books (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		gutenberg_id TEXT UNIQUE NOT NULL,
 		title TEXT,
+		book_type TEXT,
 		language TEXT,
 		publisher TEXT,
+		publisher_id INTEGER REFERENCES publishers(id),
 		license TEXT,
 		rights TEXT,
+		rights_status TEXT,
 		issued_date TEXT,
+		modified_date TEXT,
+		cover_url TEXT,
 		download_count INTEGER DEFAULT 0,
 		description TEXT,
 		summary TEXT,
 		production_notes TEXT,
 		reading_ease_score TEXT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		completeness REAL,
+		approx_size INTEGER,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
 	-- Authors table
@@ -81,12 +344,15 @@ func (db *DB) initSchema() error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT NOT NULL,
 		first_name TEXT,
+		middle_name TEXT,
 		last_name TEXT,
+		suffix TEXT,
 		agent_id TEXT,
 		alias TEXT,
 		webpage TEXT,
 		birth_year INTEGER,
 		death_year INTEGER,
+		year_is_approximate BOOLEAN NOT NULL DEFAULT FALSE,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -102,10 +368,38 @@ func (db *DB) initSchema() error {
 		FOREIGN KEY (author_id) REFERENCES authors(id) ON DELETE CASCADE
 	);
 
+	-- Book-Contributor relationship table (editors, translators, ...)
+	CREATE TABLE IF NOT EXISTS book_contributors (
+		book_id INTEGER NOT NULL,
+		author_id INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		PRIMARY KEY (book_id, author_id, role),
+		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+		FOREIGN KEY (author_id) REFERENCES authors(id) ON DELETE CASCADE
+	);
+
+	-- Import runs table
+	CREATE TABLE IF NOT EXISTS import_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		source TEXT,
+		status TEXT NOT NULL,
+		started_at TIMESTAMP,
+		finished_at TIMESTAMP
+	);
+
+	-- Import progress per RDF file, so --resume can skip files before parsing
+	CREATE TABLE IF NOT EXISTS import_progress (
+		file_name TEXT PRIMARY KEY,
+		content_hash TEXT NOT NULL,
+		status TEXT NOT NULL,
+		processed_at TIMESTAMP
+	);
+
 	-- Subjects table
 	CREATE TABLE IF NOT EXISTS subjects (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		subject TEXT UNIQUE NOT NULL,
+		run_id INTEGER REFERENCES import_runs(id),
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -118,10 +412,27 @@ func (db *DB) initSchema() error {
 		FOREIGN KEY (subject_id) REFERENCES subjects(id) ON DELETE CASCADE
 	);
 
+	-- Book-Language relationship table
+	CREATE TABLE IF NOT EXISTS book_languages (
+		book_id INTEGER NOT NULL,
+		language_code TEXT NOT NULL,
+		PRIMARY KEY (book_id, language_code),
+		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+	);
+
+	-- Book-LCC classification table
+	CREATE TABLE IF NOT EXISTS book_classifications (
+		book_id INTEGER NOT NULL,
+		lcc_code TEXT NOT NULL,
+		PRIMARY KEY (book_id, lcc_code),
+		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+	);
+
 	-- Bookshelves table
 	CREATE TABLE IF NOT EXISTS bookshelves (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		bookshelf TEXT UNIQUE NOT NULL,
+		run_id INTEGER REFERENCES import_runs(id),
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -141,28 +452,77 @@ func (db *DB) initSchema() error {
 		format_type TEXT NOT NULL,
 		file_url TEXT,
 		file_size INTEGER,
+		checksum TEXT,
+		modified_date TEXT,
+		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+	);
+
+	-- Raw RDF documents, kept so books can be reparsed without the archive.
+	-- Documents stored by --store-raw are gzipped into xml_gzip, leaving xml empty.
+	CREATE TABLE IF NOT EXISTS raw_rdf (
+		book_id INTEGER PRIMARY KEY,
+		xml TEXT NOT NULL,
+		xml_gzip BLOB,
 		FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
 	);
 
 	-- Indexes for performance
 	CREATE INDEX IF NOT EXISTS idx_books_gutenberg_id ON books(gutenberg_id);
 	CREATE INDEX IF NOT EXISTS idx_authors_name ON authors(name);
+	CREATE INDEX IF NOT EXISTS idx_book_classifications_code ON book_classifications(lcc_code);
 	CREATE INDEX IF NOT EXISTS idx_book_authors_book_id ON book_authors(book_id);
 	CREATE INDEX IF NOT EXISTS idx_book_authors_author_id ON book_authors(author_id);
+	CREATE INDEX IF NOT EXISTS idx_book_contributors_author_id ON book_contributors(author_id);
 	CREATE INDEX IF NOT EXISTS idx_book_subjects_book_id ON book_subjects(book_id);
 	CREATE INDEX IF NOT EXISTS idx_book_subjects_subject_id ON book_subjects(subject_id);
+	CREATE INDEX IF NOT EXISTS idx_book_languages_language_code ON book_languages(language_code);
 	CREATE INDEX IF NOT EXISTS idx_book_bookshelves_book_id ON book_bookshelves(book_id);
 	CREATE INDEX IF NOT EXISTS idx_book_bookshelves_bookshelf_id ON book_bookshelves(bookshelf_id);
 	CREATE INDEX IF NOT EXISTS idx_formats_book_id ON formats(book_id);
-	`
 
-	if _, err := db.conn.Exec(schema); err != nil {
+	-- Everyone credited on a book, authors and contributors alike, with their role
+	CREATE VIEW IF NOT EXISTS book_people AS
+		SELECT ba.book_id, b.gutenberg_id, ba.author_id, a.name, 'author' AS role
+		FROM book_authors ba
+		JOIN books b ON b.id = ba.book_id
+		JOIN authors a ON a.id = ba.author_id
+		UNION ALL
+		SELECT bc.book_id, b.gutenberg_id, bc.author_id, a.name, bc.role
+		FROM book_contributors bc
+		JOIN books b ON b.id = bc.book_id
+		JOIN authors a ON a.id = bc.author_id;
+`
+
+// initSchema creates all necessary tables and indexes
+func (db *DB) initSchema() error {
+	if _, err := db.conn.Exec(db.ddl(catalogSchema)); err != nil {
 		return fmt.Errorf("failed to create schema: %w", err)
 	}
 
 	return nil
 }
 
+// indexMigrations create the indexes added after catalogSchema was first
+// released, with the data fixes some of them need. They run after the
+// column migrations, on new catalogs as well as old ones.
+var indexMigrations = []string{
+	`CREATE INDEX IF NOT EXISTS idx_authors_first_name ON authors(first_name)`,
+	`CREATE INDEX IF NOT EXISTS idx_authors_last_name ON authors(last_name)`,
+	`CREATE INDEX IF NOT EXISTS idx_authors_agent_id ON authors(agent_id)`,
+	`CREATE INDEX IF NOT EXISTS idx_books_publisher_id ON books(publisher_id)`,
+	// Formats were unique by (book_id, file_url) before format_type joined the key
+	`DROP INDEX IF EXISTS idx_formats_book_url`,
+	// Collapse duplicate formats left by older imports before enforcing uniqueness
+	`DELETE FROM formats WHERE id NOT IN (SELECT MAX(id) FROM formats GROUP BY book_id, format_type, file_url)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_formats_book_type_url ON formats(book_id, format_type, file_url)`,
+	`CREATE INDEX IF NOT EXISTS idx_books_updated_at ON books(updated_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_books_rights_status ON books(rights_status)`,
+	// Books imported before book_languages existed keep their single language
+	`INSERT INTO book_languages (book_id, language_code)
+	 SELECT id, language FROM books WHERE language IS NOT NULL AND language != ''
+	 ON CONFLICT DO NOTHING`,
+}
+
 // migrateSchema adds new columns to existing tables if they don't exist
 func (db *DB) migrateSchema() error {
 	migrations := []string{
@@ -179,68 +539,220 @@ func (db *DB) migrateSchema() error {
 		`ALTER TABLE books ADD COLUMN summary TEXT`,
 		`ALTER TABLE books ADD COLUMN production_notes TEXT`,
 		`ALTER TABLE books ADD COLUMN reading_ease_score TEXT`,
+		`ALTER TABLE books ADD COLUMN completeness REAL`,
+		`ALTER TABLE books ADD COLUMN approx_size INTEGER`,
+		`ALTER TABLE subjects ADD COLUMN run_id INTEGER REFERENCES import_runs(id)`,
+		`ALTER TABLE bookshelves ADD COLUMN run_id INTEGER REFERENCES import_runs(id)`,
+		`ALTER TABLE books ADD COLUMN publisher_id INTEGER REFERENCES publishers(id)`,
+		`ALTER TABLE formats ADD COLUMN checksum TEXT`,
+		`ALTER TABLE authors ADD COLUMN middle_name TEXT`,
+		`ALTER TABLE authors ADD COLUMN suffix TEXT`,
+		`ALTER TABLE books ADD COLUMN book_type TEXT`,
+		`ALTER TABLE books ADD COLUMN modified_date TEXT`,
+		`ALTER TABLE books ADD COLUMN cover_url TEXT`,
+		`ALTER TABLE authors ADD COLUMN year_is_approximate BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE books ADD COLUMN updated_at TIMESTAMP`,
+		`ALTER TABLE formats ADD COLUMN modified_date TEXT`,
+		`ALTER TABLE books ADD COLUMN rights_status TEXT`,
+		`ALTER TABLE raw_rdf ADD COLUMN xml_gzip BLOB`,
 	}
 
 	for _, migration := range migrations {
 		// SQLite doesn't support IF NOT EXISTS for ALTER TABLE ADD COLUMN,
 		// so we need to check if the column exists first
-		_, err := db.conn.Exec(migration)
+		_, err := db.conn.Exec(db.ddl(migration))
 		if err != nil {
 			// Ignore "duplicate column name" errors (column already exists)
 			// SQLite returns error code 1 for this
 			if !strings.Contains(err.Error(), "duplicate column") {
 				// For other errors, log but don't fail (might be column already exists)
-				log.Printf("Migration warning (may be safe to ignore): %v", err)
+				slog.Warn("migration failed, may be safe to ignore", "statement", strings.TrimSpace(migration), "error", err)
 			}
 		}
 	}
 
 	// Create indexes if they don't exist
-	indexMigrations := []string{
-		`CREATE INDEX IF NOT EXISTS idx_authors_first_name ON authors(first_name)`,
-		`CREATE INDEX IF NOT EXISTS idx_authors_last_name ON authors(last_name)`,
-		`CREATE INDEX IF NOT EXISTS idx_authors_agent_id ON authors(agent_id)`,
+	for _, migration := range indexMigrations {
+		if _, err := db.conn.Exec(db.ddl(migration)); err != nil {
+			slog.Warn("index migration failed", "statement", strings.Join(strings.Fields(migration), " "), "error", err)
+		}
 	}
 
-	for _, migration := range indexMigrations {
-		if _, err := db.conn.Exec(migration); err != nil {
-			log.Printf("Index creation warning: %v", err)
+	if err := db.backfillBookTimestamps(); err != nil {
+		return err
+	}
+
+	if err := db.backfillRightsStatus(); err != nil {
+		return err
+	}
+
+	if err := db.initSearchIndex(); err != nil {
+		return err
+	}
+
+	// PostgreSQL has no user_version; the schema command is SQLite-only
+	if db.driver == DriverSQLite {
+		if _, err := db.conn.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)); err != nil {
+			return fmt.Errorf("failed to record schema version: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// boundTimeLayout is how the SQLite driver stores a bound time.Time, which
+// older imports used for books.created_at
+const boundTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// backfillBookTimestamps rewrites the created_at values older imports bound
+// from Go times as UTC in CURRENT_TIMESTAMP's format, then starts books from
+// before updated_at existed with updated_at equal to created_at, so both
+// columns compare as plain strings on SQLite. PostgreSQL stores real
+// timestamps and needs only the second step.
+func (db *DB) backfillBookTimestamps() error {
+	if db.driver == DriverSQLite {
+		rows, err := db.conn.Query(`SELECT id, CAST(created_at AS TEXT) FROM books WHERE created_at IS NOT NULL AND datetime(created_at) IS NULL`)
+		if err != nil {
+			return fmt.Errorf("failed to read book timestamps: %w", err)
+		}
+		created := make(map[int64]string)
+		for rows.Next() {
+			var id int64
+			var value string
+			if err := rows.Scan(&id, &value); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read book timestamps: %w", err)
+			}
+			// time.Now() values also carry the monotonic clock reading
+			value, _, _ = strings.Cut(value, " m=")
+			if t, err := time.Parse(boundTimeLayout, value); err == nil {
+				created[id] = t.UTC().Format(time.DateTime)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read book timestamps: %w", err)
+		}
+
+		if len(created) > 0 {
+			tx, err := db.conn.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			for id, value := range created {
+				if _, err := tx.Exec(`UPDATE books SET created_at = ? WHERE id = ?`, value, id); err != nil {
+					return fmt.Errorf("failed to backfill created_at: %w", err)
+				}
+			}
+			if err := tx.Commit(); err != nil {
+				return fmt.Errorf("failed to backfill created_at: %w", err)
+			}
 		}
 	}
 
+	if _, err := db.conn.Exec(`UPDATE books SET updated_at = created_at WHERE updated_at IS NULL`); err != nil {
+		return fmt.Errorf("failed to backfill updated_at: %w", err)
+	}
 	return nil
 }
 
 // Book represents a book record
 type Book struct {
-	GutenbergID      string
-	Title            string
-	Language         string
-	Publisher        string
-	License          string
-	Rights           string
-	IssuedDate       string
+	GutenbergID string
+	Title       string
+	// Type is the DCMI type of the item, e.g. "Text", "Sound" or "StillImage"
+	Type     string
+	Language string
+	// Languages lists every language of the book; Language is the first of them
+	Languages  []string
+	Publisher  string
+	License    string
+	Rights     string
+	IssuedDate string
+	// Modified is the dcterms:modified timestamp of the catalog record, as written in the RDF
+	Modified         string
 	DownloadCount    int
 	Description      string
 	Summary          string
 	ProductionNotes  string
 	ReadingEaseScore string
 	Authors          []Author
+	Contributors     []Contributor
 	Subjects         []string
+	Classifications  []string // Library of Congress Classification codes, e.g. "PR"
 	Bookshelves      []string
 	Formats          []Format
+	// CoverURL is the preferred cover image among Formats, if the book has one
+	CoverURL string
+	// RawRDFGzip, when set, is the gzip-compressed original RDF document,
+	// stored in raw_rdf along with the book (--store-raw)
+	RawRDFGzip []byte
+	// Charset is the encoding the RDF declared, lowercased, when it wasn't
+	// UTF-8 and had to be decoded; it isn't stored
+	Charset string
+}
+
+// Completeness returns the fraction of key catalog fields (title, author,
+// language, subject, format, description) that are populated, from 0 to 1.
+func (b *Book) Completeness() float64 {
+	fields := []bool{
+		b.Title != "",
+		len(b.Authors) > 0,
+		b.Language != "",
+		len(b.Subjects) > 0,
+		len(b.Formats) > 0,
+		b.Description != "",
+	}
+
+	populated := 0
+	for _, ok := range fields {
+		if ok {
+			populated++
+		}
+	}
+	return float64(populated) / float64(len(fields))
+}
+
+// ApproxSize returns the size in bytes of the book's largest plain-text
+// format, as a rough length estimate, or nil if no plain-text format has a size
+func (b *Book) ApproxSize() *int64 {
+	var largest *int64
+	for _, format := range b.Formats {
+		if !strings.HasPrefix(format.Type, "text/plain") || format.FileSize == nil {
+			continue
+		}
+		if largest == nil || *format.FileSize > *largest {
+			size := *format.FileSize
+			largest = &size
+		}
+	}
+	return largest
+}
+
+// Contributor is a person credited on a book in a role other than author,
+// such as editor, translator or illustrator
+type Contributor struct {
+	Author
+	Role string
 }
 
 // Author represents an author record
 type Author struct {
-	Name      string
-	FirstName string
-	LastName  string
-	AgentID   string
-	Alias     string
-	Webpage   string
+	Name       string
+	FirstName  string
+	MiddleName string
+	LastName   string
+	Suffix     string
+	AgentID    string
+	Alias      string
+	Webpage    string
+	// BirthYear and DeathYear are negative for BCE years
 	BirthYear *int
 	DeathYear *int
+	// YearIsApproximate is set when either year is marked uncertain in the
+	// RDF, e.g. "c. 1400", "fl. 1580" or "1770 or 1771"
+	YearIsApproximate bool
 }
 
 // Format represents a file format for a book
@@ -248,12 +760,17 @@ type Format struct {
 	Type     string
 	FileURL  string
 	FileSize *int64
+	// Checksum is the file's hex MD5 when the RDF lists one, otherwise empty
+	Checksum string
+	// Modified is the file's dcterms:modified timestamp as given in the
+	// RDF, otherwise empty
+	Modified string
 }
 
 // BookExists checks if a book with the given Gutenberg ID already exists
 func (db *DB) BookExists(gutenbergID string) (bool, error) {
 	var count int
-	err := db.conn.QueryRow("SELECT COUNT(*) FROM books WHERE gutenberg_id = ?", gutenbergID).Scan(&count)
+	err := db.conn.QueryRow(db.rebind("SELECT COUNT(*) FROM books WHERE gutenberg_id = ?"), gutenbergID).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -262,175 +779,486 @@ func (db *DB) BookExists(gutenbergID string) (bool, error) {
 
 // InsertBook inserts a book and all related data in a transaction
 func (db *DB) InsertBook(book *Book) error {
-	tx, err := db.conn.Begin()
+	return db.insertBookWithIDs(book, nil)
+}
+
+// insertBookWithIDs inserts a book in its own transaction, linking authors and
+// subjects already resolved in ids. The transaction is retried if the
+// database is busy.
+func (db *DB) insertBookWithIDs(book *Book, ids *relationIDs) error {
+	return db.withRetry(func() error {
+		return db.insertBookTx(book, ids)
+	})
+}
+
+// insertBookTx runs one attempt of insertBookWithIDs
+func (db *DB) insertBookTx(book *Book, ids *relationIDs) error {
+	tx, err := db.begin()
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return err
 	}
 	defer tx.Rollback()
 
-	// Insert or update book (preserve created_at for existing books)
+	if err := db.insertBook(tx, book, ids); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// keepDownloadCount is the upsert's new download_count: the parsed count,
+// or the stored one when the document gave none
+const keepDownloadCount = "CASE WHEN excluded.download_count = 0 THEN books.download_count ELSE excluded.download_count END"
+
+// insertBook inserts a book and all related data within an existing transaction.
+// Authors and subjects found in ids are linked without being looked up; ids may be nil.
+func (db *DB) insertBook(tx *dbTx, book *Book, ids *relationIDs) error {
+	// Insert publisher, deduplicated by name with runs of whitespace collapsed
+	var publisherID sql.NullInt64
+	if publisher := strings.Join(strings.Fields(book.Publisher), " "); publisher != "" {
+		err := tx.QueryRow("SELECT id FROM publishers WHERE name = ?", publisher).Scan(&publisherID)
+		if err == sql.ErrNoRows {
+			err := tx.QueryRow(`
+				INSERT INTO publishers (name, created_at)
+				VALUES (?, ?)
+				RETURNING id
+			`, publisher, time.Now()).Scan(&publisherID)
+			if err != nil {
+				return fmt.Errorf("failed to insert publisher: %w", err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("failed to query publisher: %w", err)
+		}
+	}
+
+	// An existing book's updated_at also moves when only its links or formats
+	// change, which is checked once they're written
+	var bookID int64
+	err := tx.QueryRow("SELECT id FROM books WHERE gutenberg_id = ?", book.GutenbergID).Scan(&bookID)
+	existed := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to query book: %w", err)
+	}
+
+	// Insert or update book (preserve created_at for existing books). Both
+	// timestamps come from CURRENT_TIMESTAMP, so they share its UTC format.
+	// The update only happens, and updated_at only moves, when a field differs.
+	// Some RDF has no downloads element, so a 0 download count keeps the
+	// count already stored rather than resetting it.
 	_, err = tx.Exec(`
-		INSERT INTO books (gutenberg_id, title, language, publisher, license, rights, issued_date, download_count, description, summary, production_notes, reading_ease_score, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO books (gutenberg_id, title, book_type, language, publisher, publisher_id, license, rights, rights_status, issued_date, modified_date, cover_url, download_count, description, summary, production_notes, reading_ease_score, completeness, approx_size, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 		ON CONFLICT(gutenberg_id) DO UPDATE SET
 			title = excluded.title,
+			book_type = excluded.book_type,
 			language = excluded.language,
 			publisher = excluded.publisher,
+			publisher_id = excluded.publisher_id,
 			license = excluded.license,
 			rights = excluded.rights,
+			rights_status = excluded.rights_status,
 			issued_date = excluded.issued_date,
-			download_count = excluded.download_count,
+			modified_date = excluded.modified_date,
+			cover_url = excluded.cover_url,
+			download_count = `+keepDownloadCount+`,
 			description = excluded.description,
 			summary = excluded.summary,
 			production_notes = excluded.production_notes,
-			reading_ease_score = excluded.reading_ease_score
-	`, book.GutenbergID, book.Title, book.Language, book.Publisher, book.License, book.Rights, book.IssuedDate, book.DownloadCount, book.Description, book.Summary, book.ProductionNotes, book.ReadingEaseScore, time.Now())
+			reading_ease_score = excluded.reading_ease_score,
+			completeness = excluded.completeness,
+			approx_size = excluded.approx_size,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE (books.title, books.book_type, books.language, books.publisher, books.publisher_id, books.license, books.rights, books.rights_status,
+		       books.issued_date, books.modified_date, books.cover_url, books.download_count, books.description, books.summary,
+		       books.production_notes, books.reading_ease_score, books.completeness, books.approx_size)
+		  IS DISTINCT FROM
+		      (excluded.title, excluded.book_type, excluded.language, excluded.publisher, excluded.publisher_id, excluded.license, excluded.rights, excluded.rights_status,
+		       excluded.issued_date, excluded.modified_date, excluded.cover_url, `+keepDownloadCount+`, excluded.description, excluded.summary,
+		       excluded.production_notes, excluded.reading_ease_score, excluded.completeness, excluded.approx_size)
+	`, book.GutenbergID, db.text(book.Title), db.text(book.Type), db.text(book.Language), db.text(book.Publisher), publisherID, db.text(book.License), db.text(book.Rights), normalizeRights(book.Rights), db.text(book.IssuedDate), db.text(book.Modified), db.text(book.CoverURL), book.DownloadCount, db.text(book.Description), db.text(book.Summary), db.text(book.ProductionNotes), db.text(book.ReadingEaseScore), book.Completeness(), book.ApproxSize())
 	if err != nil {
 		return fmt.Errorf("failed to insert book: %w", err)
 	}
 
-	// Get the book ID (works for both INSERT and REPLACE)
-	var bookID int64
-	err = tx.QueryRow("SELECT id FROM books WHERE gutenberg_id = ?", book.GutenbergID).Scan(&bookID)
-	if err != nil {
-		return fmt.Errorf("failed to get book ID: %w", err)
+	if !existed {
+		err = tx.QueryRow("SELECT id FROM books WHERE gutenberg_id = ?", book.GutenbergID).Scan(&bookID)
+		if err != nil {
+			return fmt.Errorf("failed to get book ID: %w", err)
+		}
 	}
 
+	// changed records whether any link or format row was added, updated or
+	// removed
+	changed := false
+
 	// Insert authors
 	for _, author := range book.Authors {
-		var authorID int64
-		// Check if author exists - use COALESCE for NULL-safe comparison
-		var existingID sql.NullInt64
-		err := tx.QueryRow(`
-			SELECT id FROM authors 
-			WHERE name = ? AND 
-			      COALESCE(birth_year, -1) = COALESCE(?, -1) AND
-			      COALESCE(death_year, -1) = COALESCE(?, -1)
-		`, author.Name, author.BirthYear, author.DeathYear).Scan(&existingID)
-
-		if err == nil && existingID.Valid {
-			// Author exists, use existing ID
-			authorID = existingID.Int64
-
-			// Update author fields if they're not already set
-			_, err = tx.Exec(`
-				UPDATE authors 
-				SET first_name = COALESCE(NULLIF(?, ''), first_name),
-				    last_name = COALESCE(NULLIF(?, ''), last_name),
-				    agent_id = COALESCE(NULLIF(?, ''), agent_id),
-				    alias = COALESCE(NULLIF(?, ''), alias),
-				    webpage = COALESCE(NULLIF(?, ''), webpage)
-				WHERE id = ?
-			`, author.FirstName, author.LastName, author.AgentID, author.Alias, author.Webpage, authorID)
-			if err != nil {
-				return fmt.Errorf("failed to update author: %w", err)
-			}
-		} else if err == sql.ErrNoRows {
-			// Insert new author
-			result, err := tx.Exec(`
-				INSERT INTO authors (name, first_name, last_name, agent_id, alias, webpage, birth_year, death_year, created_at)
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-			`, author.Name, author.FirstName, author.LastName, author.AgentID, author.Alias, author.Webpage, author.BirthYear, author.DeathYear, time.Now())
-			if err != nil {
-				return fmt.Errorf("failed to insert author: %w", err)
-			}
-			authorID, err = result.LastInsertId()
-			if err != nil {
-				return fmt.Errorf("failed to get author ID: %w", err)
+		authorID, ok := ids.author(author)
+		if !ok {
+			var err error
+			if authorID, err = db.upsertAuthor(tx, author); err != nil {
+				return err
 			}
-		} else if err != nil {
-			return fmt.Errorf("failed to query author: %w", err)
 		}
 
-		_, err = tx.Exec(`
-			INSERT OR IGNORE INTO book_authors (book_id, author_id)
+		result, err := tx.Exec(`
+			INSERT INTO book_authors (book_id, author_id)
 			VALUES (?, ?)
+			ON CONFLICT DO NOTHING
 		`, bookID, authorID)
 		if err != nil {
 			return fmt.Errorf("failed to link author: %w", err)
 		}
+		changed = changed || touched(result)
+	}
+
+	// Insert contributors; they share the authors table and are linked by role
+	for _, contributor := range book.Contributors {
+		authorID, ok := ids.author(contributor.Author)
+		if !ok {
+			var err error
+			if authorID, err = db.upsertAuthor(tx, contributor.Author); err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO book_contributors (book_id, author_id, role)
+			VALUES (?, ?, ?)
+			ON CONFLICT DO NOTHING
+		`, bookID, authorID, contributor.Role)
+		if err != nil {
+			return fmt.Errorf("failed to link contributor: %w", err)
+		}
+		changed = changed || touched(result)
 	}
 
 	// Insert subjects
 	for _, subject := range book.Subjects {
-		var subjectID int64
-		// Try to get existing subject ID
-		err := tx.QueryRow("SELECT id FROM subjects WHERE subject = ?", subject).Scan(&subjectID)
-		if err == sql.ErrNoRows {
-			// Insert new subject
-			result, err := tx.Exec(`
-				INSERT INTO subjects (subject, created_at)
-				VALUES (?, ?)
-			`, subject, time.Now())
-			if err != nil {
-				return fmt.Errorf("failed to insert subject: %w", err)
+		subjectID, ok := ids.subject(subject)
+		if !ok {
+			var err error
+			if subjectID, err = db.upsertSubject(tx, subject); err != nil {
+				return err
 			}
-			subjectID, err = result.LastInsertId()
-			if err != nil {
-				return fmt.Errorf("failed to get subject ID: %w", err)
-			}
-		} else if err != nil {
-			return fmt.Errorf("failed to query subject: %w", err)
 		}
 
-		_, err = tx.Exec(`
-			INSERT OR IGNORE INTO book_subjects (book_id, subject_id)
+		result, err := tx.Exec(`
+			INSERT INTO book_subjects (book_id, subject_id)
 			VALUES (?, ?)
+			ON CONFLICT DO NOTHING
 		`, bookID, subjectID)
 		if err != nil {
 			return fmt.Errorf("failed to link subject: %w", err)
 		}
+		changed = changed || touched(result)
 	}
 
-	// Delete existing formats for this book (to avoid duplicates on re-import)
-	// Only delete if we have new formats to insert, otherwise preserve existing formats
-	if len(book.Formats) > 0 {
-		_, err = tx.Exec("DELETE FROM formats WHERE book_id = ?", bookID)
+	// Insert languages, falling back to the primary language alone
+	languages := book.Languages
+	if len(languages) == 0 && book.Language != "" {
+		languages = []string{book.Language}
+	}
+	for _, language := range languages {
+		result, err := tx.Exec(`
+			INSERT INTO book_languages (book_id, language_code)
+			VALUES (?, ?)
+			ON CONFLICT DO NOTHING
+		`, bookID, language)
+		if err != nil {
+			return fmt.Errorf("failed to link language: %w", err)
+		}
+		changed = changed || touched(result)
+	}
+
+	// Insert LCC classifications
+	for _, code := range book.Classifications {
+		result, err := tx.Exec(`
+			INSERT INTO book_classifications (book_id, lcc_code)
+			VALUES (?, ?)
+			ON CONFLICT DO NOTHING
+		`, bookID, code)
 		if err != nil {
-			return fmt.Errorf("failed to delete existing formats: %w", err)
+			return fmt.Errorf("failed to link classification: %w", err)
 		}
+		changed = changed || touched(result)
 	}
 
 	// Insert bookshelves
 	for _, bookshelf := range book.Bookshelves {
 		var bookshelfID int64
 		// Try to get existing bookshelf ID
-		err := tx.QueryRow("SELECT id FROM bookshelves WHERE bookshelf = ?", bookshelf).Scan(&bookshelfID)
+		err := tx.use(db.bookshelfLookup).QueryRow(bookshelf).Scan(&bookshelfID)
 		if err == sql.ErrNoRows {
 			// Insert new bookshelf
-			result, err := tx.Exec(`
-				INSERT INTO bookshelves (bookshelf, created_at)
-				VALUES (?, ?)
-			`, bookshelf, time.Now())
+			err := tx.QueryRow(`
+				INSERT INTO bookshelves (bookshelf, run_id, created_at)
+				VALUES (?, ?, ?)
+				RETURNING id
+			`, bookshelf, db.runID, time.Now()).Scan(&bookshelfID)
 			if err != nil {
 				return fmt.Errorf("failed to insert bookshelf: %w", err)
 			}
-			bookshelfID, err = result.LastInsertId()
-			if err != nil {
-				return fmt.Errorf("failed to get bookshelf ID: %w", err)
-			}
 		} else if err != nil {
 			return fmt.Errorf("failed to query bookshelf: %w", err)
 		}
 
-		_, err = tx.Exec(`
-			INSERT OR IGNORE INTO book_bookshelves (book_id, bookshelf_id)
+		result, err := tx.Exec(`
+			INSERT INTO book_bookshelves (book_id, bookshelf_id)
 			VALUES (?, ?)
+			ON CONFLICT DO NOTHING
 		`, bookID, bookshelfID)
 		if err != nil {
 			return fmt.Errorf("failed to link bookshelf: %w", err)
 		}
+		changed = changed || touched(result)
+	}
+
+	// Upsert formats keyed on (book_id, format_type, file_url), warning when a known file's size changed.
+	// Rows are updated in place, so their IDs and any columns added outside the
+	// importer survive a re-import. A URL whose type changes is a new format:
+	// it gets a new row and the old one is removed with the other stale ones.
+	// Only touch formats if we have new ones, otherwise preserve existing formats.
+	if len(book.Formats) > 0 {
+		existingSizes, err := formatSizes(tx, bookID)
+		if err != nil {
+			return err
+		}
+
+		for _, format := range book.Formats {
+			key := formatKey{format.Type, format.FileURL}
+			if previous, ok := existingSizes[key]; ok && previous.Valid && format.FileSize != nil && previous.Int64 != *format.FileSize {
+				tx.warn(book.GutenbergID, fmt.Sprintf("file size of %s changed from %d to %d", format.FileURL, previous.Int64, *format.FileSize))
+			}
+
+			result, err := tx.use(db.formatUpsert).Exec(bookID, format.Type, format.FileURL, format.FileSize, sql.NullString{String: format.Checksum, Valid: format.Checksum != ""}, sql.NullString{String: format.Modified, Valid: format.Modified != ""})
+			if err != nil {
+				return fmt.Errorf("failed to insert format: %w", err)
+			}
+			changed = changed || touched(result)
+			delete(existingSizes, key)
+		}
+
+		// Remove formats that are no longer listed for this book
+		for key := range existingSizes {
+			result, err := tx.Exec("DELETE FROM formats WHERE book_id = ? AND format_type = ? AND file_url = ?", bookID, key.formatType, key.fileURL)
+			if err != nil {
+				return fmt.Errorf("failed to delete stale format: %w", err)
+			}
+			changed = changed || touched(result)
+		}
+	}
+
+	if existed && changed {
+		if _, err := tx.Exec("UPDATE books SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", bookID); err != nil {
+			return fmt.Errorf("failed to update book timestamp: %w", err)
+		}
 	}
 
-	// Insert formats
-	for _, format := range book.Formats {
+	if book.RawRDFGzip != nil {
+		if _, err := tx.Exec(rawRDFUpsertQuery, bookID, book.RawRDFGzip); err != nil {
+			return fmt.Errorf("failed to store raw RDF: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// touched reports whether a statement added, updated or removed any row
+func touched(result sql.Result) bool {
+	n, err := result.RowsAffected()
+	return err == nil && n > 0
+}
+
+// upsertAuthor returns the ID of an author, inserting it or filling its missing
+// fields. Authors are matched by agent_id when the RDF gives one, since the
+// same agent can appear with differently punctuated names; otherwise, or when
+// no author has that agent_id yet, by name and life dates.
+func (db *DB) upsertAuthor(tx *dbTx, author Author) (int64, error) {
+	var authorID int64
+	var existingID sql.NullInt64
+	err := sql.ErrNoRows
+	if author.AgentID != "" {
+		err = tx.use(db.agentLookup).QueryRow(author.AgentID).Scan(&existingID)
+	}
+	if err == sql.ErrNoRows {
+		// Check if author exists - use COALESCE for NULL-safe comparison
+		err = tx.use(db.authorLookup).QueryRow(author.Name, author.BirthYear, author.DeathYear).Scan(&existingID)
+	}
+
+	if err == nil && existingID.Valid {
+		// Author exists, use existing ID
+		authorID = existingID.Int64
+
+		// Update author fields if they're not already set
+		_, err = tx.Exec(`
+			UPDATE authors 
+			SET first_name = COALESCE(NULLIF(?, ''), first_name),
+			    middle_name = COALESCE(NULLIF(?, ''), middle_name),
+			    last_name = COALESCE(NULLIF(?, ''), last_name),
+			    suffix = COALESCE(NULLIF(?, ''), suffix),
+			    agent_id = COALESCE(NULLIF(?, ''), agent_id),
+			    alias = COALESCE(NULLIF(?, ''), alias),
+			    webpage = COALESCE(NULLIF(?, ''), webpage),
+			    year_is_approximate = (year_is_approximate OR ?)
+			WHERE id = ?
+		`, db.text(author.FirstName), db.text(author.MiddleName), db.text(author.LastName), db.text(author.Suffix), db.text(author.AgentID), db.text(author.Alias), db.text(author.Webpage), author.YearIsApproximate, authorID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update author: %w", err)
+		}
+	} else if err == sql.ErrNoRows {
+		// Insert new author
+		err := tx.QueryRow(`
+			INSERT INTO authors (name, first_name, middle_name, last_name, suffix, agent_id, alias, webpage, birth_year, death_year, year_is_approximate, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, author.Name, db.text(author.FirstName), db.text(author.MiddleName), db.text(author.LastName), db.text(author.Suffix), db.text(author.AgentID), db.text(author.Alias), db.text(author.Webpage), author.BirthYear, author.DeathYear, author.YearIsApproximate, time.Now()).Scan(&authorID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert author: %w", err)
+		}
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to query author: %w", err)
+	}
+
+	return authorID, nil
+}
+
+// upsertSubject returns the ID of a subject, inserting it if needed
+func (db *DB) upsertSubject(tx *dbTx, subject string) (int64, error) {
+	var subjectID int64
+	// Try to get existing subject ID
+	err := tx.use(db.subjectLookup).QueryRow(subject).Scan(&subjectID)
+	if err == sql.ErrNoRows {
+		// Insert new subject
+		err := tx.QueryRow(`
+			INSERT INTO subjects (subject, run_id, created_at)
+			VALUES (?, ?, ?)
+			RETURNING id
+		`, subject, db.runID, time.Now()).Scan(&subjectID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert subject: %w", err)
+		}
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to query subject: %w", err)
+	}
+	return subjectID, nil
+}
+
+// formatKey identifies a format of a book, as the formats unique index does
+type formatKey struct {
+	formatType string
+	fileURL    string
+}
+
+// formatSizes returns the stored file size of each format of a book
+func formatSizes(tx *dbTx, bookID int64) (map[formatKey]sql.NullInt64, error) {
+	rows, err := tx.Query("SELECT format_type, file_url, file_size FROM formats WHERE book_id = ?", bookID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query existing formats: %w", err)
+	}
+	defer rows.Close()
+
+	sizes := make(map[formatKey]sql.NullInt64)
+	for rows.Next() {
+		var formatType, fileURL sql.NullString
+		var size sql.NullInt64
+		if err := rows.Scan(&formatType, &fileURL, &size); err != nil {
+			return nil, fmt.Errorf("failed to scan existing format: %w", err)
+		}
+		sizes[formatKey{formatType.String, fileURL.String}] = size
+	}
+	return sizes, rows.Err()
+}
+
+// MergeAuthors folds the duplicate authors into the surviving author in a single
+// transaction: every book_authors and book_contributors link is repointed to
+// survivorID, fields missing on the survivor are filled from the duplicates, and
+// the duplicates are deleted. The transaction is rolled back if any dangling
+// book_authors link remains.
+func (db *DB) MergeAuthors(survivorID int64, duplicateIDs ...int64) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM authors WHERE id = ?", survivorID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to query surviving author: %w", err)
+	}
+	if exists == 0 {
+		return fmt.Errorf("surviving author %d not found", survivorID)
+	}
+
+	for _, dupID := range duplicateIDs {
+		if dupID == survivorID {
+			continue
+		}
+
+		// Repoint links; books already linked to the survivor keep their single link
 		_, err := tx.Exec(`
-			INSERT INTO formats (book_id, format_type, file_url, file_size)
-			VALUES (?, ?, ?, ?)
-		`, bookID, format.Type, format.FileURL, format.FileSize)
+			INSERT INTO book_authors (book_id, author_id)
+			SELECT book_id, CAST(? AS INTEGER) FROM book_authors WHERE author_id = ?
+			ON CONFLICT DO NOTHING
+		`, survivorID, dupID)
+		if err != nil {
+			return fmt.Errorf("failed to relink books of author %d: %w", dupID, err)
+		}
+
+		if _, err := tx.Exec("DELETE FROM book_authors WHERE author_id = ?", dupID); err != nil {
+			return fmt.Errorf("failed to remove links of author %d: %w", dupID, err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO book_contributors (book_id, author_id, role)
+			SELECT book_id, CAST(? AS INTEGER), role FROM book_contributors WHERE author_id = ?
+			ON CONFLICT DO NOTHING
+		`, survivorID, dupID)
+		if err != nil {
+			return fmt.Errorf("failed to relink contributions of author %d: %w", dupID, err)
+		}
+
+		if _, err := tx.Exec("DELETE FROM book_contributors WHERE author_id = ?", dupID); err != nil {
+			return fmt.Errorf("failed to remove contributions of author %d: %w", dupID, err)
+		}
+
+		// Fill fields the survivor is missing from the duplicate
+		_, err = tx.Exec(`
+			UPDATE authors
+			SET first_name = COALESCE(NULLIF(first_name, ''), (SELECT first_name FROM authors WHERE id = ?)),
+			    middle_name = COALESCE(NULLIF(middle_name, ''), (SELECT middle_name FROM authors WHERE id = ?)),
+			    last_name = COALESCE(NULLIF(last_name, ''), (SELECT last_name FROM authors WHERE id = ?)),
+			    suffix = COALESCE(NULLIF(suffix, ''), (SELECT suffix FROM authors WHERE id = ?)),
+			    agent_id = COALESCE(NULLIF(agent_id, ''), (SELECT agent_id FROM authors WHERE id = ?)),
+			    alias = COALESCE(NULLIF(alias, ''), (SELECT alias FROM authors WHERE id = ?)),
+			    webpage = COALESCE(NULLIF(webpage, ''), (SELECT webpage FROM authors WHERE id = ?))
+			WHERE id = ?
+		`, dupID, dupID, dupID, dupID, dupID, dupID, dupID, survivorID)
 		if err != nil {
-			return fmt.Errorf("failed to insert format: %w", err)
+			return fmt.Errorf("failed to merge fields of author %d: %w", dupID, err)
 		}
+
+		if _, err := tx.Exec("DELETE FROM authors WHERE id = ?", dupID); err != nil {
+			return fmt.Errorf("failed to delete author %d: %w", dupID, err)
+		}
+	}
+
+	// Verify no links point at authors that no longer exist
+	var dangling int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM book_authors ba
+		LEFT JOIN authors a ON ba.author_id = a.id
+		WHERE a.id IS NULL
+	`).Scan(&dangling)
+	if err != nil {
+		return fmt.Errorf("failed to check for dangling author links: %w", err)
+	}
+	if dangling > 0 {
+		return fmt.Errorf("merge would leave %d dangling book_authors links", dangling)
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -440,22 +1268,93 @@ func (db *DB) InsertBook(book *Book) error {
 	return nil
 }
 
-// BatchInsertBooks inserts multiple books in batches
-func (db *DB) BatchInsertBooks(books []*Book, batchSize int) error {
-	for i := 0; i < len(books); i += batchSize {
-		end := i + batchSize
-		if end > len(books) {
-			end = len(books)
+// DeleteBook removes a book and everything that belongs to it in a single
+// transaction: its author, contributor, subject, language and bookshelf links,
+// formats and stored raw RDF. Authors, subjects, bookshelves and publishers
+// left with no book are deleted too. The child rows are deleted explicitly rather than by
+// ON DELETE CASCADE, since SQLite only enforces foreign keys when PRAGMA
+// foreign_keys is on. It returns ErrNotFound if the book isn't in the catalog.
+func (db *DB) DeleteBook(gutenbergID string) error {
+	return db.withRetry(func() error {
+		return db.deleteBookTx(gutenbergID)
+	})
+}
+
+// deleteBookTx runs one attempt of DeleteBook
+func (db *DB) deleteBookTx(gutenbergID string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var bookID int64
+	var publisherID sql.NullInt64
+	err = tx.QueryRow("SELECT id, publisher_id FROM books WHERE gutenberg_id = ?", gutenbergID).Scan(&bookID, &publisherID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query book: %w", err)
+	}
+
+	// Lookup rows only this book uses go first, while its links still show
+	// which ones they are
+	orphans := []struct{ what, query string }{
+		{"authors", `
+			DELETE FROM authors
+			WHERE id IN (
+				SELECT author_id FROM book_authors WHERE book_id = ?
+				UNION SELECT author_id FROM book_contributors WHERE book_id = ?
+			)
+			AND NOT EXISTS (SELECT 1 FROM book_authors ba WHERE ba.author_id = authors.id AND ba.book_id <> ?)
+			AND NOT EXISTS (SELECT 1 FROM book_contributors bc WHERE bc.author_id = authors.id AND bc.book_id <> ?)
+		`},
+		{"subjects", `
+			DELETE FROM subjects
+			WHERE id IN (SELECT subject_id FROM book_subjects WHERE book_id = ?)
+			AND NOT EXISTS (SELECT 1 FROM book_subjects bs WHERE bs.subject_id = subjects.id AND bs.book_id <> ?)
+		`},
+		{"bookshelves", `
+			DELETE FROM bookshelves
+			WHERE id IN (SELECT bookshelf_id FROM book_bookshelves WHERE book_id = ?)
+			AND NOT EXISTS (SELECT 1 FROM book_bookshelves bb WHERE bb.bookshelf_id = bookshelves.id AND bb.book_id <> ?)
+		`},
+	}
+	for _, orphan := range orphans {
+		args := make([]interface{}, strings.Count(orphan.query, "?"))
+		for i := range args {
+			args[i] = bookID
+		}
+		if _, err := tx.Exec(orphan.query, args...); err != nil {
+			return fmt.Errorf("failed to delete unused %s: %w", orphan.what, err)
+		}
+	}
+
+	for _, table := range []string{"book_authors", "book_contributors", "book_subjects", "book_classifications", "book_languages", "book_bookshelves", "formats", "raw_rdf"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE book_id = ?", bookID); err != nil {
+			return fmt.Errorf("failed to delete %s of book: %w", table, err)
 		}
+	}
 
-		batch := books[i:end]
-		for _, book := range batch {
-			if err := db.InsertBook(book); err != nil {
-				log.Printf("Error inserting book %s: %v", book.GutenbergID, err)
-				// Continue with next book instead of failing entire batch
-			}
+	if _, err := tx.Exec("DELETE FROM books WHERE id = ?", bookID); err != nil {
+		return fmt.Errorf("failed to delete book: %w", err)
+	}
+
+	// The publisher is referenced by the books row itself, so it can only go
+	// once that row is gone
+	if publisherID.Valid {
+		if _, err := tx.Exec(`
+			DELETE FROM publishers
+			WHERE id = ? AND NOT EXISTS (SELECT 1 FROM books WHERE publisher_id = publishers.id)
+		`, publisherID.Int64); err != nil {
+			return fmt.Errorf("failed to delete unused publishers: %w", err)
 		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,891 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompleteness(t *testing.T) {
+	size := int64(100)
+	tests := []struct {
+		name string
+		book Book
+		want float64
+	}{
+		{"empty", Book{GutenbergID: "1"}, 0},
+		{"title only", Book{GutenbergID: "1", Title: "T"}, 1.0 / 6},
+		{"sparse", Book{GutenbergID: "1", Title: "T", Language: "en", Subjects: []string{"S"}}, 0.5},
+		{"fully populated", Book{
+			GutenbergID: "1",
+			Title:       "T",
+			Authors:     []Author{{Name: "A"}},
+			Language:    "en",
+			Subjects:    []string{"S"},
+			Formats:     []Format{{FileURL: "https://example.org/1.txt", Type: "text/plain", FileSize: &size}},
+			Description: "D",
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.book.Completeness(); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Completeness() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompletenessStoredAtInsert(t *testing.T) {
+	db := newTestDB(t)
+	full := parseTestRDF(t, fixtureRDF(t, "1"))
+	sparse := &Book{GutenbergID: "2", Title: "Sparse", Language: "en"}
+	insertTestBooks(t, db, full, sparse)
+
+	tests := []struct {
+		id   string
+		want float64
+	}{
+		{"1", 1},
+		{"2", 2.0 / 6},
+	}
+	for _, tt := range tests {
+		var got float64
+		if err := db.conn.QueryRow("SELECT completeness FROM books WHERE gutenberg_id = ?", tt.id).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("book %s completeness = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+
+	stats := NewImportStats(2)
+	stats.RecordSuccess(full.Completeness())
+	stats.RecordSuccess(sparse.Completeness())
+	if got, want := stats.AverageCompleteness(), (1+2.0/6)/2; math.Abs(got-want) > 1e-9 {
+		t.Errorf("AverageCompleteness() = %v, want %v", got, want)
+	}
+}
+
+// authorID returns the row ID of the author with the given agent ID
+func authorID(t *testing.T, db *DB, agentID string) int64 {
+	t.Helper()
+	var id int64
+	if err := db.conn.QueryRow("SELECT id FROM authors WHERE agent_id = ?", agentID).Scan(&id); err != nil {
+		t.Fatalf("author %s: %v", agentID, err)
+	}
+	return id
+}
+
+func TestMergeAuthorsRelinksBooks(t *testing.T) {
+	db := newTestDB(t)
+	survivor := Author{Name: "Twain, Mark", LastName: "Twain", AgentID: "53"}
+	duplicate := Author{Name: "Clemens, Samuel", FirstName: "Samuel", LastName: "Clemens", AgentID: "54", Webpage: "https://en.wikipedia.org/wiki/Mark_Twain"}
+	insertTestBooks(t, db,
+		&Book{GutenbergID: "1", Title: "Survivor's", Authors: []Author{survivor}},
+		&Book{GutenbergID: "2", Title: "Duplicate's", Authors: []Author{duplicate}},
+		&Book{GutenbergID: "3", Title: "Both", Authors: []Author{survivor, duplicate}},
+		&Book{GutenbergID: "4", Title: "Edited", Contributors: []Contributor{{Role: "editor", Author: duplicate}}},
+	)
+	survivorID, duplicateID := authorID(t, db, "53"), authorID(t, db, "54")
+
+	if err := db.MergeAuthors(survivorID, duplicateID); err != nil {
+		t.Fatalf("MergeAuthors: %v", err)
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		book, err := db.GetBook(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(book.Authors) != 1 || book.Authors[0].AgentID != "53" {
+			t.Errorf("book %s authors = %+v, want only the survivor", id, book.Authors)
+		}
+	}
+	if n := queryInt(t, db, "SELECT COUNT(*) FROM book_contributors WHERE author_id = ?", survivorID); n != 1 {
+		t.Errorf("survivor has %d contributions, want 1", n)
+	}
+	if n := queryInt(t, db, "SELECT COUNT(*) FROM authors WHERE id = ?", duplicateID); n != 0 {
+		t.Error("duplicate author not deleted")
+	}
+	if n := queryInt(t, db, "SELECT COUNT(*) FROM book_authors ba LEFT JOIN authors a ON ba.author_id = a.id WHERE a.id IS NULL"); n != 0 {
+		t.Errorf("%d dangling book_authors links", n)
+	}
+
+	var firstName, webpage string
+	if err := db.conn.QueryRow("SELECT first_name, webpage FROM authors WHERE id = ?", survivorID).Scan(&firstName, &webpage); err != nil {
+		t.Fatal(err)
+	}
+	if firstName != "Samuel" || webpage != duplicate.Webpage {
+		t.Errorf("survivor fields = %q, %q; want them filled from the duplicate", firstName, webpage)
+	}
+}
+
+func TestMergeAuthorsErrors(t *testing.T) {
+	db := newTestDB(t)
+	insertTestBooks(t, db, &Book{GutenbergID: "1", Title: "T", Authors: []Author{{Name: "A", AgentID: "1"}}})
+	id := authorID(t, db, "1")
+
+	tests := []struct {
+		name       string
+		survivor   int64
+		duplicates []int64
+		wantErr    bool
+	}{
+		{"missing survivor", id + 100, []int64{id}, true},
+		{"survivor listed as its own duplicate", id, []int64{id}, false},
+		{"no duplicates", id, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.MergeAuthors(tt.survivor, tt.duplicates...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MergeAuthors error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n := queryInt(t, db, "SELECT COUNT(*) FROM book_authors WHERE author_id = ?", id); n != 1 {
+				t.Errorf("author has %d links after failed merge, want 1", n)
+			}
+		})
+	}
+}
+
+func TestEmptyAsNull(t *testing.T) {
+	book := func() *Book {
+		return &Book{
+			GutenbergID: "1",
+			Title:       "Title",
+			Description: "",
+			Summary:     "   ",
+			Rights:      "\t\n",
+			License:     "license",
+			Authors:     []Author{{Name: "Doe, Jane", FirstName: "", LastName: "Doe", Alias: " "}},
+		}
+	}
+	columns := []struct {
+		query string
+		empty bool // whether the value is empty or whitespace-only
+	}{
+		{"SELECT description FROM books", true},
+		{"SELECT summary FROM books", true},
+		{"SELECT rights FROM books", true},
+		{"SELECT license FROM books", false},
+		{"SELECT title FROM books", false},
+		{"SELECT first_name FROM authors", true},
+		{"SELECT alias FROM authors", true},
+		{"SELECT last_name FROM authors", false},
+	}
+
+	for _, enabled := range []bool{false, true} {
+		db := newTestDB(t)
+		db.SetEmptyAsNull(enabled)
+		insertTestBooks(t, db, book())
+		for _, column := range columns {
+			var value sql.NullString
+			if err := db.conn.QueryRow(column.query).Scan(&value); err != nil {
+				t.Fatalf("%s: %v", column.query, err)
+			}
+			if wantNull := enabled && column.empty; value.Valid == wantNull {
+				t.Errorf("emptyAsNull=%v: %s gave %+v, want NULL %v", enabled, column.query, value, wantNull)
+			}
+		}
+	}
+}
+
+func TestPublisherLinkedAndShared(t *testing.T) {
+	db := newTestDB(t)
+	docs := []struct {
+		id        string
+		publisher string
+	}{
+		{"1", "<dcterms:publisher>Project Gutenberg</dcterms:publisher>"},
+		{"2", "<dcterms:publisher>Project  Gutenberg\n</dcterms:publisher>"},
+		{"3", "<dcterms:publisher>Other Press</dcterms:publisher>"},
+		{"4", ""},
+	}
+	for _, doc := range docs {
+		insertTestBooks(t, db, parseTestRDF(t, rdfXML(ebookXML(doc.id, "T"+doc.id, doc.publisher))))
+	}
+
+	if n := queryInt(t, db, "SELECT COUNT(*) FROM publishers"); n != 2 {
+		t.Errorf("%d publishers, want 2", n)
+	}
+
+	tests := []struct {
+		id        string
+		publisher string // name in the publishers table, "" for no link
+		text      string // books.publisher, kept for compatibility
+	}{
+		{"1", "Project Gutenberg", "Project Gutenberg"},
+		{"2", "Project Gutenberg", "Project  Gutenberg"},
+		{"3", "Other Press", "Other Press"},
+		{"4", "", ""},
+	}
+	for _, tt := range tests {
+		var name, text sql.NullString
+		err := db.conn.QueryRow(`
+			SELECT p.name, b.publisher FROM books b
+			LEFT JOIN publishers p ON p.id = b.publisher_id
+			WHERE b.gutenberg_id = ?
+		`, tt.id).Scan(&name, &text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name.String != tt.publisher || text.String != tt.text {
+			t.Errorf("book %s publisher = %q (text %q), want %q (text %q)", tt.id, name.String, text.String, tt.publisher, tt.text)
+		}
+	}
+	if n := queryInt(t, db, "SELECT COUNT(DISTINCT publisher_id) FROM books WHERE gutenberg_id IN ('1', '2')"); n != 1 {
+		t.Errorf("books 1 and 2 link %d publishers, want 1 shared", n)
+	}
+}
+
+func TestFormatSizeChangeWarns(t *testing.T) {
+	const url = "https://www.gutenberg.org/ebooks/7.txt.utf-8"
+	size := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name         string
+		before       *int64
+		after        *int64
+		wantSize     sql.NullInt64
+		wantWarnings []string
+	}{
+		{"unchanged", size(100), size(100), sql.NullInt64{Int64: 100, Valid: true}, nil},
+		{"grown", size(100), size(250), sql.NullInt64{Int64: 250, Valid: true},
+			[]string{"7: file size of " + url + " changed from 100 to 250"}},
+		{"size first known", nil, size(80), sql.NullInt64{Int64: 80, Valid: true}, nil},
+		{"size no longer listed", size(100), nil, sql.NullInt64{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			var warnings []string
+			db.SetWarningHandler(func(gutenbergID, message string) {
+				warnings = append(warnings, gutenbergID+": "+message)
+			})
+			book := func(fileSize *int64) *Book {
+				return &Book{GutenbergID: "7", Title: "Seven", Formats: []Format{{Type: "text/plain; charset=utf-8", FileURL: url, FileSize: fileSize}}}
+			}
+			insertTestBooks(t, db, book(tt.before), book(tt.after))
+
+			if got := queryInt(t, db, "SELECT COUNT(*) FROM formats"); got != 1 {
+				t.Errorf("%d format rows, want 1", got)
+			}
+			var got sql.NullInt64
+			if err := db.conn.QueryRow("SELECT file_size FROM formats").Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.wantSize {
+				t.Errorf("file_size = %v, want %v", got, tt.wantSize)
+			}
+			if fmt.Sprint(warnings) != fmt.Sprint(tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestImportRecordsFormatSizeWarning(t *testing.T) {
+	format := func(size int) string {
+		return fmt.Sprintf(`<dcterms:hasFormat><pgterms:file rdf:about="https://www.gutenberg.org/ebooks/9.epub"><dcterms:extent>%d</dcterms:extent><dcterms:format><rdf:Description><rdf:value>application/epub+zip</rdf:value></rdf:Description></dcterms:format></pgterms:file></dcterms:hasFormat>`, size)
+	}
+	db := newTestDB(t)
+	importTestDocs(t, newTestImporter(db), map[string]string{"9": rdfXML(ebookXML("9", "Nine", format(1000)))})
+
+	importer := newTestImporter(db)
+	importTestDocs(t, importer, map[string]string{"9": rdfXML(ebookXML("9", "Nine", format(1500)))})
+
+	want := []string{"book 9: file size of https://www.gutenberg.org/ebooks/9.epub changed from 1000 to 1500"}
+	if got := importer.Stats().Warnings; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+	if got := queryInt(t, db, "SELECT file_size FROM formats"); got != 1500 {
+		t.Errorf("file_size = %d, want 1500", got)
+	}
+}
+
+func TestTaxonomyRunProvenance(t *testing.T) {
+	db := newTestDB(t)
+	insertTestBooks(t, db, &Book{GutenbergID: "1", Title: "Before Runs", Subjects: []string{"Untracked"}})
+
+	first, err := db.StartImportRun("first.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertTestBooks(t, db, &Book{GutenbergID: "2", Title: "Two", Subjects: []string{"History", "Untracked"}, Bookshelves: []string{"Classics"}})
+	if err := db.FinishImportRun("completed"); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := db.StartImportRun("second.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertTestBooks(t, db, &Book{GutenbergID: "3", Title: "Three", Subjects: []string{"History", "Poetry"}, Bookshelves: []string{"Classics", "Poetry"}})
+	if err := db.FinishImportRun("completed"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		table  string
+		column string
+		name   string
+		want   sql.NullInt64
+	}{
+		{"subjects", "subject", "Untracked", sql.NullInt64{}},
+		{"subjects", "subject", "History", sql.NullInt64{Int64: first, Valid: true}},
+		{"subjects", "subject", "Poetry", sql.NullInt64{Int64: second, Valid: true}},
+		{"bookshelves", "bookshelf", "Classics", sql.NullInt64{Int64: first, Valid: true}},
+		{"bookshelves", "bookshelf", "Poetry", sql.NullInt64{Int64: second, Valid: true}},
+	}
+	for _, tt := range tests {
+		var got sql.NullInt64
+		if err := db.conn.QueryRow("SELECT run_id FROM "+tt.table+" WHERE "+tt.column+" = ?", tt.name).Scan(&got); err != nil {
+			t.Fatalf("%s %q: %v", tt.table, tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s %q run_id = %v, want %v", tt.table, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuthorDedupeByAgentID(t *testing.T) {
+	year := func(y int) *int { return &y }
+	tests := []struct {
+		name        string
+		authors     []Author
+		wantAuthors int
+	}{
+		{"same agent, different casing", []Author{
+			{Name: "Twain, Mark", AgentID: "53"},
+			{Name: "TWAIN, MARK", AgentID: "53"},
+		}, 1},
+		{"same agent, different punctuation and dates", []Author{
+			{Name: "Twain, Mark", AgentID: "53", BirthYear: year(1835)},
+			{Name: "Twain, Mark.", AgentID: "53", BirthYear: year(1835), DeathYear: year(1910)},
+		}, 1},
+		{"agent given later", []Author{
+			{Name: "Twain, Mark", BirthYear: year(1835), DeathYear: year(1910)},
+			{Name: "Twain, Mark", AgentID: "53", BirthYear: year(1835), DeathYear: year(1910)},
+		}, 1},
+		{"no agent, same name and dates", []Author{
+			{Name: "Anonymous"},
+			{Name: "Anonymous"},
+		}, 1},
+		{"no agent, different dates", []Author{
+			{Name: "Smith, John", BirthYear: year(1580)},
+			{Name: "Smith, John", BirthYear: year(1901)},
+		}, 2},
+		{"different agents, different names", []Author{
+			{Name: "Twain, Mark", AgentID: "53"},
+			{Name: "Clemens, Samuel", AgentID: "54"},
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			for i, author := range tt.authors {
+				insertTestBooks(t, db, &Book{GutenbergID: fmt.Sprint(i + 1), Title: "Book", Authors: []Author{author}})
+			}
+			if got := queryInt(t, db, "SELECT COUNT(*) FROM authors"); got != tt.wantAuthors {
+				t.Errorf("%d author rows, want %d", got, tt.wantAuthors)
+			}
+			if got := queryInt(t, db, "SELECT COUNT(*) FROM book_authors"); got != len(tt.authors) {
+				t.Errorf("%d book links, want %d", got, len(tt.authors))
+			}
+		})
+	}
+}
+
+func TestDeleteBook(t *testing.T) {
+	agent := func(id, name string) string {
+		return `<dcterms:creator><pgterms:agent rdf:about="2009/agents/` + id + `"><pgterms:name>` + name + `</pgterms:name></pgterms:agent></dcterms:creator>`
+	}
+	bookshelf := func(name string) string {
+		return `<pgterms:bookshelf><rdf:Description><rdf:value>` + name + `</rdf:value></rdf:Description></pgterms:bookshelf>`
+	}
+	format := func(id string) string {
+		return `<dcterms:hasFormat><pgterms:file rdf:about="https://www.gutenberg.org/ebooks/` + id + `.epub.images"/></dcterms:hasFormat>`
+	}
+	publisher := func(name string) string {
+		return `<dcterms:publisher>` + name + `</dcterms:publisher>`
+	}
+	// Books 1 and 2 share an author, a subject, a bookshelf and a publisher;
+	// each also has one of its own. Book 3 has only a publisher of its own
+	docs := []string{
+		rdfXML(ebookXML("1", "First", agent("10", "Shared, Author")+agent("11", "Only, First")+subjectXML("Shared subject")+subjectXML("First subject")+bookshelf("Shared shelf")+bookshelf("First shelf")+publisher("Shared Press")+format("1"))),
+		rdfXML(ebookXML("2", "Second", agent("10", "Shared, Author")+subjectXML("Shared subject")+bookshelf("Shared shelf")+publisher("Shared Press")+format("2"))),
+		rdfXML(ebookXML("3", "Third", publisher("Third Press"))),
+	}
+
+	names := func(t *testing.T, db *DB, query string) string {
+		t.Helper()
+		values, err := db.queryStrings(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(values)
+	}
+
+	tests := []struct {
+		name            string
+		delete          []string
+		wantErr         error
+		wantBooks       string
+		wantAuthors     string
+		wantSubjects    string
+		wantBookshelves string
+		wantPublishers  string
+		wantFormats     int
+	}{
+		{"one of two books", []string{"1"}, nil, "[2 3]", "[Shared, Author]", "[Shared subject]", "[Shared shelf]", "[Shared Press Third Press]", 1},
+		{"both books", []string{"1", "2"}, nil, "[3]", "[]", "[]", "[]", "[Third Press]", 0},
+		{"own publisher", []string{"3"}, nil, "[1 2]", "[Only, First Shared, Author]", "[First subject Shared subject]", "[First shelf Shared shelf]", "[Shared Press]", 2},
+		{"not in catalog", []string{"4"}, ErrNotFound, "[1 2 3]", "[Only, First Shared, Author]", "[First subject Shared subject]", "[First shelf Shared shelf]", "[Shared Press Third Press]", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			for _, doc := range docs {
+				insertTestBooks(t, db, parseTestRDF(t, doc))
+			}
+
+			var err error
+			for _, id := range tt.delete {
+				if err = db.DeleteBook(id); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DeleteBook error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got := fmt.Sprint(bookIDs(t, db)); got != tt.wantBooks {
+				t.Errorf("books = %s, want %s", got, tt.wantBooks)
+			}
+			if got := names(t, db, "SELECT name FROM authors ORDER BY name"); got != tt.wantAuthors {
+				t.Errorf("authors = %s, want %s", got, tt.wantAuthors)
+			}
+			if got := names(t, db, "SELECT subject FROM subjects ORDER BY subject"); got != tt.wantSubjects {
+				t.Errorf("subjects = %s, want %s", got, tt.wantSubjects)
+			}
+			if got := names(t, db, "SELECT bookshelf FROM bookshelves ORDER BY bookshelf"); got != tt.wantBookshelves {
+				t.Errorf("bookshelves = %s, want %s", got, tt.wantBookshelves)
+			}
+			if got := names(t, db, "SELECT name FROM publishers ORDER BY name"); got != tt.wantPublishers {
+				t.Errorf("publishers = %s, want %s", got, tt.wantPublishers)
+			}
+			if got := queryInt(t, db, "SELECT COUNT(*) FROM formats"); got != tt.wantFormats {
+				t.Errorf("%d formats, want %d", got, tt.wantFormats)
+			}
+			// No link row may point at a deleted book or lookup row
+			for _, table := range []string{"book_authors", "book_subjects", "book_bookshelves", "formats"} {
+				if got := queryInt(t, db, "SELECT COUNT(*) FROM "+table+" WHERE book_id NOT IN (SELECT id FROM books)"); got != 0 {
+					t.Errorf("%d %s rows left for deleted books", got, table)
+				}
+			}
+			if got := queryInt(t, db, "SELECT COUNT(*) FROM book_authors WHERE author_id NOT IN (SELECT id FROM authors)"); got != 0 {
+				t.Errorf("%d book_authors rows point at deleted authors", got)
+			}
+		})
+	}
+}
+
+func TestBookUpdatedAt(t *testing.T) {
+	const before = "2000-01-01 00:00:00"
+	format := func(name string, size int) string {
+		return fmt.Sprintf(`<dcterms:hasFormat><pgterms:file rdf:about="https://www.gutenberg.org/ebooks/%s"><dcterms:extent>%d</dcterms:extent><dcterms:format><rdf:Description><rdf:value>application/epub+zip</rdf:value></rdf:Description></dcterms:format></pgterms:file></dcterms:hasFormat>`, name, size)
+	}
+	book := func(title, body string) string {
+		return rdfXML(ebookXML("1", title, subjectXML("Fiction")+body))
+	}
+	original := book("Original", format("1.epub", 100)+format("1.epub3", 200))
+	tests := []struct {
+		name        string
+		reimport    string
+		wantUpdated bool
+	}{
+		{"unchanged", original, false},
+		{"changed title", book("Revised", format("1.epub", 100)+format("1.epub3", 200)), true},
+		{"changed language", book("Original", languageXML("fr")+format("1.epub", 100)+format("1.epub3", 200)), true},
+		{"changed format size", book("Original", format("1.epub", 150)+format("1.epub3", 200)), true},
+		{"added format", book("Original", format("1.epub", 100)+format("1.epub3", 200)+format("1.mobi", 300)), true},
+		{"dropped format", book("Original", format("1.epub", 100)), true},
+		{"added subject", book("Original", subjectXML("Poetry")+format("1.epub", 100)+format("1.epub3", 200)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			insertTestBooks(t, db, parseTestRDF(t, original))
+
+			var created, updated string
+			timestamps := func() {
+				t.Helper()
+				if err := db.conn.QueryRow("SELECT CAST(created_at AS TEXT), CAST(updated_at AS TEXT) FROM books").Scan(&created, &updated); err != nil {
+					t.Fatal(err)
+				}
+			}
+			timestamps()
+			if created != updated {
+				t.Errorf("new book: created_at %q, updated_at %q, want them equal", created, updated)
+			}
+			if _, err := time.Parse(time.DateTime, created); err != nil {
+				t.Errorf("created_at %q isn't a UTC CURRENT_TIMESTAMP: %v", created, err)
+			}
+
+			// Age both timestamps so any change is visible within the second
+			if _, err := db.conn.Exec("UPDATE books SET created_at = ?, updated_at = ?", before, before); err != nil {
+				t.Fatal(err)
+			}
+			insertTestBooks(t, db, parseTestRDF(t, tt.reimport))
+			timestamps()
+			if created != before {
+				t.Errorf("created_at = %q after re-import, want it kept at %q", created, before)
+			}
+			if moved := updated != before; moved != tt.wantUpdated {
+				t.Errorf("updated_at = %q after re-import, want moved = %v", updated, tt.wantUpdated)
+			}
+			if tt.wantUpdated && updated <= created {
+				t.Errorf("updated_at %q doesn't sort after created_at %q", updated, created)
+			}
+		})
+	}
+}
+
+func TestBackfillBookTimestamps(t *testing.T) {
+	tests := []struct {
+		name        string
+		created     interface{}
+		updated     interface{}
+		wantCreated string
+		wantUpdated string
+	}{
+		{"bound Go time without updated_at", time.Date(2020, 1, 2, 3, 4, 5, 600, time.FixedZone("CEST", 2*60*60)), nil, "2020-01-02 01:04:05", "2020-01-02 01:04:05"},
+		{"bound Go time with updated_at", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), "2021-05-06 07:08:09", "2020-01-02 03:04:05", "2021-05-06 07:08:09"},
+		{"time.Now() with monotonic reading", "2020-01-02 03:04:05.123456789 -0500 EST m=+0.008344387", nil, "2020-01-02 08:04:05", "2020-01-02 08:04:05"},
+		{"CURRENT_TIMESTAMP without updated_at", "2019-12-31 23:59:59", nil, "2019-12-31 23:59:59", "2019-12-31 23:59:59"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pg.db")
+			db, err := NewDB(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			insertTestBooks(t, db, parseTestRDF(t, rdfXML(ebookXML("1", "One", ""))))
+			// Store the timestamps the way an older import left them
+			if _, err := db.conn.Exec("UPDATE books SET created_at = ?, updated_at = ?", tt.created, tt.updated); err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+
+			db, err = NewDB(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			var created, updated string
+			if err := db.conn.QueryRow("SELECT CAST(created_at AS TEXT), CAST(updated_at AS TEXT) FROM books").Scan(&created, &updated); err != nil {
+				t.Fatal(err)
+			}
+			if created != tt.wantCreated || updated != tt.wantUpdated {
+				t.Errorf("created_at, updated_at = %q, %q, want %q, %q", created, updated, tt.wantCreated, tt.wantUpdated)
+			}
+		})
+	}
+}
+
+func TestMemoryDB(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+	}{
+		{"memory", MemoryDSN},
+		{"memory URI", "file::memory:"},
+		{"mode=memory URI", "file:catalog.db?mode=memory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !isMemoryDSN(tt.dsn) {
+				t.Errorf("isMemoryDSN(%q) = false", tt.dsn)
+			}
+			fixture := parseTestRDF(t, fixtureRDF(t, "1"))
+			t.Chdir(t.TempDir())
+			db, err := NewDB(tt.dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			insertTestBooks(t, db, fixture)
+			book, err := db.GetBook("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if book.Title == "" || len(book.Authors) == 0 || len(book.Formats) == 0 {
+				t.Errorf("read back %+v, want the fixture's title, authors and formats", book)
+			}
+
+			// Migrations ran, and there is no file to journal
+			if got := queryInt(t, db, "PRAGMA user_version"); got != schemaVersion {
+				t.Errorf("user_version = %d, want %d", got, schemaVersion)
+			}
+			var journal string
+			if err := db.conn.QueryRow("PRAGMA journal_mode").Scan(&journal); err != nil {
+				t.Fatal(err)
+			}
+			if journal != "memory" {
+				t.Errorf("journal_mode = %q, want memory", journal)
+			}
+			if entries, err := os.ReadDir("."); err != nil || len(entries) != 0 {
+				t.Errorf("working directory holds %v (%v), want no files", entries, err)
+			}
+
+			// Each in-memory database is separate
+			other, err := NewDB(tt.dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer other.Close()
+			if got := queryInt(t, other, "SELECT COUNT(*) FROM books"); got != 0 {
+				t.Errorf("second database has %d books, want 0", got)
+			}
+		})
+	}
+
+	for _, dsn := range []string{"pg.db", "/tmp/memory.db", "file:pg.db"} {
+		if isMemoryDSN(dsn) {
+			t.Errorf("isMemoryDSN(%q) = true", dsn)
+		}
+	}
+}
+
+func TestFormatUpsertKeepsRows(t *testing.T) {
+	const (
+		epub = "https://www.gutenberg.org/ebooks/1.epub.images"
+		html = "https://www.gutenberg.org/ebooks/1.html.images"
+		text = "https://www.gutenberg.org/ebooks/1.txt.utf-8"
+	)
+	format := func(url, mimeType string, size int) string {
+		return fmt.Sprintf(`<dcterms:hasFormat><pgterms:file rdf:about="%s"><dcterms:extent>%d</dcterms:extent><dcterms:format><rdf:Description><rdf:value>%s</rdf:value></rdf:Description></dcterms:format></pgterms:file></dcterms:hasFormat>`, url, size, mimeType)
+	}
+	doc := func(formats ...string) string {
+		return rdfXML(ebookXML("1", "One", strings.Join(formats, "")))
+	}
+	original := doc(format(epub, "application/epub+zip", 100), format(html, "text/html", 200))
+
+	type row struct {
+		id       int64
+		typ      string
+		size     int64
+		external sql.NullString
+	}
+	tests := []struct {
+		name     string
+		reimport string
+		// want maps each file URL left to its type and size; a URL already
+		// stored with the same type must keep its ID and external note, one
+		// whose type changed must be a new row
+		want map[string]row
+	}{
+		{"unchanged", original, map[string]row{epub: {typ: "application/epub+zip", size: 100}, html: {typ: "text/html", size: 200}}},
+		{"size changed", doc(format(epub, "application/epub+zip", 150), format(html, "text/html", 200)), map[string]row{epub: {typ: "application/epub+zip", size: 150}, html: {typ: "text/html", size: 200}}},
+		{"type changed", doc(format(epub, "application/epub+zip", 100), format(html, "application/xhtml+xml", 200)), map[string]row{epub: {typ: "application/epub+zip", size: 100}, html: {typ: "application/xhtml+xml", size: 200}}},
+		{"format added", doc(format(epub, "application/epub+zip", 100), format(html, "text/html", 200), format(text, "text/plain", 50)), map[string]row{epub: {typ: "application/epub+zip", size: 100}, html: {typ: "text/html", size: 200}, text: {typ: "text/plain", size: 50}}},
+		{"format dropped", doc(format(epub, "application/epub+zip", 100)), map[string]row{epub: {typ: "application/epub+zip", size: 100}}},
+		{"no formats listed", doc(), map[string]row{epub: {typ: "application/epub+zip", size: 100}, html: {typ: "text/html", size: 200}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			// A column added outside the importer must survive re-imports
+			if _, err := db.conn.Exec("ALTER TABLE formats ADD COLUMN note TEXT"); err != nil {
+				t.Fatal(err)
+			}
+			rows := func() map[string]row {
+				t.Helper()
+				result, err := db.conn.Query("SELECT id, file_url, format_type, file_size, note FROM formats")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer result.Close()
+				got := make(map[string]row)
+				for result.Next() {
+					var r row
+					var url string
+					if err := result.Scan(&r.id, &url, &r.typ, &r.size, &r.external); err != nil {
+						t.Fatal(err)
+					}
+					got[url] = r
+				}
+				return got
+			}
+
+			insertTestBooks(t, db, parseTestRDF(t, original))
+			if _, err := db.conn.Exec("UPDATE formats SET note = 'checked ' || file_url"); err != nil {
+				t.Fatal(err)
+			}
+			before := rows()
+			// The same record twice must leave the rows as they were
+			insertTestBooks(t, db, parseTestRDF(t, tt.reimport))
+			insertTestBooks(t, db, parseTestRDF(t, tt.reimport))
+			after := rows()
+
+			if len(after) != len(tt.want) {
+				t.Errorf("%d format rows, want %d", len(after), len(tt.want))
+			}
+			for url, want := range tt.want {
+				got, ok := after[url]
+				if !ok {
+					t.Errorf("no row for %s", url)
+					continue
+				}
+				if got.typ != want.typ || got.size != want.size {
+					t.Errorf("%s: type %q size %d, want %q and %d", url, got.typ, got.size, want.typ, want.size)
+				}
+				old, ok := before[url]
+				switch {
+				case !ok:
+				case got.typ == old.typ && (got.id != old.id || got.external != old.external):
+					t.Errorf("%s: id %d note %v, want them kept as %d and %v", url, got.id, got.external, old.id, old.external)
+				case got.typ != old.typ && (got.id == old.id || got.external.Valid):
+					t.Errorf("%s: id %d note %v after its type changed, want a new row", url, got.id, got.external)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatKeyMigration(t *testing.T) {
+	const url = "https://www.gutenberg.org/ebooks/1.html.images"
+	path := filepath.Join(t.TempDir(), "pg.db")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertTestBooks(t, db, parseTestRDF(t, rdfXML(ebookXML("1", "One", ""))))
+	// Put back the (book_id, file_url) key older versions created
+	for _, stmt := range []string{
+		"DROP INDEX idx_formats_book_type_url",
+		"CREATE UNIQUE INDEX idx_formats_book_url ON formats(book_id, file_url)",
+		"INSERT INTO formats (book_id, format_type, file_url) SELECT id, 'text/html', '" + url + "' FROM books",
+	} {
+		if _, err := db.conn.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	indexes, err := db.queryStrings("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'formats' AND sql LIKE 'CREATE UNIQUE%' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(indexes); got != "[idx_formats_book_type_url]" {
+		t.Errorf("unique formats indexes = %s, want [idx_formats_book_type_url]", got)
+	}
+	// The same URL under another type is now a separate format
+	if _, err := db.conn.Exec("INSERT INTO formats (book_id, format_type, file_url) SELECT id, 'application/xhtml+xml', ? FROM books", url); err != nil {
+		t.Errorf("inserting the URL under a second type: %v", err)
+	}
+	if _, err := db.conn.Exec("INSERT INTO formats (book_id, format_type, file_url) SELECT id, 'text/html', ? FROM books", url); err == nil {
+		t.Error("inserting the same type and URL again succeeded, want a unique constraint error")
+	}
+}
+
+func TestReimportKeepsDownloadCount(t *testing.T) {
+	downloads := func(n int) string {
+		return fmt.Sprintf(`<pgterms:downloads rdf:datatype="http://www.w3.org/2001/XMLSchema#integer">%d</pgterms:downloads>`, n)
+	}
+	inserts := []struct {
+		name   string
+		insert func(db *DB, book *Book) error
+	}{
+		{"InsertBook", (*DB).InsertBook},
+		{"batch", func(db *DB, book *Book) error { return db.BatchInsertBooks([]*Book{book})[0] }},
+		{"two phase", func(db *DB, book *Book) error { return db.InsertBooksTwoPhase([]*Book{book})[0] }},
+	}
+	tests := []struct {
+		name     string
+		reimport string
+		want     int
+	}{
+		{"downloads missing", "", 500},
+		{"downloads zero", downloads(0), 500},
+		{"more downloads", downloads(800), 800},
+		{"fewer downloads", downloads(120), 120},
+	}
+	for _, insert := range inserts {
+		for _, tt := range tests {
+			t.Run(insert.name+"/"+tt.name, func(t *testing.T) {
+				db := newTestDB(t)
+				for _, doc := range []string{downloads(500), tt.reimport} {
+					if err := insert.insert(db, parseTestRDF(t, rdfXML(ebookXML("1", "One", doc)))); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if got := queryInt(t, db, "SELECT download_count FROM books WHERE gutenberg_id = '1'"); got != tt.want {
+					t.Errorf("download_count = %d, want %d", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestReimportIsIdempotent(t *testing.T) {
+	tables := []string{"books", "authors", "book_authors", "book_contributors", "subjects", "book_subjects", "book_languages", "bookshelves", "book_bookshelves", "formats", "publishers"}
+	snapshot := func(t *testing.T, db *DB) (map[string]int, *Book) {
+		t.Helper()
+		counts := make(map[string]int, len(tables))
+		for _, table := range tables {
+			counts[table] = queryInt(t, db, "SELECT COUNT(*) FROM "+table)
+		}
+		book, err := db.GetBook("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return counts, book
+	}
+	tests := []struct {
+		name           string
+		stripDownloads bool
+	}{
+		{"full record", false},
+		{"record without downloads", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixture := fixtureRDF(t, "1")
+			reimport := fixture
+			if tt.stripDownloads {
+				start := strings.Index(reimport, "<pgterms:downloads")
+				end := strings.Index(reimport, "</pgterms:downloads>") + len("</pgterms:downloads>")
+				reimport = reimport[:start] + reimport[end:]
+			}
+
+			db := newTestDB(t)
+			insertTestBooks(t, db, parseTestRDF(t, fixture))
+			wantCounts, wantBook := snapshot(t, db)
+			for i := 0; i < 2; i++ {
+				insertTestBooks(t, db, parseTestRDF(t, reimport))
+				counts, book := snapshot(t, db)
+				if !reflect.DeepEqual(counts, wantCounts) {
+					t.Errorf("re-import %d: row counts %v, want %v", i+1, counts, wantCounts)
+				}
+				if !reflect.DeepEqual(emptySlices(book), emptySlices(wantBook)) {
+					t.Errorf("re-import %d: book\n%+v\nwant\n%+v", i+1, book, wantBook)
+				}
+			}
+		})
+	}
+}
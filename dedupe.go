@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DuplicateCluster groups books that are likely the same work: they share a
+// normalized title and primary author but have different Gutenberg IDs
+type DuplicateCluster struct {
+	Title  string
+	Author string
+	Books  []DuplicateBook
+}
+
+// DuplicateBook is one member of a DuplicateCluster
+type DuplicateBook struct {
+	GutenbergID string
+	Title       string
+}
+
+// FindDuplicates groups books by normalized title and primary author (the
+// first author linked to the book) and returns every group with more than one
+// book, largest first. Nothing is merged or modified.
+func (db *DB) FindDuplicates() ([]DuplicateCluster, error) {
+	rows, err := db.conn.Query(`
+		SELECT b.gutenberg_id, b.title, (
+			SELECT a.name FROM book_authors ba
+			JOIN authors a ON a.id = ba.author_id
+			WHERE ba.book_id = b.id
+			ORDER BY a.id
+			LIMIT 1
+		)
+		FROM books b
+		ORDER BY b.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query books: %w", err)
+	}
+	defer rows.Close()
+
+	clusters := make(map[string]*DuplicateCluster)
+	for rows.Next() {
+		var gutenbergID string
+		var title, author sql.NullString
+		if err := rows.Scan(&gutenbergID, &title, &author); err != nil {
+			return nil, fmt.Errorf("failed to scan book: %w", err)
+		}
+
+		normalizedTitle := normalizeTitle(title.String)
+		if normalizedTitle == "" {
+			continue
+		}
+		key := normalizedTitle + "\x00" + normalizeForMatch(author.String)
+
+		cluster, ok := clusters[key]
+		if !ok {
+			cluster = &DuplicateCluster{Title: normalizedTitle, Author: author.String}
+			clusters[key] = cluster
+		}
+		cluster.Books = append(cluster.Books, DuplicateBook{GutenbergID: gutenbergID, Title: title.String})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var result []DuplicateCluster
+	for _, cluster := range clusters {
+		if len(cluster.Books) > 1 {
+			result = append(result, *cluster)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i].Books) != len(result[j].Books) {
+			return len(result[i].Books) > len(result[j].Books)
+		}
+		if result[i].Title != result[j].Title {
+			return result[i].Title < result[j].Title
+		}
+		return result[i].Author < result[j].Author
+	})
+	return result, nil
+}
+
+// normalizeTitle reduces a title to its main part for matching: the subtitle
+// after the first line break, colon or semicolon is dropped, a leading
+// English article is removed, and case and punctuation are ignored
+func normalizeTitle(title string) string {
+	if i := strings.IndexAny(title, "\n:;"); i >= 0 {
+		title = title[:i]
+	}
+	title = normalizeForMatch(title)
+	for _, article := range []string{"the ", "a ", "an "} {
+		if strings.HasPrefix(title, article) && len(title) > len(article) {
+			title = title[len(article):]
+			break
+		}
+	}
+	return title
+}
+
+// normalizeForMatch lowercases s, drops punctuation and collapses whitespace
+func normalizeForMatch(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// PrintDuplicateClusters writes each cluster of likely duplicates
+func PrintDuplicateClusters(w io.Writer, clusters []DuplicateCluster) {
+	for _, cluster := range clusters {
+		author := cluster.Author
+		if author == "" {
+			author = "(no author)"
+		}
+		fmt.Fprintf(w, "%q by %s (%d books)\n", cluster.Title, author, len(cluster.Books))
+		for _, book := range cluster.Books {
+			fmt.Fprintf(w, "  %-8s %s\n", book.GutenbergID, strings.ReplaceAll(book.Title, "\n", " "))
+		}
+	}
+	fmt.Fprintf(w, "\n%d clusters of likely duplicates\n", len(clusters))
+}
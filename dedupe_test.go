@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	twain := []Author{{Name: "Twain, Mark", AgentID: "53"}}
+	clemens := []Author{{Name: "Clemens, Samuel", AgentID: "54"}}
+	db := newTestDB(t)
+	insertTestBooks(t, db,
+		&Book{GutenbergID: "74", Title: "The Adventures of Tom Sawyer", Authors: twain},
+		&Book{GutenbergID: "7193", Title: "Adventures of Tom Sawyer: Illustrated", Authors: twain},
+		&Book{GutenbergID: "9007", Title: "THE ADVENTURES OF TOM SAWYER!", Authors: twain},
+		&Book{GutenbergID: "76", Title: "Adventures of Huckleberry Finn", Authors: twain},
+		&Book{GutenbergID: "80", Title: "Adventures of Huckleberry Finn", Authors: clemens},
+		&Book{GutenbergID: "100", Title: "Poems"},
+		&Book{GutenbergID: "101", Title: "Poems;\nfirst series"},
+	)
+
+	clusters, err := db.FindDuplicates()
+	if err != nil {
+		t.Fatalf("FindDuplicates: %v", err)
+	}
+	var got []string
+	for _, cluster := range clusters {
+		var ids []string
+		for _, book := range cluster.Books {
+			ids = append(ids, book.GutenbergID)
+		}
+		got = append(got, fmt.Sprintf("%s/%s: %s", cluster.Title, cluster.Author, strings.Join(ids, ",")))
+	}
+	want := []string{
+		"adventures of tom sawyer/Twain, Mark: 74,7193,9007",
+		"poems/: 100,101",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("clusters:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"The Adventures of Tom Sawyer", "adventures of tom sawyer"},
+		{"Pride and Prejudice: A Novel", "pride and prejudice"},
+		{"Leaves of Grass\nselected poems", "leaves of grass"},
+		{"A Tale of Two Cities", "tale of two cities"},
+		{"An  Essay -- on Man", "essay on man"},
+		{"The", "the"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeTitle(tt.title); got != tt.want {
+			t.Errorf("normalizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// CatalogArchiveURL is where Project Gutenberg publishes the RDF catalog archive
+const CatalogArchiveURL = "https://www.gutenberg.org/cache/epub/feeds/rdf-files.tar.zip"
+
+// DownloadOptions configures DownloadArchive
+type DownloadOptions struct {
+	// Retries is the number of additional attempts after the first failure
+	Retries int
+	// RetryDelay is the base delay between attempts; it grows linearly per attempt
+	RetryDelay time.Duration
+	// ChecksumURL optionally points at a file whose first field is the
+	// hex-encoded SHA-256 of the archive
+	ChecksumURL string
+	// Client is the HTTP client to use; http.DefaultClient when nil
+	Client *http.Client
+	// Validate, when set, checks the complete download before it replaces
+	// destPath; an error discards it
+	Validate func(path string) error
+}
+
+// DownloadArchive downloads url to destPath. The data is written to a
+// ".part" file first; failed attempts are retried and resumed from the partial
+// file with an HTTP Range request. The final file size is checked against the
+// server's reported length and, if ChecksumURL is set, its SHA-256.
+//
+// A partial file is only resumed while the server still serves the archive it
+// was started from: its ETag or Last-Modified is recorded beside it and sent
+// as If-Range. One left by an earlier call without such a validator is
+// discarded, since it may hold the head of an older archive.
+func DownloadArchive(url, destPath string, opts DownloadOptions) error {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 2 * time.Second
+	}
+
+	partPath := destPath + ".part"
+	if saved, ok := readPartValidators(partPath); !ok || saved.URL != url || saved.ifRange() == "" {
+		discardPart(partPath)
+	}
+
+	var err error
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 {
+			delay := time.Duration(attempt) * opts.RetryDelay
+			slog.Warn("download attempt failed", "url", url, "attempt", attempt, "retry_in", delay, "error", err)
+			time.Sleep(delay)
+		}
+		if err = downloadAttempt(client, url, partPath); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("download failed after %d attempts: %w", opts.Retries+1, err)
+	}
+
+	if opts.ChecksumURL != "" {
+		if err := verifyChecksum(client, opts.ChecksumURL, partPath); err != nil {
+			discardPart(partPath)
+			return err
+		}
+	}
+
+	if opts.Validate != nil {
+		if err := opts.Validate(partPath); err != nil {
+			discardPart(partPath)
+			return err
+		}
+	}
+
+	if err := os.Rename(partPath, destPath); err != nil {
+		return fmt.Errorf("failed to move download into place: %w", err)
+	}
+	os.Remove(partValidatorsPath(partPath))
+
+	return nil
+}
+
+// partValidatorsPath is the file holding the validators of the response a
+// partial download was started from
+func partValidatorsPath(partPath string) string {
+	return partPath + ".json"
+}
+
+// readPartValidators returns the validators recorded for a partial download,
+// and false if there are none
+func readPartValidators(partPath string) (archiveValidators, bool) {
+	var saved archiveValidators
+	data, err := os.ReadFile(partValidatorsPath(partPath))
+	if err != nil || json.Unmarshal(data, &saved) != nil {
+		return archiveValidators{}, false
+	}
+	return saved, true
+}
+
+// discardPart removes a partial download and its validators
+func discardPart(partPath string) {
+	os.Remove(partPath)
+	os.Remove(partValidatorsPath(partPath))
+}
+
+// ifRange returns the validator to send as If-Range: a strong ETag, or else
+// Last-Modified. Weak ETags can't be used for ranges.
+func (v archiveValidators) ifRange() string {
+	if v.ETag != "" && !strings.HasPrefix(v.ETag, "W/") {
+		return v.ETag
+	}
+	return v.LastModified
+}
+
+// changedIn reports whether resp carries a validator showing a different
+// archive from the one v was recorded for
+func (v archiveValidators) changedIn(resp *http.Response) bool {
+	if etag := resp.Header.Get("ETag"); v.ETag != "" && etag != "" {
+		return etag != v.ETag
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); v.LastModified != "" && lastModified != "" {
+		return lastModified != v.LastModified
+	}
+	return false
+}
+
+// downloadAttempt fetches url into partPath, resuming from its current size
+// if the server still serves the archive it was started from
+func downloadAttempt(client *http.Client, url, partPath string) error {
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+	saved, _ := readPartValidators(partPath)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator := saved.ifRange(); validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var total int64 = -1
+	flags := os.O_CREATE | os.O_WRONLY
+
+	// A server that ignores If-Range may answer a range of a newer archive;
+	// start over on the next attempt rather than splice the two
+	if resp.StatusCode != http.StatusOK && saved.changedIn(resp) {
+		discardPart(partPath)
+		return fmt.Errorf("archive changed since the partial download started")
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		total = contentRangeTotal(resp.Header.Get("Content-Range"))
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// Server ignored the range, the archive changed (If-Range), or this is
+		// the first attempt; start over and record what this response serves
+		offset = 0
+		total = resp.ContentLength
+		flags |= os.O_TRUNC
+		validators := archiveValidators{URL: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+		if data, err := json.Marshal(validators); err == nil {
+			if err := os.WriteFile(partValidatorsPath(partPath), data, 0644); err != nil {
+				slog.Warn("failed to save partial download validators", "path", partValidatorsPath(partPath), "error", err)
+			}
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file already holds everything the server has
+		if total := contentRangeTotal(resp.Header.Get("Content-Range")); total >= 0 && total != offset {
+			discardPart(partPath)
+			return fmt.Errorf("partial file is %d bytes but server reports %d", offset, total)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open partial file: %w", err)
+	}
+	defer out.Close()
+
+	bar := progressbar.DefaultBytesSilent(total, "Downloading archive")
+	if progressVisible() {
+		bar = progressbar.DefaultBytes(total, "Downloading archive")
+	}
+	if offset > 0 {
+		bar.Set64(offset)
+	}
+
+	written, err := io.Copy(io.MultiWriter(out, bar), resp.Body)
+	bar.Finish()
+	if err != nil {
+		return fmt.Errorf("download interrupted after %d bytes: %w", offset+written, err)
+	}
+
+	if total >= 0 && offset+written != total {
+		return fmt.Errorf("incomplete download: got %d of %d bytes", offset+written, total)
+	}
+
+	return nil
+}
+
+// contentRangeTotal returns the complete length from a Content-Range header
+// such as "bytes 100-199/200", or -1 when it is absent or unknown
+func contentRangeTotal(header string) int64 {
+	i := strings.LastIndex(header, "/")
+	if i < 0 {
+		return -1
+	}
+	total, err := strconv.ParseInt(header[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
+
+// verifyChecksum compares the SHA-256 of path with the one published at checksumURL
+func verifyChecksum(client *http.Client, checksumURL, path string) error {
+	resp, err := client.Get(checksumURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch checksum: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch checksum: unexpected HTTP status: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return fmt.Errorf("failed to read checksum: %w", err)
+	}
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 {
+		return fmt.Errorf("checksum file is empty")
+	}
+	expected := strings.ToLower(fields[0])
+
+	actual, err := HashFile(path)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
+	}
+
+	return nil
+}
+
+// archiveValidators are the HTTP cache validators of a fetched archive, kept
+// beside it so the next fetch can ask whether it changed
+type archiveValidators struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// validatorsPath is the file holding the validators of the archive at destPath
+func validatorsPath(destPath string) string {
+	return destPath + ".etag.json"
+}
+
+// FetchArchive downloads the archive at url to destPath when destPath is
+// missing, when force is set, or when the server reports that it changed
+// since the last fetch (by ETag or Last-Modified). It returns whether a new
+// archive was downloaded. The download must be a non-empty zip archive and
+// must not be served as HTML (an error page); otherwise it is discarded.
+func FetchArchive(url, destPath string, force bool, opts DownloadOptions) (bool, error) {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if !force {
+		if _, err := os.Stat(destPath); err == nil {
+			changed, err := archiveChanged(client, url, destPath)
+			if err != nil {
+				return false, err
+			}
+			if !changed {
+				return false, nil
+			}
+		}
+	}
+
+	head, err := headArchive(client, url, nil)
+	if err != nil {
+		return false, err
+	}
+	if contentType := head.Header.Get("Content-Type"); strings.HasPrefix(contentType, "text/html") {
+		return false, fmt.Errorf("server returned %s instead of an archive", contentType)
+	}
+
+	opts.Validate = validateZipArchive
+	if err := DownloadArchive(url, destPath, opts); err != nil {
+		return false, err
+	}
+
+	validators := archiveValidators{
+		URL:          url,
+		ETag:         head.Header.Get("ETag"),
+		LastModified: head.Header.Get("Last-Modified"),
+	}
+	if data, err := json.Marshal(validators); err == nil {
+		if err := os.WriteFile(validatorsPath(destPath), data, 0644); err != nil {
+			slog.Warn("failed to save archive validators", "path", validatorsPath(destPath), "error", err)
+		}
+	}
+	return true, nil
+}
+
+// archiveChanged asks the server whether the archive at url differs from the
+// copy at destPath, using the validators saved when it was fetched. Without
+// saved validators (e.g. a manually downloaded archive) the copy is kept.
+func archiveChanged(client *http.Client, url, destPath string) (bool, error) {
+	data, err := os.ReadFile(validatorsPath(destPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read archive validators: %w", err)
+	}
+	var saved archiveValidators
+	if err := json.Unmarshal(data, &saved); err != nil || saved.URL != url {
+		// Unreadable, or saved for another URL: treat the copy as stale
+		return true, nil
+	}
+	if saved.ETag == "" && saved.LastModified == "" {
+		return false, nil
+	}
+
+	headers := map[string]string{}
+	if saved.ETag != "" {
+		headers["If-None-Match"] = saved.ETag
+	}
+	if saved.LastModified != "" {
+		headers["If-Modified-Since"] = saved.LastModified
+	}
+	resp, err := headArchive(client, url, headers)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+
+	// Servers that ignore conditional HEAD requests still report the validators
+	if saved.ETag != "" && resp.Header.Get("ETag") != "" {
+		return resp.Header.Get("ETag") != saved.ETag, nil
+	}
+	if saved.LastModified != "" && resp.Header.Get("Last-Modified") != "" {
+		return resp.Header.Get("Last-Modified") != saved.LastModified, nil
+	}
+	return true, nil
+}
+
+// headArchive sends a HEAD request for url with the given extra headers,
+// accepting 200 and 304 responses
+func headArchive(client *http.Client, url string, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotModified {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// validateZipArchive checks that path is a non-empty file starting with a zip
+// signature, catching truncated downloads and HTML error pages
+func validateZipArchive(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open download: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return fmt.Errorf("download is empty or truncated")
+	}
+	if !bytes.Equal(header, []byte("PK\x03\x04")) {
+		return fmt.Errorf("download is not a zip archive")
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyServer serves payload, cutting the connection after half of it on the
+// first failures requests. It records the Range header of every request.
+type flakyServer struct {
+	payload     []byte
+	failures    int
+	ignoreRange bool
+	checksum    string
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/archive.sha256" {
+		fmt.Fprintf(w, "%s  archive.zip\n", s.checksum)
+		return
+	}
+
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	attempt := len(s.ranges)
+	s.mu.Unlock()
+
+	start := 0
+	if rng := r.Header.Get("Range"); rng != "" && !s.ignoreRange {
+		start, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(s.payload)-1, len(s.payload)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.payload)-start))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.payload)))
+		w.WriteHeader(http.StatusOK)
+	}
+
+	body := s.payload[start:]
+	if attempt <= s.failures {
+		w.Write(body[:len(body)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.Write(body)
+}
+
+func TestDownloadArchiveRetriesWithRange(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+	tests := []struct {
+		name        string
+		failures    int
+		retries     int
+		ignoreRange bool
+		checksum    string
+		wantErr     string
+		wantRange   bool // whether a retry asked for the rest with Range
+	}{
+		{name: "first attempt succeeds", retries: 2},
+		{name: "resumes with range", failures: 1, retries: 2, wantRange: true},
+		{name: "resumes twice", failures: 2, retries: 2, wantRange: true},
+		{name: "server ignores range", failures: 1, retries: 2, ignoreRange: true, wantRange: true},
+		{name: "retries exhausted", failures: 3, retries: 2, wantErr: "download failed after 3 attempts"},
+		{name: "checksum verified", failures: 1, retries: 1, checksum: HashBytes(payload), wantRange: true},
+		{name: "checksum mismatch", retries: 1, checksum: HashBytes([]byte("other")), wantErr: "checksum mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &flakyServer{payload: payload, failures: tt.failures, ignoreRange: tt.ignoreRange, checksum: tt.checksum}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			dest := filepath.Join(t.TempDir(), "archive.zip")
+			opts := DownloadOptions{Retries: tt.retries, RetryDelay: time.Millisecond}
+			if tt.checksum != "" {
+				opts.ChecksumURL = server.URL + "/archive.sha256"
+			}
+			err := DownloadArchive(server.URL+"/archive.zip", dest, opts)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("DownloadArchive error = %v, want %q", err, tt.wantErr)
+				}
+				if _, statErr := os.Stat(dest); statErr == nil {
+					t.Error("failed download left the destination file")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadArchive: %v", err)
+			}
+
+			got, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Errorf("downloaded %d bytes differing from the %d served", len(got), len(payload))
+			}
+			if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+				t.Error("partial file left behind")
+			}
+
+			if handler.ranges[0] != "" {
+				t.Errorf("first request sent Range %q", handler.ranges[0])
+			}
+			resumed := false
+			for _, rng := range handler.ranges[1:] {
+				if rng == "" {
+					t.Errorf("retry sent no Range header (requests: %q)", handler.ranges)
+				}
+				resumed = true
+			}
+			if resumed != tt.wantRange {
+				t.Errorf("retried with Range = %v, want %v (requests: %q)", resumed, tt.wantRange, handler.ranges)
+			}
+		})
+	}
+}
+
+func TestContentRangeTotal(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int64
+	}{
+		{"bytes 100-199/200", 200},
+		{"bytes */1234", 1234},
+		{"bytes 0-9/*", -1},
+		{"", -1},
+	}
+	for _, tt := range tests {
+		if got := contentRangeTotal(tt.header); got != tt.want {
+			t.Errorf("contentRangeTotal(%q) = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+}
+
+// versionedServer serves payload under etag, answering Range requests only
+// when If-Range matches etag unless ignoreIfRange is set. It records the
+// Range and If-Range headers of every request.
+type versionedServer struct {
+	payload       []byte
+	etag          string
+	ignoreIfRange bool
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (s *versionedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Header.Get("Range")+"|"+r.Header.Get("If-Range"))
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", s.etag)
+	rng := r.Header.Get("Range")
+	if rng == "" || (!s.ignoreIfRange && r.Header.Get("If-Range") != s.etag) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.payload)))
+		w.Write(s.payload)
+		return
+	}
+	start, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+	if start >= len(s.payload) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(s.payload)))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(s.payload)-1, len(s.payload)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(s.payload)-start))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(s.payload[start:])
+}
+
+func TestDownloadArchiveLeftoverPart(t *testing.T) {
+	current := bytes.Repeat([]byte("new archive "), 1000)
+	older := bytes.Repeat([]byte("OLD ARCHIVE "), 1000)
+	validators := func(etag string) string {
+		return fmt.Sprintf(`{"url":"URL","etag":%q}`, etag)
+	}
+
+	tests := []struct {
+		name          string
+		part          []byte
+		validators    string // recorded beside the .part; "" for none
+		ignoreIfRange bool
+		wantRequests  []string
+	}{
+		{"same archive resumes", current[:5000], validators(`"v2"`), false, []string{`bytes=5000-|"v2"`}},
+		{"changed archive restarts", older[:5000], validators(`"v1"`), false, []string{`bytes=5000-|"v1"`}},
+		{"no validators restarts", older[:5000], "", false, []string{"|"}},
+		{"validators for another URL restart", older[:5000], `{"url":"http://elsewhere/archive.zip","etag":"\"v2\""}`, false, []string{"|"}},
+		{"weak ETag can't be resumed", older[:5000], validators(`W/"v2"`), false, []string{"|"}},
+		{"server ignoring If-Range", older[:5000], validators(`"v1"`), true, []string{`bytes=5000-|"v1"`, "|"}},
+		{"complete part of a changed archive", older, validators(`"v1"`), true, []string{fmt.Sprintf(`bytes=%d-|"v1"`, len(older)), "|"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &versionedServer{payload: current, etag: `"v2"`, ignoreIfRange: tt.ignoreIfRange}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			url := server.URL + "/archive.zip"
+
+			dest := filepath.Join(t.TempDir(), "archive.zip")
+			if err := os.WriteFile(dest+".part", tt.part, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.validators != "" {
+				if err := os.WriteFile(dest+".part.json", []byte(strings.Replace(tt.validators, "URL", url, 1)), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := DownloadArchive(url, dest, DownloadOptions{Retries: 1, RetryDelay: time.Millisecond}); err != nil {
+				t.Fatalf("DownloadArchive: %v", err)
+			}
+			got, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, current) {
+				t.Errorf("downloaded %d bytes that aren't the current archive (starts %q)", len(got), got[:12])
+			}
+			if fmt.Sprint(handler.requests) != fmt.Sprint(tt.wantRequests) {
+				t.Errorf("requests (Range|If-Range) = %q, want %q", handler.requests, tt.wantRequests)
+			}
+			for _, leftover := range []string{dest + ".part", dest + ".part.json"} {
+				if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+					t.Errorf("%s left behind", filepath.Base(leftover))
+				}
+			}
+		})
+	}
+}
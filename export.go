@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ExportFilter restricts which books are exported; zero values match every book
+type ExportFilter struct {
+	// Language matches books with this language code among their languages
+	Language string
+	// Subject matches books with a subject containing this text
+	Subject string
+	// Author matches books with an author whose name contains this text
+	Author string
+	// Rights matches books whose normalized rights status is this, e.g.
+	// RightsPublicDomainUS
+	Rights string
+}
+
+// where returns the SQL condition and arguments selecting the filtered books
+func (f ExportFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if f.Language != "" {
+		conditions = append(conditions, `id IN (SELECT book_id FROM book_languages WHERE language_code = ?)`)
+		args = append(args, f.Language)
+	}
+	if f.Subject != "" {
+		conditions = append(conditions, `id IN (
+			SELECT bs.book_id FROM book_subjects bs
+			JOIN subjects s ON s.id = bs.subject_id
+			WHERE s.subject LIKE '%' || ? || '%'
+		)`)
+		args = append(args, f.Subject)
+	}
+	if f.Author != "" {
+		conditions = append(conditions, `id IN (
+			SELECT ba.book_id FROM book_authors ba
+			JOIN authors a ON a.id = ba.author_id
+			WHERE a.name LIKE '%' || ? || '%'
+		)`)
+		args = append(args, f.Author)
+	}
+	if f.Rights != "" {
+		conditions = append(conditions, `rights_status = ?`)
+		args = append(args, f.Rights)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// exportedBook is the JSON form of a book written by ExportJSON
+type exportedBook struct {
+	GutenbergID      string           `json:"gutenberg_id"`
+	Title            string           `json:"title"`
+	Type             string           `json:"type,omitempty"`
+	Language         string           `json:"language,omitempty"`
+	Languages        []string         `json:"languages"`
+	Publisher        string           `json:"publisher,omitempty"`
+	License          string           `json:"license,omitempty"`
+	Rights           string           `json:"rights,omitempty"`
+	RightsStatus     string           `json:"rights_status"`
+	IssuedDate       string           `json:"issued_date,omitempty"`
+	ModifiedDate     string           `json:"modified_date,omitempty"`
+	CoverURL         string           `json:"cover_url,omitempty"`
+	DownloadCount    int              `json:"download_count"`
+	Description      string           `json:"description,omitempty"`
+	Summary          string           `json:"summary,omitempty"`
+	ProductionNotes  string           `json:"production_notes,omitempty"`
+	ReadingEaseScore string           `json:"reading_ease_score,omitempty"`
+	Authors          []exportedAuthor `json:"authors"`
+	Contributors     []exportedAuthor `json:"contributors"`
+	Subjects         []string         `json:"subjects"`
+	Classifications  []string         `json:"classifications"`
+	Bookshelves      []string         `json:"bookshelves"`
+	Formats          []exportedFormat `json:"formats"`
+}
+
+// exportedAuthor is the JSON form of an author or contributor
+type exportedAuthor struct {
+	Name              string `json:"name"`
+	Role              string `json:"role,omitempty"`
+	AgentID           string `json:"agent_id,omitempty"`
+	BirthYear         *int   `json:"birth_year,omitempty"`
+	DeathYear         *int   `json:"death_year,omitempty"`
+	YearIsApproximate bool   `json:"year_is_approximate,omitempty"`
+	Alias             string `json:"alias,omitempty"`
+	Webpage           string `json:"webpage,omitempty"`
+}
+
+// exportedFormat is the JSON form of a format
+type exportedFormat struct {
+	Type     string `json:"type"`
+	URL      string `json:"url"`
+	Size     *int64 `json:"size,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+	Modified string `json:"modified,omitempty"`
+}
+
+// newExportedBook converts a book with its relations loaded
+func newExportedBook(book *Book) exportedBook {
+	out := exportedBook{
+		GutenbergID:      book.GutenbergID,
+		Title:            book.Title,
+		Type:             book.Type,
+		Language:         book.Language,
+		Languages:        book.Languages,
+		Publisher:        book.Publisher,
+		License:          book.License,
+		Rights:           book.Rights,
+		RightsStatus:     normalizeRights(book.Rights),
+		IssuedDate:       book.IssuedDate,
+		ModifiedDate:     book.Modified,
+		CoverURL:         book.CoverURL,
+		DownloadCount:    book.DownloadCount,
+		Description:      book.Description,
+		Summary:          book.Summary,
+		ProductionNotes:  book.ProductionNotes,
+		ReadingEaseScore: book.ReadingEaseScore,
+		Authors:          []exportedAuthor{},
+		Contributors:     []exportedAuthor{},
+		Subjects:         book.Subjects,
+		Classifications:  book.Classifications,
+		Bookshelves:      book.Bookshelves,
+		Formats:          []exportedFormat{},
+	}
+	for _, author := range book.Authors {
+		out.Authors = append(out.Authors, newExportedAuthor(author, ""))
+	}
+	for _, contributor := range book.Contributors {
+		out.Contributors = append(out.Contributors, newExportedAuthor(contributor.Author, contributor.Role))
+	}
+	for _, format := range book.Formats {
+		out.Formats = append(out.Formats, exportedFormat{
+			Type:     format.Type,
+			URL:      format.FileURL,
+			Size:     format.FileSize,
+			Checksum: format.Checksum,
+			Modified: format.Modified,
+		})
+	}
+	return out
+}
+
+// newExportedAuthor converts an author, with role set for contributors
+func newExportedAuthor(author Author, role string) exportedAuthor {
+	return exportedAuthor{
+		Name:              author.Name,
+		Role:              role,
+		AgentID:           author.AgentID,
+		BirthYear:         author.BirthYear,
+		DeathYear:         author.DeathYear,
+		YearIsApproximate: author.YearIsApproximate,
+		Alias:             author.Alias,
+		Webpage:           author.Webpage,
+	}
+}
+
+// ExportJSON writes every book matching filter as newline-delimited JSON, one
+// object per book with its authors, contributors, subjects, bookshelves and
+// formats. Books are encoded a page at a time, so memory use doesn't grow
+// with the catalog.
+func (db *DB) ExportJSON(w io.Writer, filter ExportFilter) error {
+	encoder := json.NewEncoder(w)
+	// Descriptions often hold markup; keep it readable rather than \u003c-escaped
+	encoder.SetEscapeHTML(false)
+	return db.eachBook(filter, func(book *Book) error {
+		return encoder.Encode(newExportedBook(book))
+	})
+}
+
+// csvHeader lists the columns written by ExportCSV
+var csvHeader = []string{"gutenberg_id", "title", "primary_author", "authors", "language", "download_count", "issued_date", "subject_count"}
+
+// csvListSeparator joins multiple values within one CSV field
+const csvListSeparator = "; "
+
+// ExportCSV writes every book matching filter as one CSV row with a header
+// row: its ID, title, primary (first) author, all authors joined by "; ",
+// language, download count, issue date and number of subjects. Rows are
+// written a page of books at a time.
+func (db *DB) ExportCSV(w io.Writer, filter ExportFilter) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	err := db.eachBook(filter, func(book *Book) error {
+		var primaryAuthor string
+		authors := make([]string, len(book.Authors))
+		for i, author := range book.Authors {
+			authors[i] = author.Name
+		}
+		if len(authors) > 0 {
+			primaryAuthor = authors[0]
+		}
+		return writer.Write([]string{
+			book.GutenbergID,
+			book.Title,
+			primaryAuthor,
+			strings.Join(authors, csvListSeparator),
+			book.Language,
+			strconv.Itoa(book.DownloadCount),
+			book.IssuedDate,
+			strconv.Itoa(len(book.Subjects)),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportPageSize is the number of book rows eachBook reads per query
+const exportPageSize = 500
+
+// eachBook calls fn with every book matching filter, in row order, with its
+// relations loaded. Books are read a page at a time and each page's cursor is
+// closed before relations are loaded, so the export also works on a database
+// limited to one connection, like those opened by NewDB.
+func (db *DB) eachBook(filter ExportFilter, fn func(*Book) error) error {
+	where, args := filter.where()
+	if where == "" {
+		where = "WHERE id > ?"
+	} else {
+		where += " AND id > ?"
+	}
+	query := db.rebind(`SELECT ` + bookColumns + ` FROM books ` + where + ` ORDER BY id LIMIT ?`)
+
+	var lastID int64
+	for {
+		books, ids, err := db.exportPage(query, append(args, lastID, exportPageSize)...)
+		if err != nil {
+			return err
+		}
+		if len(books) == 0 {
+			return nil
+		}
+		lastID = ids[len(ids)-1]
+
+		for i, book := range books {
+			if err := db.loadBookRelationsByID(book, ids[i]); err != nil {
+				return fmt.Errorf("failed to load book %s: %w", book.GutenbergID, err)
+			}
+			if err := fn(book); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// exportPage runs one page query of eachBook and returns the books with their
+// row IDs, closing the cursor before returning
+func (db *DB) exportPage(query string, args ...interface{}) ([]*Book, []int64, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query books: %w", err)
+	}
+	defer rows.Close()
+
+	var books []*Book
+	var ids []int64
+	for rows.Next() {
+		book, bookID, err := scanBook(rows)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan book: %w", err)
+		}
+		books = append(books, book)
+		ids = append(ids, bookID)
+	}
+	return books, ids, rows.Err()
+}
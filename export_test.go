@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withTimeout runs fn and fails the test if it doesn't return in time, so a
+// deadlocked export fails instead of hanging the test binary
+func withTimeout(t *testing.T, fn func() error) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out; the export is deadlocked")
+		return nil
+	}
+}
+
+// exportTestDB returns a single-connection catalog holding the fixture
+// record as books 1 and 2, and book 3 in French with no relations
+func exportTestDB(t *testing.T) *DB {
+	t.Helper()
+	db := newTestDB(t)
+	insertTestBooks(t, db,
+		parseTestRDF(t, fixtureRDF(t, "1")),
+		parseTestRDF(t, fixtureRDF(t, "2")),
+		parseTestRDF(t, rdfXML(ebookXML("3", "Trois", languageXML("fr")))),
+	)
+	return db
+}
+
+func TestExportJSON(t *testing.T) {
+	db := exportTestDB(t)
+	tests := []struct {
+		name    string
+		filter  ExportFilter
+		wantIDs []string
+	}{
+		{"everything", ExportFilter{}, []string{"1", "2", "3"}},
+		{"language", ExportFilter{Language: "fr"}, []string{"3"}},
+		{"author", ExportFilter{Author: "Jefferson"}, []string{"1", "2"}},
+		{"subject", ExportFilter{Subject: "Revolution"}, []string{"1", "2"}},
+		{"no match", ExportFilter{Language: "de"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := withTimeout(t, func() error { return db.ExportJSON(&out, tt.filter) }); err != nil {
+				t.Fatalf("ExportJSON: %v", err)
+			}
+
+			var ids []string
+			decoder := json.NewDecoder(&out)
+			for decoder.More() {
+				var book exportedBook
+				if err := decoder.Decode(&book); err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, book.GutenbergID)
+				if book.GutenbergID == "1" {
+					if len(book.Authors) != 1 || book.Authors[0].Name != "Jefferson, Thomas" || len(book.Contributors) != 1 || book.Contributors[0].Role != "translator" {
+						t.Errorf("book 1 authors %+v, contributors %+v", book.Authors, book.Contributors)
+					}
+					if len(book.Subjects) != 1 || len(book.Bookshelves) != 1 || len(book.Formats) != 3 {
+						t.Errorf("book 1 has %d subjects, %d bookshelves and %d formats, want 1, 1 and 3", len(book.Subjects), len(book.Bookshelves), len(book.Formats))
+					}
+				}
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("exported %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestExportJSONPages(t *testing.T) {
+	db := newTestDB(t)
+	books := make([]*Book, exportPageSize*2+1)
+	for i := range books {
+		id := fmt.Sprint(i + 1)
+		books[i] = &Book{GutenbergID: id, Title: "Book " + id, Authors: []Author{{Name: "Author " + id}}}
+	}
+	for _, err := range db.BatchInsertBooks(books) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := withTimeout(t, func() error { return db.ExportJSON(&out, ExportFilter{}) }); err != nil {
+		t.Fatalf("ExportJSON: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(books) {
+		t.Fatalf("exported %d books, want %d", len(lines), len(books))
+	}
+	for i, line := range lines {
+		var book exportedBook
+		if err := json.Unmarshal([]byte(line), &book); err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprint(i + 1); book.GutenbergID != want || len(book.Authors) != 1 || book.Authors[0].Name != "Author "+want {
+			t.Fatalf("line %d is book %s by %v, want book %s by Author %s", i+1, book.GutenbergID, book.Authors, want, want)
+		}
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	db := exportTestDB(t)
+	const header = "gutenberg_id,title,primary_author,authors,language,download_count,issued_date,subject_count\n"
+	tests := []struct {
+		name   string
+		filter ExportFilter
+		want   string
+	}{
+		{"everything", ExportFilter{}, header +
+			"1,Book One,\"Jefferson, Thomas\",\"Jefferson, Thomas\",en,1234,1971-12-01,1\n" +
+			"2,Book One,\"Jefferson, Thomas\",\"Jefferson, Thomas\",en,1234,1971-12-01,1\n" +
+			"3,Trois,,,fr,0,,0\n"},
+		{"language", ExportFilter{Language: "fr"}, header + "3,Trois,,,fr,0,,0\n"},
+		{"no match", ExportFilter{Author: "Nobody"}, header},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := withTimeout(t, func() error { return db.ExportCSV(&out, tt.filter) }); err != nil {
+				t.Fatalf("ExportCSV: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestExportCSVMultipleAuthors(t *testing.T) {
+	db := newTestDB(t)
+	insertTestBooks(t, db, &Book{GutenbergID: "3178", Title: "The Gilded Age", Authors: []Author{{Name: "Twain, Mark"}, {Name: "Warner, Charles Dudley"}}, Subjects: []string{"Satire", "Politics"}})
+
+	var out bytes.Buffer
+	if err := withTimeout(t, func() error { return db.ExportCSV(&out, ExportFilter{}) }); err != nil {
+		t.Fatalf("ExportCSV: %v", err)
+	}
+	want := "3178,The Gilded Age,\"Twain, Mark\",\"Twain, Mark; Warner, Charles Dudley\",,0,,2\n"
+	if lines := strings.SplitAfter(out.String(), "\n"); len(lines) < 2 || lines[1] != want {
+		t.Errorf("output:\n%s\nwant row:\n%s", out.String(), want)
+	}
+}
@@ -3,43 +3,77 @@ package main
 import (
 	"archive/tar"
 	"archive/zip"
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
 )
 
+// ErrNoRDFFiles is returned when an archive was read successfully but contains no RDF files
+var ErrNoRDFFiles = errors.New("no RDF files found in archive")
+
 // ExtractRDFFiles extracts RDF files from the zip archive (which contains a tar file)
-// Files are extracted to a permanent directory and will be reused on subsequent runs.
+// Files are extracted to extractDir, or to "<zip name>-extracted" in the working
+// directory when extractDir is empty, and are reused on subsequent runs.
+// A finished extraction is recorded in a marker file; without one (e.g. after
+// an interrupted run) or when the archive changed, the tar is read again and
+// only entries missing on disk, or of the wrong size, are written. With
+// reextract, previously extracted files are deleted and everything is
+// extracted again.
+// If zipPath is a directory, such as an unpacked Gutenberg cache, it is walked
+// for RDF files directly and nothing is extracted.
 // Returns a list of paths to extracted RDF files and a no-op cleanup function.
-func ExtractRDFFiles(zipPath string) ([]string, func(), error) {
-	// Create a permanent directory name based on the zip file name
-	zipBaseName := filepath.Base(zipPath)
-	zipNameWithoutExt := strings.TrimSuffix(zipBaseName, filepath.Ext(zipBaseName))
-	extractDir := zipNameWithoutExt + "-extracted"
-
-	// Check if files are already extracted
-	if entries, err := os.ReadDir(extractDir); err == nil && len(entries) > 0 {
-		// Directory exists and has files, return existing files
-		var rdfFiles []string
-		err := filepath.Walk(extractDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if info != nil && !info.IsDir() && strings.HasSuffix(path, ".rdf") {
-				rdfFiles = append(rdfFiles, path)
-			}
-			return nil
-		})
+// If the archive holds no RDF files, ErrNoRDFFiles is returned.
+func ExtractRDFFiles(zipPath, extractDir string, reextract bool) ([]string, func(), error) {
+	if info, err := os.Stat(zipPath); err == nil && info.IsDir() {
+		rdfFiles, err := findRDFFiles(zipPath)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to read existing extracted files: %w", err)
+			return nil, nil, fmt.Errorf("failed to read RDF directory: %w", err)
 		}
-		if len(rdfFiles) > 0 {
-			// Return existing files with a no-op cleanup function
-			return rdfFiles, func() {}, nil
+		if len(rdfFiles) == 0 {
+			return nil, nil, ErrNoRDFFiles
+		}
+		return rdfFiles, func() {}, nil
+	}
+
+	if extractDir == "" {
+		extractDir = defaultExtractDir(zipPath)
+	}
+
+	archive, err := os.Stat(zipPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open zip file: %w", err)
+	}
+	marker := extractionMarker{Size: archive.Size(), ModTime: archive.ModTime().UTC()}
+
+	// A marker from another archive means the files on disk may differ from
+	// its entries even where sizes match, so every entry is rewritten as with
+	// reextract. Without a marker they're from an interrupted extraction of
+	// this archive and are kept.
+	if previous, ok := readExtractionMarker(extractDir); ok && !reextract && !previous.sameArchive(marker) {
+		slog.Info("archive changed since the last extraction, extracting again", "dir", extractDir)
+		reextract = true
+	}
+
+	if reextract {
+		if err := removeExtracted(extractDir); err != nil {
+			return nil, nil, err
 		}
+	} else if rdfFiles, ok := completeExtraction(extractDir, marker); ok {
+		// Return existing files with a no-op cleanup function
+		return rdfFiles, func() {}, nil
 	}
 
 	// Create extraction directory if it doesn't exist
@@ -50,62 +84,311 @@ func ExtractRDFFiles(zipPath string) ([]string, func(), error) {
 	// No-op cleanup function since we want to keep the files
 	cleanup := func() {}
 
+	tarStream, closeArchive, err := openArchiveTar(zipPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeArchive()
+
+	rdfFiles, written, err := extractTar(tarStream, extractDir, !reextract)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to extract tar: %w", err)
+	}
+
+	if len(rdfFiles) == 0 {
+		return nil, nil, ErrNoRDFFiles
+	}
+	if reused := len(rdfFiles) - written; reused > 0 {
+		slog.Info("completed an earlier extraction", "dir", extractDir, "reused", reused, "extracted", written)
+	}
+
+	marker.Files = len(rdfFiles)
+	if err := marker.save(extractDir); err != nil {
+		slog.Warn("failed to record finished extraction", "dir", extractDir, "error", err)
+	}
+
+	return rdfFiles, cleanup, nil
+}
+
+// extractionMarkerName is the file ExtractRDFFiles writes in the extraction
+// directory once every RDF file of the archive is on disk
+const extractionMarkerName = ".extraction-complete.json"
+
+// extractionMarker identifies the archive an extraction directory was
+// completed from, and how many RDF files it holds
+type extractionMarker struct {
+	Size    int64     `json:"archive_size"`
+	ModTime time.Time `json:"archive_modified"`
+	Files   int       `json:"rdf_files"`
+}
+
+// save writes the marker into dir
+func (m extractionMarker) save(dir string) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, extractionMarkerName), data, 0644)
+}
+
+// sameArchive reports whether m and other describe the same archive
+func (m extractionMarker) sameArchive(other extractionMarker) bool {
+	return m.Size == other.Size && m.ModTime.Equal(other.ModTime)
+}
+
+// readExtractionMarker returns the marker in dir, if there is a readable one
+func readExtractionMarker(dir string) (extractionMarker, bool) {
+	var m extractionMarker
+	data, err := os.ReadFile(filepath.Join(dir, extractionMarkerName))
+	if err != nil {
+		return m, false
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, false
+	}
+	return m, true
+}
+
+// completeExtraction returns the RDF files in dir if a marker shows they were
+// completely extracted from the archive described by want, and none have
+// since gone missing
+func completeExtraction(dir string, want extractionMarker) ([]string, bool) {
+	got, ok := readExtractionMarker(dir)
+	if !ok || !got.sameArchive(want) {
+		return nil, false
+	}
+
+	rdfFiles, err := findRDFFiles(dir)
+	if err != nil || len(rdfFiles) < got.Files || len(rdfFiles) == 0 {
+		return nil, false
+	}
+	return rdfFiles, true
+}
+
+// removeExtracted deletes the RDF files and marker left in dir by an earlier
+// extraction. Other files are kept, since dir may be user supplied.
+func removeExtracted(dir string) error {
+	if err := os.Remove(filepath.Join(dir, extractionMarkerName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove extraction marker: %w", err)
+	}
+	rdfFiles, err := findRDFFiles(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read existing extracted files: %w", err)
+	}
+	for _, file := range rdfFiles {
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("failed to remove extracted file: %w", err)
+		}
+	}
+	return nil
+}
+
+// defaultExtractDir is the permanent directory, named after the zip file, that
+// ExtractRDFFiles uses when no directory is given
+func defaultExtractDir(zipPath string) string {
+	zipBaseName := filepath.Base(zipPath)
+	zipNameWithoutExt := strings.TrimSuffix(zipBaseName, filepath.Ext(zipBaseName))
+	return zipNameWithoutExt + "-extracted"
+}
+
+// findRDFFiles walks dir and returns the paths of all .rdf files under it
+func findRDFFiles(dir string) ([]string, error) {
+	var rdfFiles []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info != nil && !info.IsDir() && strings.HasSuffix(path, ".rdf") {
+			rdfFiles = append(rdfFiles, path)
+		}
+		return nil
+	})
+	return rdfFiles, err
+}
+
+// tarCompression maps tar file name suffixes to their compression
+var tarCompression = []struct {
+	suffix      string
+	compression string
+}{
+	{".tar", ""},
+	{".tar.gz", "gzip"},
+	{".tgz", "gzip"},
+	{".tar.bz2", "bzip2"},
+	{".tbz2", "bzip2"},
+	{".tar.xz", "xz"},
+	{".txz", "xz"},
+}
+
+// isTarName reports whether a zip entry looks like a tar file, compressed or not
+func isTarName(name string) bool {
+	base := strings.ToLower(filepath.Base(name))
+	for _, tc := range tarCompression {
+		if strings.HasSuffix(base, tc.suffix) {
+			return true
+		}
+	}
+	// Compressed with something unsupported, e.g. .tar.zst; reported by decompressTar
+	return strings.Contains(base, ".tar.")
+}
+
+// decompressTar wraps reader in the decompressor matching the tar file's
+// suffix. Unknown compression is an error rather than being read as raw tar.
+func decompressTar(name string, reader io.Reader) (io.Reader, func(), error) {
+	base := strings.ToLower(filepath.Base(name))
+	for _, tc := range tarCompression {
+		if !strings.HasSuffix(base, tc.suffix) {
+			continue
+		}
+		switch tc.compression {
+		case "gzip":
+			gzReader, err := gzip.NewReader(reader)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create gzip reader: %w", err)
+			}
+			return gzReader, func() { gzReader.Close() }, nil
+		case "bzip2":
+			return bzip2.NewReader(reader), func() {}, nil
+		case "xz":
+			xzReader, err := xz.NewReader(reader)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create xz reader: %w", err)
+			}
+			return xzReader, func() {}, nil
+		default:
+			return reader, func() {}, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("unsupported compression for %s (supported: .tar, .tar.gz, .tgz, .tar.bz2, .tbz2, .tar.xz, .txz)", name)
+}
+
+// openArchiveTar opens the tar file inside a zip archive, decompressing it
+// according to its suffix. The returned function closes the archive.
+func openArchiveTar(zipPath string) (io.Reader, func(), error) {
 	// Open zip file
 	zipReader, err := zip.OpenReader(zipPath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open zip file: %w", err)
 	}
-	defer zipReader.Close()
 
 	// Find the tar file inside the zip
 	var tarFile *zip.File
 	for _, file := range zipReader.File {
-		if strings.HasSuffix(file.Name, ".tar") || strings.HasSuffix(file.Name, ".tar.gz") {
+		if isTarName(file.Name) {
 			tarFile = file
 			break
 		}
 	}
 
 	if tarFile == nil {
+		zipReader.Close()
 		return nil, nil, fmt.Errorf("no tar file found in zip archive")
 	}
 
-	// Extract tar file
 	tarReader, err := tarFile.Open()
 	if err != nil {
+		zipReader.Close()
 		return nil, nil, fmt.Errorf("failed to open tar file: %w", err)
 	}
-	defer tarReader.Close()
 
-	// Determine if it's gzipped
-	var rdfFiles []string
-	if strings.HasSuffix(tarFile.Name, ".tar.gz") || strings.HasSuffix(tarFile.Name, ".tgz") {
-		// Handle gzipped tar
-		gzReader, err := gzip.NewReader(tarReader)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	stream, closeStream, err := decompressTar(tarFile.Name, tarReader)
+	if err != nil {
+		tarReader.Close()
+		zipReader.Close()
+		return nil, nil, err
+	}
+
+	return stream, func() {
+		closeStream()
+		tarReader.Close()
+		zipReader.Close()
+	}, nil
+}
+
+// RDFEntry is an RDF document read straight from an archive
+type RDFEntry struct {
+	// Name is the document's path inside the tar
+	Name   string
+	Reader io.Reader
+	// Err is set on the last entry sent when the archive could not be read to
+	// the end, or held no RDF files (ErrNoRDFFiles); Reader is nil then
+	Err error
+}
+
+// StreamRDFFiles reads RDF documents from the zip archive's tar without
+// extracting them to disk. Each document is read into memory and sent on the
+// returned channel, which is closed once the archive is exhausted. Errors
+// opening the archive are returned directly; later read errors arrive as a
+// final entry with Err set. Cancelling ctx stops the reader, which closes the
+// archive and the channel without sending the rest, so a consumer that stops
+// early cancels ctx rather than draining the channel.
+func StreamRDFFiles(ctx context.Context, zipPath string) (<-chan RDFEntry, error) {
+	tarStream, closeArchive, err := openArchiveTar(zipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(chan RDFEntry)
+	// send delivers an entry unless ctx is cancelled first
+	send := func(entry RDFEntry) bool {
+		select {
+		case entries <- entry:
+			return true
+		case <-ctx.Done():
+			return false
 		}
-		defer gzReader.Close()
+	}
+	go func() {
+		defer close(entries)
+		defer closeArchive()
 
-		rdfFiles, err = extractTar(gzReader, extractDir)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to extract tar: %w", err)
+		tarReader := tar.NewReader(tarStream)
+		found := 0
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				send(RDFEntry{Err: fmt.Errorf("failed to read tar entry: %w", err)})
+				return
+			}
+
+			// Only process RDF files
+			if !strings.HasSuffix(header.Name, ".rdf") {
+				continue
+			}
+
+			data, err := io.ReadAll(tarReader)
+			if err != nil {
+				send(RDFEntry{Name: header.Name, Err: fmt.Errorf("failed to read %s: %w", header.Name, err)})
+				return
+			}
+			found++
+			if !send(RDFEntry{Name: header.Name, Reader: bytes.NewReader(data)}) {
+				return
+			}
 		}
-	} else {
-		// Handle regular tar
-		rdfFiles, err = extractTar(tarReader, extractDir)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to extract tar: %w", err)
+
+		if found == 0 {
+			send(RDFEntry{Err: ErrNoRDFFiles})
 		}
-	}
+	}()
 
-	return rdfFiles, cleanup, nil
+	return entries, nil
 }
 
-// extractTar extracts files from a tar archive and returns paths to RDF files
-func extractTar(reader io.Reader, destDir string) ([]string, error) {
+// extractTar extracts files from a tar archive and returns paths to RDF files,
+// along with how many were written. With skipExisting, files already on disk
+// with the entry's size are kept as they are, which is only safe when they
+// came from the same archive.
+func extractTar(reader io.Reader, destDir string, skipExisting bool) ([]string, int, error) {
 	tarReader := tar.NewReader(reader)
 	var rdfFiles []string
+	written := 0
 
 	for {
 		header, err := tarReader.Next()
@@ -113,7 +396,7 @@ func extractTar(reader io.Reader, destDir string) ([]string, error) {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to read tar entry: %w", err)
+			return nil, 0, fmt.Errorf("failed to read tar entry: %w", err)
 		}
 
 		// Only process RDF files
@@ -121,31 +404,62 @@ func extractTar(reader io.Reader, destDir string) ([]string, error) {
 			continue
 		}
 
+		// Reject absolute entry names outright rather than relying on sanitizing
+		if path.IsAbs(header.Name) || strings.HasPrefix(header.Name, `\`) || filepath.IsAbs(header.Name) || filepath.VolumeName(header.Name) != "" {
+			return nil, 0, fmt.Errorf("refusing to extract %q: absolute path in archive", header.Name)
+		}
+
 		// Create the full path for the file, using a sanitized version of the full path
 		// to avoid collisions while keeping some directory structure
 		sanitizedName := strings.ReplaceAll(header.Name, "/", "_")
 		sanitizedName = strings.ReplaceAll(sanitizedName, "\\", "_")
-		targetPath := filepath.Join(destDir, sanitizedName)
+		targetPath, err := safeJoin(destDir, sanitizedName)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if skipExisting {
+			if info, err := os.Stat(targetPath); err == nil && info.Size() == header.Size {
+				rdfFiles = append(rdfFiles, targetPath)
+				continue
+			}
+		}
 
 		// Create parent directories if needed
 		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-			return nil, fmt.Errorf("failed to create directory: %w", err)
+			return nil, 0, fmt.Errorf("failed to create directory: %w", err)
 		}
 
 		// Extract the file
 		outFile, err := os.Create(targetPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create file: %w", err)
+			return nil, 0, fmt.Errorf("failed to create file: %w", err)
 		}
 
 		if _, err := io.Copy(outFile, tarReader); err != nil {
 			outFile.Close()
-			return nil, fmt.Errorf("failed to write file: %w", err)
+			return nil, 0, fmt.Errorf("failed to write file: %w", err)
 		}
 
 		outFile.Close()
 		rdfFiles = append(rdfFiles, targetPath)
+		written++
 	}
 
-	return rdfFiles, nil
+	return rdfFiles, written, nil
+}
+
+// safeJoin joins name onto destDir and returns an error if the cleaned result
+// would fall outside destDir, so a crafted archive entry can't escape the
+// extraction directory
+func safeJoin(destDir, name string) (string, error) {
+	base, err := filepath.Abs(destDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve extraction directory: %w", err)
+	}
+	target := filepath.Clean(filepath.Join(base, name))
+	if target == base || !strings.HasPrefix(target, base+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to extract %q: path escapes %s", name, destDir)
+	}
+	return filepath.Join(destDir, name), nil
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExtractRDFFilesNoRDF(t *testing.T) {
+	rdf := rdfXML(ebookXML("1", "One", ""))
+	tests := []struct {
+		name      string
+		files     map[string]string
+		wantFiles int
+		wantErr   error
+	}{
+		{"only non-RDF files", map[string]string{"cache/epub/1/README.txt": "readme", "cache/epub/1/pg1.html": "<html/>"}, 0, ErrNoRDFFiles},
+		{"empty tar", map[string]string{}, 0, ErrNoRDFFiles},
+		{"mixed", map[string]string{"cache/epub/1/pg1.rdf": rdf, "cache/epub/1/README.txt": "readme"}, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var names []string
+			for name := range tt.files {
+				names = append(names, name)
+			}
+			archive := writeTestArchive(t, dir, tt.files, names...)
+
+			files, _, err := ExtractRDFFiles(archive, filepath.Join(dir, "extracted"), false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ExtractRDFFiles error = %v, want %v", err, tt.wantErr)
+			}
+			if len(files) != tt.wantFiles {
+				t.Errorf("ExtractRDFFiles returned %d files, want %d", len(files), tt.wantFiles)
+			}
+
+			entries, err := StreamRDFFiles(context.Background(), archive)
+			if err != nil {
+				t.Fatalf("StreamRDFFiles: %v", err)
+			}
+			var streamed int
+			var streamErr error
+			for entry := range entries {
+				if entry.Err != nil {
+					streamErr = entry.Err
+					continue
+				}
+				streamed++
+			}
+			if !errors.Is(streamErr, tt.wantErr) || streamed != tt.wantFiles {
+				t.Errorf("StreamRDFFiles sent %d files and error %v, want %d and %v", streamed, streamErr, tt.wantFiles, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractRDFFilesOtherErrors(t *testing.T) {
+	dir := t.TempDir()
+	notZip := filepath.Join(dir, "catalog.zip")
+	if err := os.WriteFile(notZip, []byte("not a zip archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	emptyDir := filepath.Join(dir, "empty")
+	if err := os.Mkdir(emptyDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		wantNoRDF bool
+	}{
+		{"missing archive", filepath.Join(dir, "missing.zip"), false},
+		{"corrupt archive", notZip, false},
+		{"directory without RDF", emptyDir, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ExtractRDFFiles(tt.path, filepath.Join(dir, "out"), false)
+			if err == nil {
+				t.Fatal("ExtractRDFFiles succeeded, want an error")
+			}
+			if got := errors.Is(err, ErrNoRDFFiles); got != tt.wantNoRDF {
+				t.Errorf("errors.Is(%v, ErrNoRDFFiles) = %v, want %v", err, got, tt.wantNoRDF)
+			}
+		})
+	}
+}
+
+func TestExtractRDFFilesChangedArchive(t *testing.T) {
+	const name = "cache/epub/1/pg1.rdf"
+	original := rdfXML(ebookXML("1", "Original", ""))
+	edited := rdfXML(ebookXML("1", "Revised!", ""))
+	if len(original) != len(edited) {
+		t.Fatal("the edited entry must keep the original's size")
+	}
+
+	tests := []struct {
+		name string
+		// rebuild replaces the archive with one holding the edited entry
+		rebuild bool
+		// dropMarker removes the marker, as an interrupted extraction leaves it
+		dropMarker bool
+		want       string
+	}{
+		{"rebuilt archive", true, false, edited},
+		{"rebuilt archive without marker", true, true, original},
+		{"same archive", false, false, original},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			extractDir := filepath.Join(dir, "extracted")
+			archive := writeTestArchive(t, dir, map[string]string{name: original}, name)
+			if _, _, err := ExtractRDFFiles(archive, extractDir, false); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.rebuild {
+				archive = writeTestArchive(t, dir, map[string]string{name: edited}, name)
+				later := time.Now().Add(time.Hour)
+				if err := os.Chtimes(archive, later, later); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.dropMarker {
+				if err := os.Remove(filepath.Join(extractDir, extractionMarkerName)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			files, _, err := ExtractRDFFiles(archive, extractDir, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 {
+				t.Fatalf("ExtractRDFFiles returned %d files, want 1", len(files))
+			}
+			got, err := os.ReadFile(files[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("extracted file holds\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SubjectFilter selects books by subject after parsing. Matching is
+// case-insensitive; with Exact unset a subject matches if it contains the
+// pattern as a substring.
+type SubjectFilter struct {
+	// Require keeps only books with at least one matching subject
+	Require string
+	// Exclude drops books with any matching subject
+	Exclude string
+	Exact   bool
+}
+
+// Allows reports whether a book passes the filter
+func (f SubjectFilter) Allows(book *Book) bool {
+	if f.Require != "" && !f.hasSubject(book, f.Require) {
+		return false
+	}
+	if f.Exclude != "" && f.hasSubject(book, f.Exclude) {
+		return false
+	}
+	return true
+}
+
+// hasSubject reports whether any of the book's subjects matches pattern
+func (f SubjectFilter) hasSubject(book *Book, pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	for _, subject := range book.Subjects {
+		subject = strings.ToLower(subject)
+		if f.Exact && subject == pattern || !f.Exact && strings.Contains(subject, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// LanguageFilter keeps only books whose primary language is in the set. An
+// empty filter allows every book.
+type LanguageFilter map[string]bool
+
+// ParseLanguageFilter builds a LanguageFilter from a comma-separated list such
+// as "en,fr". Codes are normalized like parsed languages, so "eng" and "EN"
+// both select "en".
+func ParseLanguageFilter(list string) LanguageFilter {
+	filter := LanguageFilter{}
+	for _, code := range strings.Split(list, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			filter[normalizeLanguage(code)] = true
+		}
+	}
+	return filter
+}
+
+// Allows reports whether a book passes the filter
+func (f LanguageFilter) Allows(book *Book) bool {
+	return len(f) == 0 || f[book.Language]
+}
+
+// BookshelfFilter keeps only books on the named bookshelf, matched exactly
+// but case-insensitively. An empty filter allows every book.
+type BookshelfFilter string
+
+// Allows reports whether a book passes the filter
+func (f BookshelfFilter) Allows(book *Book) bool {
+	if f == "" {
+		return true
+	}
+	for _, bookshelf := range book.Bookshelves {
+		if strings.EqualFold(strings.TrimSpace(bookshelf), strings.TrimSpace(string(f))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ModifiedFilter keeps only books whose catalog record was modified at or
+// after Since, judged by the book's dcterms:modified. Books without a
+// readable modified date are kept, since there's no telling whether they
+// changed. A zero Since allows every book.
+type ModifiedFilter struct {
+	Since time.Time
+}
+
+// Allows reports whether a book passes the filter
+func (f ModifiedFilter) Allows(book *Book) bool {
+	if f.Since.IsZero() {
+		return true
+	}
+	modified, ok := parseModified(book.Modified)
+	return !ok || !modified.Before(f.Since)
+}
+
+// modifiedLayouts are the forms dcterms:modified takes in catalog records;
+// times without a zone are UTC
+var modifiedLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// parseModified parses a dcterms:modified value, reporting false if it is
+// empty or in no known layout
+func parseModified(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range modifiedLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ParseSince parses a --since cutoff: a date such as "2024-01-01", taken as
+// midnight UTC, or an RFC 3339 timestamp. Empty means no cutoff.
+func ParseSince(value string) (time.Time, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD or an RFC 3339 timestamp)", value)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSubjectFilterImport(t *testing.T) {
+	docs := map[string]string{
+		"1": rdfXML(ebookXML("1", "Histories", subjectXML("United States -- History"))),
+		"2": rdfXML(ebookXML("2", "Fairy Tales", subjectXML("Juvenile fiction")+subjectXML("Fairy tales"))),
+		"3": rdfXML(ebookXML("3", "Children's History", subjectXML("History -- Juvenile fiction"))),
+		"4": rdfXML(ebookXML("4", "Untitled Subjects", "")),
+		"5": rdfXML(ebookXML("5", "Plain History", subjectXML("History"))),
+	}
+
+	tests := []struct {
+		name         string
+		filter       SubjectFilter
+		wantIDs      []string
+		wantFiltered int
+	}{
+		{"no filter", SubjectFilter{}, []string{"1", "2", "3", "4", "5"}, 0},
+		{"require substring", SubjectFilter{Require: "history"}, []string{"1", "3", "5"}, 2},
+		{"require exact", SubjectFilter{Require: "History", Exact: true}, []string{"5"}, 4},
+		{"exclude substring", SubjectFilter{Exclude: "Juvenile fiction"}, []string{"1", "4", "5"}, 2},
+		{"exclude exact", SubjectFilter{Exclude: "juvenile fiction", Exact: true}, []string{"1", "3", "4", "5"}, 1},
+		{"require and exclude", SubjectFilter{Require: "History", Exclude: "Juvenile"}, []string{"1", "5"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			importer := newTestImporter(db)
+			importer.SetSubjectFilter(tt.filter)
+			importTestDocs(t, importer, docs)
+
+			if got := bookIDs(t, db); fmt.Sprint(got) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("imported %v, want %v", got, tt.wantIDs)
+			}
+			stats := importer.Stats()
+			if stats.Filtered != tt.wantFiltered {
+				t.Errorf("filtered %d, want %d", stats.Filtered, tt.wantFiltered)
+			}
+			if stats.Processed != len(docs) {
+				t.Errorf("processed %d, want %d", stats.Processed, len(docs))
+			}
+		})
+	}
+}
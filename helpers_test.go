@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// rdfNamespaces opens an rdf:RDF element declaring the namespaces catalog
+// records use
+const rdfNamespaces = `<?xml version="1.0" encoding="utf-8"?>
+<rdf:RDF xml:base="http://www.gutenberg.org/"
+  xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+  xmlns:dcterms="http://purl.org/dc/terms/"
+  xmlns:pgterms="http://www.gutenberg.org/2009/pgterms/"
+  xmlns:dcam="http://purl.org/dc/dcam/"
+  xmlns:marcrel="http://id.loc.gov/vocabulary/relators/"
+  xmlns:cc="http://web.resource.org/cc/"
+  xmlns:rdfs="http://www.w3.org/2000/01/rdf-schema#">
+`
+
+// rdfXML wraps ebook elements in an RDF document
+func rdfXML(ebooks ...string) string {
+	return rdfNamespaces + strings.Join(ebooks, "\n") + "\n</rdf:RDF>\n"
+}
+
+// ebookXML returns a pgterms:ebook element with the given ID and title,
+// followed by body, which holds any other elements of the record
+func ebookXML(id, title, body string) string {
+	return fmt.Sprintf("<pgterms:ebook rdf:about=\"ebooks/%s\">\n<dcterms:title>%s</dcterms:title>\n%s\n</pgterms:ebook>", id, title, body)
+}
+
+// fixtureRDF returns testdata/pg1.rdf, a fully populated record, renumbered
+// as ebook id
+func fixtureRDF(t testing.TB, id string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "pg1.rdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.ReplaceAll(string(data), `"ebooks/1"`, fmt.Sprintf(`"ebooks/%s"`, id))
+}
+
+// parseTestRDF parses an RDF document that must hold one ebook
+func parseTestRDF(t testing.TB, doc string) *Book {
+	t.Helper()
+	book, err := ParseRDF(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("ParseRDF: %v", err)
+	}
+	return book
+}
+
+// newTestDB opens a new in-memory catalog, closed when the test ends
+func newTestDB(t testing.TB) *DB {
+	t.Helper()
+	db, err := NewDB(MemoryDSN)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// insertTestBooks inserts books into db, failing the test on error
+func insertTestBooks(t testing.TB, db *DB, books ...*Book) {
+	t.Helper()
+	for _, book := range books {
+		if err := db.InsertBook(book); err != nil {
+			t.Fatalf("InsertBook(%s): %v", book.GutenbergID, err)
+		}
+	}
+}
+
+// writeRDFFiles writes each document to dir/<name>, creating directories as
+// needed, and returns the paths in the order given by names
+func writeRDFFiles(t testing.TB, dir string, docs map[string]string, names ...string) []string {
+	t.Helper()
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(docs[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// queryInt runs a query returning a single integer
+func queryInt(t testing.TB, db *DB, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.conn.QueryRow(db.rebind(query), args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+// languageXML returns a dcterms:language element for a language code
+func languageXML(code string) string {
+	return fmt.Sprintf(`<dcterms:language><rdf:Description><rdf:value rdf:datatype="http://purl.org/dc/terms/RFC4646">%s</rdf:value></rdf:Description></dcterms:language>`, code)
+}
+
+// newTestImporter returns an importer storing into db with small batches and
+// several workers, so tests exercise the concurrent pipeline
+func newTestImporter(db Store) *Importer {
+	return NewImporter(db, 3, 4, false)
+}
+
+// subjectXML returns a dcterms:subject element holding an LCSH heading
+func subjectXML(heading string) string {
+	return fmt.Sprintf(`<dcterms:subject><rdf:Description><dcam:memberOf rdf:resource="http://purl.org/dc/terms/LCSH"/><rdf:value>%s</rdf:value></rdf:Description></dcterms:subject>`, heading)
+}
+
+// importTestDocs writes docs, keyed by ebook ID, to RDF files and imports
+// them with imp, failing the test if the import returns an error
+func importTestDocs(t testing.TB, imp *Importer, docs map[string]string) {
+	t.Helper()
+	files := make(map[string]string, len(docs))
+	var names []string
+	for id, doc := range docs {
+		name := fmt.Sprintf("pg%s.rdf", id)
+		files[name] = doc
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	paths := writeRDFFiles(t, t.TempDir(), files, names...)
+	if err := imp.Import(context.Background(), paths); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+}
+
+// bookIDs returns the catalog's gutenberg_ids in order
+func bookIDs(t testing.TB, db *DB) []string {
+	t.Helper()
+	ids, err := db.queryStrings("SELECT gutenberg_id FROM books ORDER BY gutenberg_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+// writeTestArchive writes a catalog-style zip archive to dir holding
+// rdf-files.tar, whose entries are the named files in order, and returns its
+// path
+func writeTestArchive(t testing.TB, dir string, files map[string]string, names ...string) string {
+	t.Helper()
+	var tarData bytes.Buffer
+	tw := tar.NewWriter(&tarData)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "rdf-files.tar.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	zw := zip.NewWriter(out)
+	entry, err := zw.Create("rdf-files.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := entry.Write(tarData.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// discardStdout sends standard output, where imports print their summary, to
+// the null device until the test or benchmark ends
+func discardStdout(tb testing.TB) {
+	tb.Helper()
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = null
+	tb.Cleanup(func() {
+		os.Stdout = stdout
+		null.Close()
+	})
+}
@@ -1,8 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/schollz/progressbar/v3"
@@ -15,28 +28,105 @@ type ImportStats struct {
 	Successful int
 	Failed     int
 	Skipped    int
+	Filtered   int
+	// Invalid counts books that failed Book.Validate; with --strict they are
+	// also counted as failed, otherwise they are imported with warnings
+	Invalid int
+	// Duplicates counts files whose Gutenberg ID an earlier file in the same
+	// run already had
+	Duplicates int
+	// Empty counts files with no content, e.g. left by a truncated archive.
+	// They are kept apart from Failed, which counts real parse and store errors.
+	Empty int
+	// Recoded counts files parsed from a declared encoding other than UTF-8,
+	// such as ISO-8859-1, which the XML decoder alone would reject
+	Recoded int
+	// FilteredBy breaks Filtered down by the filter that excluded each book
+	FilteredBy map[string]int
+	Warnings   []string
 	Errors     []string
-	mu         sync.Mutex
+	// CompletenessSum accumulates Book.Completeness for successful imports
+	CompletenessSum float64
+	// Elapsed is the import's running time and Rate the files processed per
+	// second over it; both are set by Finish
+	Elapsed   time.Duration
+	Rate      float64
+	startedAt time.Time
+	// errorLog, when set, receives every failure as it is recorded
+	errorLog io.Writer
+	// DryRun marks stats of an import that parsed files without storing them
+	DryRun bool
+	mu     sync.Mutex
 }
 
-// NewImportStats creates a new ImportStats instance
+// NewImportStats creates a new ImportStats instance, starting its clock
 func NewImportStats(totalFiles int) *ImportStats {
 	return &ImportStats{
 		TotalFiles: totalFiles,
 		Errors:     make([]string, 0),
+		startedAt:  time.Now(),
 	}
 }
 
-// RecordSuccess records a successful import
-func (s *ImportStats) RecordSuccess() {
+// Throughput returns the files processed per second so far and the
+// estimated time to process the rest at that rate. The estimate is 0 when
+// the total isn't known yet or nothing has been processed.
+func (s *ImportStats) Throughput() (rate float64, eta time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := time.Since(s.startedAt)
+	if s.Processed == 0 || elapsed <= 0 {
+		return 0, 0
+	}
+	rate = float64(s.Processed) / elapsed.Seconds()
+	if remaining := s.TotalFiles - s.Processed; remaining > 0 {
+		eta = time.Duration(float64(remaining) / rate * float64(time.Second))
+	}
+	return rate, eta
+}
+
+// Progress returns how many files have been processed so far and the total,
+// which is 0 while it isn't known yet
+func (s *ImportStats) Progress() (processed, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Processed, s.TotalFiles
+}
+
+// Finish stops the clock, setting Elapsed and Rate
+func (s *ImportStats) Finish() {
+	rate, _ := s.Throughput()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Elapsed = time.Since(s.startedAt)
+	s.Rate = rate
+}
+
+// RecordSuccess records a successful import along with the book's completeness score
+func (s *ImportStats) RecordSuccess(completeness float64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.Processed++
 	s.Successful++
+	s.CompletenessSum += completeness
 }
 
-// RecordFailure records a failed import
-func (s *ImportStats) RecordFailure(err error) {
+// AverageCompleteness returns the mean completeness of successfully imported books
+func (s *ImportStats) AverageCompleteness() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Successful == 0 {
+		return 0
+	}
+	return s.CompletenessSum / float64(s.Successful)
+}
+
+// RecordFailure records a failed import and logs it as an error record,
+// with attrs such as the file or gutenberg_id as structured fields
+func (s *ImportStats) RecordFailure(err error, attrs ...any) {
+	slog.Error("import failed", append(attrs, "error", err)...)
+	s.logFailure(err, attrs)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.Processed++
@@ -49,6 +139,42 @@ func (s *ImportStats) RecordFailure(err error) {
 	}
 }
 
+// RecordEmpty records a file that was empty or only whitespace and logs it as
+// a warning record. Like a failure it goes to the error log, but it is counted
+// as Empty rather than Failed.
+func (s *ImportStats) RecordEmpty(err error, attrs ...any) {
+	slog.Warn("empty RDF file", attrs...)
+	s.logFailure(err, attrs)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Processed++
+	s.Empty++
+}
+
+// logFailure appends a failure to the error log as one tab-separated line:
+// time, file ("-" when the failure isn't tied to a file) and the full error.
+// Lines are written unbuffered so a crash leaves every failure logged.
+func (s *ImportStats) logFailure(err error, attrs []any) {
+	if s.errorLog == nil || err == nil {
+		return
+	}
+	file := "-"
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i] == "file" {
+			file = fmt.Sprint(attrs[i+1])
+		}
+	}
+	message := strings.ReplaceAll(err.Error(), "\n", " ")
+	line := fmt.Sprintf("%s\t%s\t%s\n", time.Now().UTC().Format(time.RFC3339), file, message)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, writeErr := io.WriteString(s.errorLog, line); writeErr != nil {
+		slog.Warn("failed to write error log", "error", writeErr)
+	}
+}
+
 // RecordSkipped records a skipped import
 func (s *ImportStats) RecordSkipped() {
 	s.mu.Lock()
@@ -57,212 +183,1070 @@ func (s *ImportStats) RecordSkipped() {
 	s.Skipped++
 }
 
+// RecordInvalid records a book that failed Book.Validate
+func (s *ImportStats) RecordInvalid() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Invalid++
+}
+
+// RecordDuplicate records a file repeating a Gutenberg ID seen earlier in the run
+func (s *ImportStats) RecordDuplicate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Duplicates++
+}
+
+// RecordRecoded records a file decoded from an encoding other than UTF-8
+func (s *ImportStats) RecordRecoded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Recoded++
+}
+
+// RecordWarning records a non-fatal data issue; the book is still imported
+func (s *ImportStats) RecordWarning(gutenbergID, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Warnings = append(s.Warnings, fmt.Sprintf("book %s: %s", gutenbergID, message))
+	if len(s.Warnings) > 100 {
+		s.Warnings = s.Warnings[len(s.Warnings)-100:] // Keep only last 100 warnings
+	}
+}
+
+// Import filter names, as reported in ImportStats.FilteredBy
+const (
+	filterModified  = "modified"
+	filterLanguage  = "language"
+	filterSubject   = "subject"
+	filterBookshelf = "bookshelf"
+)
+
+// RecordFiltered records a book excluded by the named import filter
+func (s *ImportStats) RecordFiltered(filter string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Processed++
+	s.Filtered++
+	if s.FilteredBy == nil {
+		s.FilteredBy = make(map[string]int)
+	}
+	s.FilteredBy[filter]++
+}
+
+// PrintSummary prints the import statistics
+func (s *ImportStats) PrintSummary() {
+	if s.DryRun {
+		fmt.Printf("\n\nImport Summary (dry run, nothing was written):\n")
+		fmt.Printf("==============================================\n")
+	} else {
+		fmt.Printf("\n\nImport Summary:\n")
+		fmt.Printf("===============\n")
+	}
+	fmt.Printf("Total files:     %d\n", s.TotalFiles)
+	fmt.Printf("Processed:       %d\n", s.Processed)
+	fmt.Printf("Successful:      %d\n", s.Successful)
+	fmt.Printf("Failed:          %d\n", s.Failed)
+	fmt.Printf("Skipped:         %d\n", s.Skipped)
+	if s.Empty > 0 {
+		fmt.Printf("Empty files:     %d\n", s.Empty)
+	}
+	if s.Filtered > 0 {
+		fmt.Printf("Filtered:        %d\n", s.Filtered)
+		for _, filter := range []string{filterModified, filterLanguage, filterSubject, filterBookshelf} {
+			if n := s.FilteredBy[filter]; n > 0 {
+				fmt.Printf("  by %-12s%d\n", filter+":", n)
+			}
+		}
+	}
+	if s.Invalid > 0 {
+		fmt.Printf("Invalid:         %d\n", s.Invalid)
+	}
+	if s.Duplicates > 0 {
+		fmt.Printf("Duplicate IDs:   %d\n", s.Duplicates)
+	}
+	if s.Recoded > 0 {
+		fmt.Printf("Recoded:         %d (not UTF-8)\n", s.Recoded)
+	}
+	if s.Processed > 0 {
+		fmt.Printf("Success rate:    %.2f%%\n", float64(s.Successful)/float64(s.Processed)*100)
+	} else {
+		fmt.Printf("Success rate:    N/A (no files processed)\n")
+	}
+	if s.Successful > 0 {
+		fmt.Printf("Completeness:    %.2f%% (average)\n", s.AverageCompleteness()*100)
+	}
+	if s.Elapsed > 0 {
+		fmt.Printf("Elapsed:         %s\n", s.Elapsed.Round(time.Millisecond))
+		fmt.Printf("Rate:            %.1f files/s\n", s.Rate)
+	}
+
+	if len(s.Warnings) > 0 {
+		fmt.Printf("\nRecent warnings (%d shown):\n", len(s.Warnings))
+		for i, warning := range s.Warnings {
+			if i >= 10 {
+				fmt.Printf("... and %d more warnings\n", len(s.Warnings)-10)
+				break
+			}
+			fmt.Printf("  - %s\n", warning)
+		}
+	}
+
+	if len(s.Errors) > 0 {
+		fmt.Printf("\nRecent errors (%d shown):\n", len(s.Errors))
+		for i, err := range s.Errors {
+			if i >= 10 {
+				fmt.Printf("... and %d more errors\n", len(s.Errors)-10)
+				break
+			}
+			fmt.Printf("  - %s\n", err)
+		}
+	}
+}
+
+// ImportMetrics is the machine-readable form of ImportStats written by
+// --metrics-json. Status is left for the caller to fill in.
+type ImportMetrics struct {
+	Status     string `json:"status,omitempty"`
+	DryRun     bool   `json:"dry_run"`
+	TotalFiles int    `json:"total_files"`
+	Processed  int    `json:"processed"`
+	Successful int    `json:"successful"`
+	Failed     int    `json:"failed"`
+	// Skipped counts books already imported (--resume or --manifest) and
+	// FilteredBy the books each import filter excluded
+	Skipped             int            `json:"skipped"`
+	Filtered            int            `json:"filtered"`
+	FilteredBy          map[string]int `json:"filtered_by"`
+	Invalid             int            `json:"invalid"`
+	Duplicates          int            `json:"duplicates"`
+	Empty               int            `json:"empty"`
+	Recoded             int            `json:"recoded"`
+	Warnings            int            `json:"warnings"`
+	SuccessRate         float64        `json:"success_rate"`
+	AverageCompleteness float64        `json:"average_completeness"`
+	ElapsedSeconds      float64        `json:"elapsed_seconds"`
+	FilesPerSecond      float64        `json:"files_per_second"`
+}
+
+// Metrics returns a snapshot of the statistics for JSON output. Warnings is
+// the number of recent warnings kept, at most 100.
+func (s *ImportStats) Metrics() ImportMetrics {
+	completeness := s.AverageCompleteness()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := ImportMetrics{
+		DryRun:              s.DryRun,
+		TotalFiles:          s.TotalFiles,
+		Processed:           s.Processed,
+		Successful:          s.Successful,
+		Failed:              s.Failed,
+		Skipped:             s.Skipped,
+		Filtered:            s.Filtered,
+		FilteredBy:          make(map[string]int, len(s.FilteredBy)),
+		Invalid:             s.Invalid,
+		Duplicates:          s.Duplicates,
+		Empty:               s.Empty,
+		Recoded:             s.Recoded,
+		Warnings:            len(s.Warnings),
+		AverageCompleteness: completeness,
+		ElapsedSeconds:      s.Elapsed.Seconds(),
+		FilesPerSecond:      s.Rate,
+	}
+	for filter, n := range s.FilteredBy {
+		m.FilteredBy[filter] = n
+	}
+	if s.Processed > 0 {
+		m.SuccessRate = float64(s.Successful) / float64(s.Processed)
+	}
+	return m
+}
+
+// WriteMetricsJSON writes metrics to path as indented JSON
+func WriteMetricsJSON(path string, metrics ImportMetrics) error {
+	data, err := json.MarshalIndent(metrics, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return nil
+}
+
 // Importer handles the import process
 type Importer struct {
-	db        *DB
+	db        Store
 	batchSize int
 	workers   int
 	resume    bool
 	stats     *ImportStats
+	// shards, when set, routes books to per-language databases instead of db
+	shards        *ShardSet
+	subjectFilter SubjectFilter
+	// languageFilter, when not empty, limits the import to these primary languages
+	languageFilter LanguageFilter
+	// bookshelfFilter, when set, limits the import to books on this bookshelf
+	bookshelfFilter BookshelfFilter
+	parserOptions   ParserOptions
+	// modifiedFilter, when set, limits the import to books modified since a cutoff
+	modifiedFilter ModifiedFilter
+	// manifest, when set, skips books whose RDF file is unchanged and records
+	// the hash of each book stored
+	manifest *Manifest
+	// twoPhase upserts each batch's authors and subjects before its books
+	twoPhase bool
+	// thresholds flags books with suspiciously many relations
+	thresholds RelationThresholds
+	// errorLog, when set, receives every failed file as it happens
+	errorLog io.Writer
+	// dryRun parses and validates every file but stores nothing; db is unused
+	dryRun bool
+	// seen maps each Gutenberg ID parsed in the current run to its first
+	// file; failOnDuplicate fails later files with the same ID
+	seen            *seenIDs
+	failOnDuplicate bool
+	// progressInterval, when positive, is how often progress is logged
+	progressInterval time.Duration
+	// strict fails books that don't pass Book.Validate instead of importing
+	// them with warnings
+	strict bool
+	// storeRaw keeps each stored book's RDF document, compressed, in raw_rdf
+	storeRaw bool
+	// pipeline sizes the read stage and the buffers between the stages
+	pipeline PipelineConfig
+	// limit, when positive, stops the import after this many files are
+	// processed; claimed counts the files taken so far, and stopFeeding
+	// ends the current run's feed of files
+	limit       int
+	claimed     atomic.Int64
+	stopFeeding context.CancelFunc
+}
+
+// ParseWorkers parses the --workers value: a positive count, or "auto" or 0
+// for runtime.NumCPU(). Parsing is the CPU-bound part of an import, since a
+// single writer stores every book, so more workers than CPUs rarely help.
+func ParseWorkers(value string) (int, error) {
+	if value == "auto" {
+		return runtime.NumCPU(), nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("want a positive number, or auto or 0 for one per CPU, got %q", value)
+	}
+	if n == 0 {
+		return runtime.NumCPU(), nil
+	}
+	return n, nil
+}
+
+// PipelineConfig sizes the stages of an import: Readers read each document
+// (and hash it when progress is tracked), the workers parse them, and a
+// single writer stores the books. ReadBuffer is how many read documents may
+// wait for a worker and ParseBuffer how many parsed books may wait for the
+// writer, so a slow stage doesn't stall the others at once. Zero fields take
+// their defaults, the buffers scaling with the number of workers.
+type PipelineConfig struct {
+	Readers     int
+	ReadBuffer  int
+	ParseBuffer int
+}
+
+// DefaultReaders is the number of read stage goroutines when not set
+const DefaultReaders = 2
+
+// withDefaults fills in the fields left at zero for an import with workers
+// parse workers
+func (c PipelineConfig) withDefaults(workers int) PipelineConfig {
+	if c.Readers <= 0 {
+		c.Readers = DefaultReaders
+	}
+	if c.ReadBuffer <= 0 {
+		c.ReadBuffer = workers * 4
+	}
+	if c.ParseBuffer <= 0 {
+		c.ParseBuffer = workers * 2
+	}
+	return c
 }
 
 // NewImporter creates a new Importer instance
-func NewImporter(db *DB, batchSize, workers int, resume bool) *Importer {
+func NewImporter(db Store, batchSize, workers int, resume bool) *Importer {
 	return &Importer{
 		db:        db,
 		batchSize: batchSize,
 		workers:   workers,
 		resume:    resume,
+
+		parserOptions: DefaultParserOptions(),
+		thresholds:    DefaultRelationThresholds(),
 	}
 }
 
-// Import processes RDF files and imports them into the database
-func (imp *Importer) Import(rdfFiles []string) error {
-	imp.stats = NewImportStats(len(rdfFiles))
+// SetParserOptions sets the options used to parse each RDF file
+func (imp *Importer) SetParserOptions(opts ParserOptions) {
+	imp.parserOptions = opts
+}
 
-	// Create progress bar
-	bar := progressbar.Default(int64(len(rdfFiles)), "Importing books")
+// SetShards routes imported books to per-language shard databases
+func (imp *Importer) SetShards(shards *ShardSet) {
+	imp.shards = shards
+}
 
-	// Create worker pool
-	fileChan := make(chan string, imp.workers)
-	var wg sync.WaitGroup
+// SetSubjectFilter restricts the import to books passing the subject filter
+func (imp *Importer) SetSubjectFilter(filter SubjectFilter) {
+	imp.subjectFilter = filter
+}
+
+// SetLanguageFilter restricts the import to books whose primary language is
+// in the filter; an empty filter imports every language
+func (imp *Importer) SetLanguageFilter(filter LanguageFilter) {
+	imp.languageFilter = filter
+}
+
+// SetBookshelfFilter restricts the import to books on the given bookshelf;
+// an empty filter imports every book
+func (imp *Importer) SetBookshelfFilter(filter BookshelfFilter) {
+	imp.bookshelfFilter = filter
+}
+
+// SetModifiedFilter restricts the import to books whose catalog record was
+// modified at or after the filter's cutoff; a zero cutoff imports every book
+func (imp *Importer) SetModifiedFilter(filter ModifiedFilter) {
+	imp.modifiedFilter = filter
+}
+
+// SetManifest limits the import to books that are new or changed relative to
+// the manifest, and updates it with each book that is stored
+func (imp *Importer) SetManifest(manifest *Manifest) {
+	imp.manifest = manifest
+}
+
+// SetTwoPhase enables two-phase batch inserts: the authors and subjects of a
+// batch are committed first, then each book is inserted on its own
+func (imp *Importer) SetTwoPhase(enabled bool) {
+	imp.twoPhase = enabled
+}
+
+// SetRelationThresholds sets the author, subject and format counts above
+// which a book is reported as a warning
+func (imp *Importer) SetRelationThresholds(thresholds RelationThresholds) {
+	imp.thresholds = thresholds
+}
+
+// SetErrorLog appends every failure to w as it happens, one line per failed
+// file, regardless of how many errors the summary keeps
+func (imp *Importer) SetErrorLog(w io.Writer) {
+	imp.errorLog = w
+}
+
+// SetDryRun makes the import parse and validate every file and tally the
+// results without writing anything; the importer's database may be nil.
+// Books that would be stored are counted as successful.
+func (imp *Importer) SetDryRun(enabled bool) {
+	imp.dryRun = enabled
+}
+
+// SetStrict makes books that fail Book.Validate import failures instead of
+// warnings
+func (imp *Importer) SetStrict(enabled bool) {
+	imp.strict = enabled
+}
+
+// SetStoreRaw saves each imported book's original RDF document, gzipped, in
+// raw_rdf so it can be reparsed later without the archive. It costs disk
+// space, so it is off by default.
+func (imp *Importer) SetStoreRaw(enabled bool) {
+	imp.storeRaw = enabled
+}
+
+// SetPipeline sets the number of readers and the buffer sizes between the
+// import's read, parse and write stages
+func (imp *Importer) SetPipeline(config PipelineConfig) {
+	imp.pipeline = config
+}
+
+// SetProgressInterval logs the import's progress every interval, for runs
+// without a terminal to show the bar (0 disables it)
+func (imp *Importer) SetProgressInterval(interval time.Duration) {
+	imp.progressInterval = interval
+}
+
+// SetFailOnDuplicate fails files whose Gutenberg ID an earlier file in the
+// same run already had, instead of importing them over it with a warning
+func (imp *Importer) SetFailOnDuplicate(enabled bool) {
+	imp.failOnDuplicate = enabled
+}
+
+// SetLimit stops the import after n files have been processed (0 for no
+// limit). Files skipped by resume before parsing don't count toward it.
+func (imp *Importer) SetLimit(n int) {
+	imp.limit = n
+}
+
+// LimitReached reports whether the last import stopped at its file limit
+func (imp *Importer) LimitReached() bool {
+	return imp.limit > 0 && imp.claimed.Load() >= int64(imp.limit)
+}
+
+// Stats returns the statistics of the last import
+func (imp *Importer) Stats() *ImportStats {
+	return imp.stats
+}
+
+// claimFile takes one of the limited slots for a file about to be parsed. Once
+// the limit is used up it stops the feed and returns false, and the worker
+// stops. Without a limit it always succeeds.
+func (imp *Importer) claimFile() bool {
+	if imp.limit <= 0 {
+		return true
+	}
+	if imp.claimed.Add(1) <= int64(imp.limit) {
+		return true
+	}
+	imp.claimed.Store(int64(imp.limit))
+	imp.stopFeeding()
+	return false
+}
+
+// rdfSource is a document handed to a reader: an extracted file on disk, or
+// an entry streamed from the archive when path is empty
+type rdfSource struct {
+	path  string
+	entry RDFEntry
+}
+
+// name identifies the document in error messages
+func (src rdfSource) name() string {
+	if src.path != "" {
+		return src.path
+	}
+	return src.entry.Name
+}
+
+// read returns the document's contents
+func (src rdfSource) read() ([]byte, error) {
+	if src.path != "" {
+		return os.ReadFile(src.path)
+	}
+	return io.ReadAll(src.entry.Reader)
+}
+
+// Import processes RDF files and imports them into the database. When ctx
+// is cancelled, no new files are read or parsed, the writer stores the
+// batch it holds and Import returns ctx.Err(); every committed book stays valid, so a rerun
+// with resume enabled continues where this one stopped.
+func (imp *Importer) Import(ctx context.Context, rdfFiles []string) error {
+	// The feed also stops once the file limit is reached
+	feedCtx, stopFeeding := context.WithCancel(ctx)
+	defer stopFeeding()
+	imp.stopFeeding = stopFeeding
+
+	sources := make(chan rdfSource)
+	go func() {
+		defer close(sources)
+		for _, file := range rdfFiles {
+			select {
+			case sources <- rdfSource{path: file}:
+			case <-feedCtx.Done():
+				return
+			}
+		}
+	}()
+
+	bar := newProgressBar(int64(len(rdfFiles)), "Importing books")
+	imp.run(feedCtx, len(rdfFiles), sources, bar)
+
+	// Print summary
+	imp.stats.PrintSummary()
+
+	return ctx.Err()
+}
+
+// ImportStream imports RDF documents as they arrive from StreamRDFFiles,
+// without extracting them to disk. An error carried by an entry stops the
+// import once in-flight documents are stored, and is returned. Cancelling
+// ctx stops the import as in Import. When the import ends before entries is
+// exhausted (cancelled, or --limit reached) it stops reading from entries,
+// so the caller should cancel the producer, as StreamRDFFiles allows,
+// rather than leave it blocked.
+func (imp *Importer) ImportStream(ctx context.Context, entries <-chan RDFEntry) error {
+	// The feed also stops once the file limit is reached
+	feedCtx, stopFeeding := context.WithCancel(ctx)
+	defer stopFeeding()
+	imp.stopFeeding = stopFeeding
+
+	// total and streamErr belong to the feeder until it closes fed
+	sources := make(chan rdfSource)
+	fed := make(chan struct{})
+	var streamErr error
+	total := 0
+	go func() {
+		defer close(fed)
+		defer close(sources)
+		for entry := range entries {
+			if entry.Err != nil {
+				streamErr = entry.Err
+				// The entry with Err is the last one; the producer closes entries
+				return
+			}
+			select {
+			case sources <- rdfSource{entry: entry}:
+				total++
+			case <-feedCtx.Done():
+				return
+			}
+		}
+	}()
+
+	// The number of documents isn't known until the archive is read
+	bar := newProgressBar(-1, "Importing books")
+	imp.run(feedCtx, 0, sources, bar)
+	// Readers stop taking sources when the import ends early; stop the
+	// feeder too and wait for it before reading what it recorded
+	stopFeeding()
+	<-fed
+	imp.stats.TotalFiles = total
+	imp.stats.PrintSummary()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return streamErr
+}
+
+// run feeds sources to the worker pool and waits for every book to be stored
+func (imp *Importer) run(ctx context.Context, total int, sources <-chan rdfSource, bar *progressbar.ProgressBar) {
+	imp.stats = NewImportStats(total)
+	imp.claimed.Store(0)
+	imp.seen = newSeenIDs()
+	imp.stats.errorLog = imp.errorLog
+	imp.stats.DryRun = imp.dryRun
+	if imp.shards != nil {
+		imp.shards.stats = imp.stats
+		imp.shards.manifest = imp.manifest
+	} else if !imp.dryRun {
+		imp.db.SetWarningHandler(imp.stats.RecordWarning)
+	}
 
-	// Start workers
+	// Readers read documents, workers only parse them, in parallel, and a
+	// single writer batches what they parse and does every database write.
+	// Buffered channels connect the stages.
+	pipeline := imp.pipeline.withDefaults(imp.workers)
+	documents := make(chan rdfDocument, pipeline.ReadBuffer)
+	parsed := make(chan parsedBook, pipeline.ParseBuffer)
+	written := make(chan struct{})
+	go func() {
+		imp.writer(parsed, bar)
+		close(written)
+	}()
+
+	// Start workers, then the readers feeding them
+	var wg sync.WaitGroup
 	for i := 0; i < imp.workers; i++ {
 		wg.Add(1)
-		go imp.worker(fileChan, bar, &wg)
+		go imp.worker(ctx, documents, parsed, bar, &wg)
+	}
+	var readers sync.WaitGroup
+	for i := 0; i < pipeline.Readers; i++ {
+		readers.Add(1)
+		go imp.reader(ctx, sources, documents, bar, &readers)
 	}
 
-	// Send files to workers
-	for _, file := range rdfFiles {
-		fileChan <- file
+	// Report the rate and time remaining on the bar while the import runs,
+	// and in the log too when a progress interval is set. Without a terminal
+	// to draw the bar on, progress is logged by default instead.
+	interval := imp.progressInterval
+	if interval == 0 && !progressHidden && !progressVisible() {
+		interval = pipedProgressInterval
+	}
+	stopReporting := make(chan struct{})
+	var reporting sync.WaitGroup
+	reporting.Add(1)
+	go func() {
+		defer reporting.Done()
+		imp.reportThroughput(bar, stopReporting)
+	}()
+	if interval > 0 {
+		reporting.Add(1)
+		go func() {
+			defer reporting.Done()
+			imp.logProgress(interval, stopReporting)
+		}()
+	}
+	stopReports := func() {
+		close(stopReporting)
+		reporting.Wait()
 	}
-	close(fileChan)
 
-	// Wait for all workers to complete
+	// Wait for the readers, then for the workers to parse what they read,
+	// then for the writer to store the rest
+	readers.Wait()
+	close(documents)
 	wg.Wait()
-	bar.Finish()
+	close(parsed)
+	<-written
+	if imp.shards != nil {
+		// Drain the shard writers so the summary is complete; the caller
+		// closes the shards with the import's outcome
+		imp.shards.Drain()
+	}
+	stopReports()
+	imp.stats.Finish()
+	if ctx.Err() != nil {
+		// Leave the bar where it stopped rather than filling it
+		bar.Exit()
+	} else {
+		bar.Finish()
+	}
+}
 
-	// Print summary
-	imp.printSummary()
+// pipedProgressInterval is how often progress is logged when stderr isn't a
+// terminal and no progress interval is set
+const pipedProgressInterval = 30 * time.Second
 
-	return nil
+// throughputInterval is how often the import's rate and ETA are refreshed
+const throughputInterval = 2 * time.Second
+
+// reportThroughput shows the current rate, and the estimated time remaining
+// when the total is known, in the bar's description until stop is closed
+func (imp *Importer) reportThroughput(bar *progressbar.ProgressBar, stop <-chan struct{}) {
+	ticker := time.NewTicker(throughputInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			rate, eta := imp.stats.Throughput()
+			if eta > 0 {
+				bar.Describe(fmt.Sprintf("Importing books (%.0f files/s, ETA %s)", rate, eta.Round(time.Second)))
+			} else {
+				bar.Describe(fmt.Sprintf("Importing books (%.0f files/s)", rate))
+			}
+		}
+	}
+}
+
+// logProgress writes an info record with the files processed so far, the
+// total and estimated time remaining when known, and the current rate every
+// interval until stop is closed. Unlike the bar, it survives piped output.
+func (imp *Importer) logProgress(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			processed, total := imp.stats.Progress()
+			rate, eta := imp.stats.Throughput()
+			attrs := []any{"processed", processed}
+			if total > 0 {
+				attrs = append(attrs, "total", total)
+			}
+			attrs = append(attrs, "files_per_second", math.Round(rate*10)/10)
+			if eta > 0 {
+				attrs = append(attrs, "eta", eta.Round(time.Second).String())
+			}
+			slog.Info("import progress", attrs...)
+		}
+	}
+}
+
+// parsedBook is a worker's result for one document, handed to the writer:
+// a book to store, or a file outcome (status) to record when book is nil
+type parsedBook struct {
+	book   *Book
+	file   fileProgress
+	status string
+}
+
+// rdfDocument is a document read by a reader for a worker to parse; err is
+// the error reading it
+type rdfDocument struct {
+	src  rdfSource
+	file fileProgress
+	data []byte
+	err  error
 }
 
-// worker processes files from the channel
-func (imp *Importer) worker(fileChan <-chan string, bar *progressbar.ProgressBar, wg *sync.WaitGroup) {
+// reader reads documents from sources until it is closed or ctx is
+// cancelled, skipping those resume finds already imported, and hands the
+// rest to the workers. Once a document is claimed against the limit it is
+// always handed over, since the workers drain documents until it is closed.
+func (imp *Importer) reader(ctx context.Context, sources <-chan rdfSource, documents chan<- rdfDocument, bar *progressbar.ProgressBar, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	batch := make([]*Book, 0, imp.batchSize)
+	for src := range sources {
+		if ctx.Err() != nil {
+			break
+		}
 
-	for filePath := range fileChan {
-		// Parse RDF file
-		book, err := ParseRDFFile(filePath)
+		data, err := src.read()
+		file := fileProgress{name: src.name()}
+		if err == nil && imp.tracksProgress() {
+			file.hash = HashBytes(data)
 
-		// Check if we should skip this file (after parsing to avoid double parse)
-		if imp.resume && err == nil && book != nil && book.GutenbergID != "" {
-			exists, checkErr := imp.db.BookExists(book.GutenbergID)
+			// Skip files already imported with the same contents before parsing
+			if imp.resume {
+				processed, checkErr := imp.db.WasProcessed(file.name, file.hash)
+				if checkErr == nil && processed {
+					imp.stats.RecordSkipped()
+					bar.Add(1)
+					continue
+				}
+			}
+		}
+
+		// Without file progress (shards), a book named by its file can still be
+		// skipped before parsing; other files are checked after parsing below
+		if err == nil && imp.resume && !imp.tracksProgress() {
+			if id, ok := extractIDFromPath(file.name); ok {
+				if exists, checkErr := imp.idExists(id); checkErr == nil && exists {
+					imp.stats.RecordSkipped()
+					bar.Add(1)
+					continue
+				}
+			}
+		}
+
+		// Files skipped above don't count toward the limit
+		if !imp.claimFile() {
+			break
+		}
+
+		documents <- rdfDocument{src: src, file: file, data: data, err: err}
+	}
+}
+
+// worker parses documents from the channel until it is closed, sending each
+// book, or the file's failed or filtered outcome, to the writer. Books routed
+// to shards are sent to their shard writer instead. Once ctx is cancelled,
+// other than by reaching the limit, the documents left are dropped unparsed
+// and, with resume, read again on the next run.
+func (imp *Importer) worker(ctx context.Context, documents <-chan rdfDocument, parsed chan<- parsedBook, bar *progressbar.ProgressBar, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for doc := range documents {
+		if ctx.Err() != nil && !imp.LimitReached() {
+			continue
+		}
+		src, file, data, err := doc.src, doc.file, doc.data, doc.err
+
+		// Parse RDF document
+		var book *Book
+		if err == nil {
+			book, err = ParseRDFWithOptions(bytes.NewReader(data), imp.parserOptions)
+		}
+
+		// Without file progress (shards), skip books that already exist in
+		// their shard, which is only known once the language is parsed
+		if imp.resume && !imp.tracksProgress() && err == nil && book != nil && book.GutenbergID != "" {
+			exists, checkErr := imp.bookExists(book)
 			if checkErr == nil && exists {
 				imp.stats.RecordSkipped()
 				bar.Add(1)
 				continue
 			}
 		}
+		if errors.Is(err, ErrEmptyDocument) {
+			imp.stats.RecordEmpty(fmt.Errorf("failed to parse %s: %w", src.name(), err), "file", src.name())
+			parsed <- parsedBook{file: file, status: progressFailed}
+			bar.Add(1)
+			continue
+		}
 		if err != nil {
-			imp.stats.RecordFailure(fmt.Errorf("failed to parse %s: %w", filePath, err))
+			imp.stats.RecordFailure(fmt.Errorf("failed to parse %s: %w", src.name(), err), "file", src.name())
+			parsed <- parsedBook{file: file, status: progressFailed}
 			bar.Add(1)
 			continue
 		}
+		if book.Charset != "" {
+			imp.stats.RecordRecoded()
+		}
 
 		// Validate book has at least a Gutenberg ID
 		if book.GutenbergID == "" {
-			imp.stats.RecordFailure(fmt.Errorf("no Gutenberg ID found in %s", filePath))
+			imp.stats.RecordFailure(fmt.Errorf("no Gutenberg ID found in %s", src.name()), "file", src.name())
+			parsed <- parsedBook{file: file, status: progressFailed}
 			bar.Add(1)
 			continue
 		}
 
-		batch = append(batch, book)
+		if !imp.checkDuplicate(book, src.name()) {
+			parsed <- parsedBook{file: file, status: progressFailed}
+			bar.Add(1)
+			continue
+		}
 
-		// Insert batch when it reaches the batch size
-		if len(batch) >= imp.batchSize {
-			imp.insertBatch(batch)
-			batch = batch[:0] // Reset batch
+		// Filters combine; a book is counted against the first one it fails
+		if filter := imp.excludedBy(book); filter != "" {
+			imp.stats.RecordFiltered(filter)
+			parsed <- parsedBook{file: file, status: progressFiltered}
+			bar.Add(1)
+			continue
 		}
 
-		bar.Add(1)
+		if !imp.checkValid(book, src.name()) {
+			parsed <- parsedBook{file: file, status: progressFailed}
+			bar.Add(1)
+			continue
+		}
+
+		for _, warning := range imp.thresholds.Check(book) {
+			imp.stats.RecordWarning(book.GutenbergID, warning)
+		}
+
+		if imp.manifest != nil {
+			hash := HashBytes(data)
+			if !imp.manifest.Changed(book.GutenbergID, hash) {
+				imp.stats.RecordSkipped()
+				bar.Add(1)
+				continue
+			}
+			imp.manifest.Stage(book.GutenbergID, hash)
+		}
+
+		// Compress here, in parallel, rather than in the single writer
+		if imp.storeRaw && !imp.dryRun {
+			if book.RawRDFGzip, err = compressRDF(data); err != nil {
+				imp.stats.RecordFailure(fmt.Errorf("%s: %w", src.name(), err), "file", src.name())
+				parsed <- parsedBook{file: file, status: progressFailed}
+				bar.Add(1)
+				continue
+			}
+		}
+
+		if imp.shards != nil {
+			if err := imp.shards.Send(book); err != nil {
+				imp.stats.RecordFailure(err, "file", src.name(), "gutenberg_id", book.GutenbergID)
+			}
+			bar.Add(1)
+			continue
+		}
+
+		// The bar advances for this book once the writer has stored it
+		parsed <- parsedBook{book: book, file: file}
 	}
+}
 
-	// Insert remaining books in batch
-	if len(batch) > 0 {
-		imp.insertBatch(batch)
+// excludedBy returns the name of the first import filter the book fails, or
+// "" if every filter allows it
+func (imp *Importer) excludedBy(book *Book) string {
+	switch {
+	case !imp.modifiedFilter.Allows(book):
+		return filterModified
+	case !imp.languageFilter.Allows(book):
+		return filterLanguage
+	case !imp.subjectFilter.Allows(book):
+		return filterSubject
+	case !imp.bookshelfFilter.Allows(book):
+		return filterBookshelf
 	}
+	return ""
 }
 
-// insertBatch inserts a batch of books
-func (imp *Importer) insertBatch(batch []*Book) {
-	for _, book := range batch {
-		if err := imp.db.InsertBook(book); err != nil {
-			imp.stats.RecordFailure(fmt.Errorf("failed to insert book %s: %w", book.GutenbergID, err))
+// writer stores the books parsed by the workers in batches of batchSize, one
+// transaction per batch, until parsed is closed; books still in its batch
+// are stored then, so a cancelled import loses nothing already parsed. File
+// outcomes without a book are recorded alongside the next batch.
+func (imp *Importer) writer(parsed <-chan parsedBook, bar *progressbar.ProgressBar) {
+	batch := make([]*Book, 0, imp.batchSize)
+	// files holds the progress record of each book in batch
+	files := make([]fileProgress, 0, imp.batchSize)
+	var outcomes []ProgressRecord
+
+	flush := func() {
+		imp.insertBatch(batch, files, outcomes)
+		bar.Add(len(batch))
+		batch = batch[:0]
+		files = files[:0]
+		outcomes = outcomes[:0]
+	}
+
+	for p := range parsed {
+		if p.book == nil {
+			if imp.tracksProgress() && p.file.hash != "" {
+				outcomes = append(outcomes, p.file.record(p.status))
+			}
 		} else {
-			imp.stats.RecordSuccess()
+			batch = append(batch, p.book)
+			files = append(files, p.file)
 		}
+
+		// Insert batch when it reaches the batch size
+		if len(batch) >= imp.batchSize || len(outcomes) >= imp.batchSize {
+			flush()
+		}
+	}
+
+	// Insert remaining books in batch
+	if len(batch) > 0 || len(outcomes) > 0 {
+		flush()
 	}
 }
 
-// printSummary prints import statistics
-func (imp *Importer) printSummary() {
-	fmt.Printf("\n\nImport Summary:\n")
-	fmt.Printf("===============\n")
-	fmt.Printf("Total files:     %d\n", imp.stats.TotalFiles)
-	fmt.Printf("Processed:       %d\n", imp.stats.Processed)
-	fmt.Printf("Successful:      %d\n", imp.stats.Successful)
-	fmt.Printf("Failed:          %d\n", imp.stats.Failed)
-	fmt.Printf("Skipped:         %d\n", imp.stats.Skipped)
-	if imp.stats.Processed > 0 {
-		fmt.Printf("Success rate:    %.2f%%\n", float64(imp.stats.Successful)/float64(imp.stats.Processed)*100)
-	} else {
-		fmt.Printf("Success rate:    N/A (no files processed)\n")
+// fileProgress identifies an RDF file for the import_progress table
+type fileProgress struct {
+	name string
+	hash string
+}
+
+// seenIDs is the set of Gutenberg IDs parsed in one import run, each with the
+// file it first came from; safe for concurrent use by the workers
+type seenIDs struct {
+	mu    sync.Mutex
+	files map[string]string
+}
+
+// newSeenIDs creates an empty set
+func newSeenIDs() *seenIDs {
+	return &seenIDs{files: make(map[string]string)}
+}
+
+// add records a Gutenberg ID for file. If the ID was already seen, it returns
+// the earlier file and true, and keeps the earlier file recorded.
+func (s *seenIDs) add(gutenbergID, file string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if first, ok := s.files[gutenbergID]; ok {
+		return first, true
 	}
+	s.files[gutenbergID] = file
+	return "", false
+}
 
-	if len(imp.stats.Errors) > 0 {
-		fmt.Printf("\nRecent errors (%d shown):\n", len(imp.stats.Errors))
-		for i, err := range imp.stats.Errors {
-			if i >= 10 {
-				fmt.Printf("... and %d more errors\n", len(imp.stats.Errors)-10)
-				break
-			}
-			fmt.Printf("  - %s\n", err)
-		}
+// checkDuplicate records a book's Gutenberg ID as seen in this run. A book
+// whose ID an earlier file already had is counted and logged, and would be
+// upserted over that file's book. With failOnDuplicate it is recorded as a
+// failure instead and checkDuplicate returns false, so it isn't stored.
+func (imp *Importer) checkDuplicate(book *Book, file string) bool {
+	first, dup := imp.seen.add(book.GutenbergID, file)
+	if !dup {
+		return true
+	}
+	imp.stats.RecordDuplicate()
+
+	if imp.failOnDuplicate {
+		imp.stats.RecordFailure(fmt.Errorf("duplicate Gutenberg ID %s in %s, already seen in %s", book.GutenbergID, file, first), "file", file, "gutenberg_id", book.GutenbergID)
+		return false
 	}
+	slog.Warn("duplicate Gutenberg ID", "gutenberg_id", book.GutenbergID, "file", file, "first_file", first)
+	imp.stats.RecordWarning(book.GutenbergID, fmt.Sprintf("also in %s, first seen in %s", file, first))
+	return true
 }
 
-// ImportWithProgress is an alternative import function with detailed progress
-func (imp *Importer) ImportWithProgress(rdfFiles []string) error {
-	startTime := time.Now()
-	imp.stats = NewImportStats(len(rdfFiles))
-
-	// Create progress bar with more details
-	bar := progressbar.NewOptions(
-		len(rdfFiles),
-		progressbar.OptionSetDescription("Importing books"),
-		progressbar.OptionSetWidth(50),
-		progressbar.OptionShowCount(),
-		progressbar.OptionShowIts(),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "=",
-			SaucerHead:    ">",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Print("\n")
-		}),
-	)
-
-	// Process files
-	for _, filePath := range rdfFiles {
-		// Check if we should skip this file
-		if imp.resume {
-			book, err := ParseRDFFile(filePath)
-			if err == nil && book.GutenbergID != "" {
-				exists, err := imp.db.BookExists(book.GutenbergID)
-				if err == nil && exists {
-					imp.stats.RecordSkipped()
-					bar.Add(1)
-					continue
-				}
-			}
-		}
+// checkValid runs Book.Validate on a parsed book. In strict mode an invalid
+// book is recorded as a failure and checkValid returns false, so it isn't
+// stored; otherwise each problem is logged and kept as a warning, and the
+// book is imported as is.
+func (imp *Importer) checkValid(book *Book, file string) bool {
+	problems := book.Validate()
+	if len(problems) == 0 {
+		return true
+	}
+	imp.stats.RecordInvalid()
 
-		// Parse and insert
-		book, err := ParseRDFFile(filePath)
-		if err != nil {
-			imp.stats.RecordFailure(fmt.Errorf("failed to parse %s: %w", filePath, err))
-			bar.Add(1)
-			continue
+	if imp.strict {
+		messages := make([]string, len(problems))
+		for i, problem := range problems {
+			messages[i] = problem.Error()
 		}
+		imp.stats.RecordFailure(fmt.Errorf("book %s failed validation: %s", book.GutenbergID, strings.Join(messages, "; ")), "file", file, "gutenberg_id", book.GutenbergID)
+		return false
+	}
 
-		if book.GutenbergID == "" {
-			imp.stats.RecordFailure(fmt.Errorf("no Gutenberg ID found in %s", filePath))
-			bar.Add(1)
-			continue
+	for _, problem := range problems {
+		slog.Warn("book failed validation", "gutenberg_id", book.GutenbergID, "file", file, "problem", problem)
+		imp.stats.RecordWarning(book.GutenbergID, problem.Error())
+	}
+	return true
+}
+
+// tracksProgress reports whether file progress is recorded; shards have no
+// single database to record it in, and a dry run records nothing
+func (imp *Importer) tracksProgress() bool {
+	return imp.shards == nil && !imp.dryRun
+}
+
+// record returns the progress record of a file with the given status
+func (file fileProgress) record(status string) ProgressRecord {
+	return ProgressRecord{File: file.name, Hash: file.hash, Status: status}
+}
+
+// bookExists checks for an existing book in the database or its shard
+func (imp *Importer) bookExists(book *Book) (bool, error) {
+	if imp.shards != nil {
+		return imp.shards.BookExists(book)
+	}
+	return imp.db.BookExists(book.GutenbergID)
+}
+
+// idExists checks for an existing book by Gutenberg ID alone. With shards,
+// only the shards opened so far are searched, since the shard a book belongs
+// to depends on its parsed language.
+func (imp *Importer) idExists(gutenbergID string) (bool, error) {
+	if imp.shards != nil {
+		return imp.shards.ContainsID(gutenbergID)
+	}
+	return imp.db.BookExists(gutenbergID)
+}
+
+// rdfFileIDPattern matches catalog file names such as "cache/epub/1234/pg1234.rdf",
+// or "cache_epub_1234_pg1234.rdf" once extracted
+var rdfFileIDPattern = regexp.MustCompile(`(?:^|[/\\_])pg(\d+)\.rdf$`)
+
+// extractIDFromPath returns the Gutenberg ID in a catalog RDF file name, and
+// false if the name doesn't follow the catalog's pg<ID>.rdf pattern
+func extractIDFromPath(path string) (string, bool) {
+	match := rdfFileIDPattern.FindStringSubmatch(path)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// insertBatch inserts a batch of books and records the progress of the file
+// each came from, along with the other file outcomes given. A failure to
+// record progress is logged but doesn't fail the books.
+func (imp *Importer) insertBatch(batch []*Book, files []fileProgress, outcomes []ProgressRecord) {
+	if imp.dryRun {
+		for _, book := range batch {
+			imp.stats.RecordSuccess(book.Completeness())
 		}
+		return
+	}
 
-		if err := imp.db.InsertBook(book); err != nil {
-			imp.stats.RecordFailure(fmt.Errorf("failed to insert book %s: %w", book.GutenbergID, err))
+	var errs []error
+	if len(batch) > 0 {
+		if imp.twoPhase {
+			errs = imp.db.InsertBooksTwoPhase(batch)
 		} else {
-			imp.stats.RecordSuccess()
+			errs = imp.db.BatchInsertBooks(batch)
 		}
-
-		bar.Add(1)
 	}
 
-	bar.Finish()
-
-	elapsed := time.Since(startTime)
-	fmt.Printf("\nImport completed in %s\n", elapsed)
-	imp.printSummary()
+	records := make([]ProgressRecord, 0, len(outcomes)+len(batch))
+	records = append(records, outcomes...)
+	for i, book := range batch {
+		if err := errs[i]; err != nil {
+			imp.stats.RecordFailure(fmt.Errorf("failed to insert book %s: %w", book.GutenbergID, err), "file", files[i].name, "gutenberg_id", book.GutenbergID)
+			records = append(records, files[i].record(progressFailed))
+		} else {
+			imp.stats.RecordSuccess(book.Completeness())
+			records = append(records, files[i].record(progressImported))
+			if imp.manifest != nil {
+				imp.manifest.Commit(book.GutenbergID)
+			}
+		}
+	}
 
-	return nil
+	// Progress is recorded in one transaction per batch to keep it cheap
+	if imp.tracksProgress() && len(records) > 0 {
+		if err := imp.db.MarkProcessedBatch(records); err != nil {
+			slog.Warn("failed to record import progress", "files", len(records), "error", err)
+		}
+	}
 }
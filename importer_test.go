@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEntries returns a channel of RDF entries for docs 1..n followed by an
+// entry carrying err when it is non-nil, and closes it. Like StreamRDFFiles,
+// it stops sending when the test ends.
+func testEntries(t testing.TB, n int, err error) <-chan RDFEntry {
+	entries := make(chan RDFEntry)
+	send := func(entry RDFEntry) bool {
+		select {
+		case entries <- entry:
+			return true
+		case <-t.Context().Done():
+			return false
+		}
+	}
+	go func() {
+		defer close(entries)
+		for i := 1; i <= n; i++ {
+			id := fmt.Sprint(i)
+			if !send(RDFEntry{Name: "pg" + id + ".rdf", Reader: strings.NewReader(rdfXML(ebookXML(id, "Book "+id, "")))}) {
+				return
+			}
+		}
+		if err != nil {
+			send(RDFEntry{Err: err})
+		}
+	}()
+	return entries
+}
+
+func TestImportStream(t *testing.T) {
+	errTruncated := errors.New("archive truncated")
+	tests := []struct {
+		name      string
+		entries   int
+		streamErr error
+		limit     int
+		wantErr   error
+		wantBooks int
+		wantTotal int
+	}{
+		{"whole stream", 12, nil, 0, nil, 12, 12},
+		{"stream error", 5, errTruncated, 0, errTruncated, 5, 5},
+		{"limit", 40, nil, 3, nil, 3, -1},
+		{"empty", 0, nil, 0, nil, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			importer := newTestImporter(db)
+			importer.SetLimit(tt.limit)
+			err := importer.ImportStream(context.Background(), testEntries(t, tt.entries, tt.streamErr))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ImportStream error = %v, want %v", err, tt.wantErr)
+			}
+			if got := len(bookIDs(t, db)); got != tt.wantBooks {
+				t.Errorf("%d books stored, want %d", got, tt.wantBooks)
+			}
+			// With a limit the feeder may have handed over a few more documents
+			// than were imported; it never counts more than it received
+			stats := importer.Stats()
+			if tt.wantTotal >= 0 && stats.TotalFiles != tt.wantTotal {
+				t.Errorf("TotalFiles = %d, want %d", stats.TotalFiles, tt.wantTotal)
+			}
+			if stats.TotalFiles > tt.entries {
+				t.Errorf("TotalFiles = %d, more than the %d entries sent", stats.TotalFiles, tt.entries)
+			}
+		})
+	}
+}
+
+func TestImportStreamStopsArchiveReader(t *testing.T) {
+	files := map[string]string{}
+	var names []string
+	for i := 1; i <= 30; i++ {
+		name := fmt.Sprintf("cache/epub/%d/pg%d.rdf", i, i)
+		files[name] = rdfXML(ebookXML(fmt.Sprint(i), "Book", ""))
+		names = append(names, name)
+	}
+	archive := writeTestArchive(t, t.TempDir(), files, names...)
+
+	tests := []struct {
+		name    string
+		limit   int
+		cancel  bool
+		wantErr error
+	}{
+		{"limit reached", 2, false, nil},
+		{"interrupted", 0, true, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streamCtx, stopStream := context.WithCancel(context.Background())
+			defer stopStream()
+			entries, err := StreamRDFFiles(streamCtx, archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			importer := newTestImporter(newTestDB(t))
+			importer.SetLimit(tt.limit)
+			if err := importer.ImportStream(ctx, entries); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ImportStream error = %v, want %v", err, tt.wantErr)
+			}
+
+			// The archive reader is left blocked on its next send until the
+			// stream is cancelled; then it closes the channel
+			stopStream()
+			deadline := time.After(5 * time.Second)
+			for {
+				select {
+				case _, ok := <-entries:
+					if !ok {
+						return
+					}
+				case <-deadline:
+					t.Fatal("archive reader still running after the stream was cancelled")
+				}
+			}
+		})
+	}
+}
+
+func TestImportLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       int
+		existing    int
+		resume      bool
+		limit       int
+		wantNew     int
+		wantSkipped int
+		wantReached bool
+	}{
+		{"no limit", 20, 0, false, 0, 20, 0, false},
+		{"limit", 20, 0, false, 5, 5, 0, true},
+		{"limit of one", 20, 0, false, 1, 1, 0, true},
+		{"limit above file count", 8, 0, false, 25, 8, 0, false},
+		{"resume skips don't count", 20, 4, true, 5, 5, 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string]string, tt.files)
+			var names []string
+			for i := 1; i <= tt.files; i++ {
+				id := fmt.Sprint(i)
+				name := fmt.Sprintf("pg%02d.rdf", i)
+				files[name] = rdfXML(ebookXML(id, "Book "+id, ""))
+				names = append(names, name)
+			}
+			paths := writeRDFFiles(t, t.TempDir(), files, names...)
+
+			// A first run imports the files that resume then finds done
+			db := newTestDB(t)
+			if tt.existing > 0 {
+				if err := NewImporter(db, 3, 4, true).Import(context.Background(), paths[:tt.existing]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// One reader takes the files in order, so the skipped ones are
+			// all seen before the limit is reached
+			importer := NewImporter(db, 3, 4, tt.resume)
+			importer.SetPipeline(PipelineConfig{Readers: 1})
+			importer.SetLimit(tt.limit)
+			if err := importer.Import(context.Background(), paths); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := len(bookIDs(t, db)) - tt.existing; got != tt.wantNew {
+				t.Errorf("%d books inserted, want %d", got, tt.wantNew)
+			}
+			stats := importer.Stats()
+			if stats.Successful != tt.wantNew || stats.Failed != 0 {
+				t.Errorf("Successful = %d, Failed = %d, want %d and 0", stats.Successful, stats.Failed, tt.wantNew)
+			}
+			if stats.Skipped != tt.wantSkipped {
+				t.Errorf("Skipped = %d, want %d", stats.Skipped, tt.wantSkipped)
+			}
+			if got := importer.LimitReached(); got != tt.wantReached {
+				t.Errorf("LimitReached = %v, want %v", got, tt.wantReached)
+			}
+		})
+	}
+}
+
+func TestExtractIDFromPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{"cache/epub/1234/pg1234.rdf", "1234", true},
+		{"/tmp/rdf/cache_epub_1234_pg1234.rdf", "1234", true},
+		{`C:\rdf\pg7.rdf`, "7", true},
+		{"pg42.rdf", "42", true},
+		{"cache/epub/1234/pg1234.rdf.bak", "", false},
+		{"cache/epub/1234/book1234.rdf", "", false},
+		{"cache/epub/1234/xpg1234.rdf", "", false},
+		{"cache/epub/pg.rdf", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := extractIDFromPath(tt.path)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("extractIDFromPath(%q) = %q, %v; want %q, %v", tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// BenchmarkResumeSkip measures a resumed sharded import in which every book
+// is already stored. Shards keep no file progress, so books are skipped by
+// the ID in their file name before parsing, or else only once parsed.
+func BenchmarkResumeSkip(b *testing.B) {
+	const files = 200
+	discardStdout(b)
+	tests := []struct {
+		name string
+		file func(id int) string
+	}{
+		{"file name", func(id int) string { return fmt.Sprintf("pg%d.rdf", id) }},
+		{"parse", func(id int) string { return fmt.Sprintf("book%d.rdf", id) }},
+	}
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			docs := make(map[string]string, files)
+			var names []string
+			for id := 1; id <= files; id++ {
+				name := tt.file(id)
+				docs[name] = fixtureRDF(b, fmt.Sprint(id))
+				names = append(names, name)
+			}
+			paths := writeRDFFiles(b, b.TempDir(), docs, names...)
+
+			shards := NewShardSet(filepath.Join(b.TempDir(), "pg.db"), 100, nil)
+			defer shards.Close("completed")
+			first := newTestImporter(nil)
+			first.SetShards(shards)
+			if err := first.Import(context.Background(), paths); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				importer := NewImporter(nil, 3, 4, true)
+				importer.SetShards(shards)
+				if err := importer.Import(context.Background(), paths); err != nil {
+					b.Fatal(err)
+				}
+				if skipped := importer.Stats().Skipped; skipped != files {
+					b.Fatalf("%d files skipped, want %d", skipped, files)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*files), "ns/file")
+		})
+	}
+}
+
+// BenchmarkImportPipeline times a full import of fixture files through the
+// read, parse and write stages under different pipeline sizes. "lockstep"
+// has one reader and single-slot buffers, so each stage waits on the next
+// much as the import did before the stages were split.
+func BenchmarkImportPipeline(b *testing.B) {
+	const files = 200
+	discardStdout(b)
+	docs := make(map[string]string, files)
+	var names []string
+	for id := 1; id <= files; id++ {
+		name := fmt.Sprintf("pg%d.rdf", id)
+		docs[name] = fixtureRDF(b, fmt.Sprint(id))
+		names = append(names, name)
+	}
+	paths := writeRDFFiles(b, b.TempDir(), docs, names...)
+
+	tests := []struct {
+		name     string
+		pipeline PipelineConfig
+	}{
+		{"lockstep", PipelineConfig{Readers: 1, ReadBuffer: 1, ParseBuffer: 1}},
+		{"default", PipelineConfig{}},
+		{"4 readers", PipelineConfig{Readers: 4}},
+		{"deep buffers", PipelineConfig{Readers: 2, ReadBuffer: 256, ParseBuffer: 256}},
+	}
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// Every iteration imports into a new database
+				b.StopTimer()
+				db, err := NewDB(filepath.Join(b.TempDir(), "bench.db"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				importer := NewImporter(db, 100, 4, false)
+				importer.SetPipeline(tt.pipeline)
+				b.StartTimer()
+
+				if err := importer.Import(context.Background(), paths); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				if stats := importer.Stats(); stats.Successful != files {
+					b.Fatalf("%d books imported, want %d", stats.Successful, files)
+				}
+				db.Close()
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*files), "ns/file")
+		})
+	}
+}
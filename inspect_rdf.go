@@ -1,27 +1,41 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
-// InspectRDF inspects RDF files from the archive and displays their structure
-func InspectRDF() {
-	rdfFiles, cleanup, err := ExtractRDFFiles("rdf-files.tar.zip")
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
-	}
-	defer cleanup()
+// InspectRDF displays the structure of one RDF file from the archive, and what
+// the parser makes of it. The file is chosen by name with file (see
+// selectRDFFile), or else by its position index in the archive. A file that
+// exists on disk is inspected directly, without extracting the archive.
+func InspectRDF(zipPath, extractDir string, reextract bool, file string, index int) {
+	path := file
+	if info, err := os.Stat(file); file == "" || err != nil || info.IsDir() {
+		rdfFiles, cleanup, err := ExtractRDFFiles(zipPath, extractDir, reextract)
+		if errors.Is(err, ErrNoRDFFiles) {
+			fmt.Println("No RDF files found")
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer cleanup()
 
-	if len(rdfFiles) == 0 {
-		fmt.Println("No RDF files found")
-		os.Exit(1)
+		path, err = selectRDFFile(rdfFiles, file, index)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
-	// Read first RDF file
-	content, err := os.ReadFile(rdfFiles[0])
+	// Read the selected RDF file
+	content, err := os.ReadFile(path)
 	if err != nil {
 		fmt.Printf("Error reading file: %v\n", err)
 		os.Exit(1)
@@ -34,7 +48,7 @@ func InspectRDF() {
 	subjectIdx := strings.Index(text, "subject")
 	formatIdx := strings.Index(text, "format")
 
-	fmt.Printf("Sample RDF file (%s):\n", rdfFiles[0])
+	fmt.Printf("Sample RDF file (%s):\n", path)
 	fmt.Println(strings.Repeat("=", 80))
 
 	// Show context around subject if found
@@ -77,7 +91,7 @@ func InspectRDF() {
 	fmt.Println(strings.Repeat("=", 80))
 
 	// Try parsing it
-	book, err := ParseRDFFile(rdfFiles[0])
+	book, err := ParseRDFFile(path)
 	if err != nil {
 		fmt.Printf("\nParse error: %v\n", err)
 	} else {
@@ -86,6 +100,102 @@ func InspectRDF() {
 		fmt.Printf("  Title: %s\n", book.Title)
 		fmt.Printf("  Authors: %d\n", len(book.Authors))
 		fmt.Printf("  Subjects: %d\n", len(book.Subjects))
+		fmt.Printf("  Classifications: %d\n", len(book.Classifications))
 		fmt.Printf("  Formats: %d\n", len(book.Formats))
 	}
 }
+
+// selectRDFFile picks the RDF file to inspect. A non-empty name matches a
+// file by its path, its base name such as "pg1234.rdf", or its name in the
+// tar such as "cache/epub/1234/pg1234.rdf", which extraction flattens.
+// Otherwise the file at index is returned.
+func selectRDFFile(rdfFiles []string, name string, index int) (string, error) {
+	if name != "" {
+		flattened := strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+		for _, file := range rdfFiles {
+			base := filepath.Base(file)
+			if file == name || base == name || base == flattened || strings.HasSuffix(base, "_"+name) {
+				return file, nil
+			}
+		}
+		return "", fmt.Errorf("no RDF file named %q among %d files", name, len(rdfFiles))
+	}
+	if index < 0 || index >= len(rdfFiles) {
+		return "", fmt.Errorf("index %d is out of range: there are %d RDF files", index, len(rdfFiles))
+	}
+	return rdfFiles[index], nil
+}
+
+// coverageFields are the book fields InspectCoverage counts, in report order,
+// each with the test for whether a parsed book has it
+var coverageFields = []struct {
+	name    string
+	present func(*Book) bool
+}{
+	{"title", func(b *Book) bool { return strings.TrimSpace(b.Title) != "" }},
+	{"authors", func(b *Book) bool { return len(b.Authors) > 0 }},
+	{"contributors", func(b *Book) bool { return len(b.Contributors) > 0 }},
+	{"language", func(b *Book) bool { return b.Language != "" }},
+	{"subjects", func(b *Book) bool { return len(b.Subjects) > 0 }},
+	{"classifications", func(b *Book) bool { return len(b.Classifications) > 0 }},
+	{"bookshelves", func(b *Book) bool { return len(b.Bookshelves) > 0 }},
+	{"formats", func(b *Book) bool { return len(b.Formats) > 0 }},
+	{"cover", func(b *Book) bool { return b.CoverURL != "" }},
+	{"type", func(b *Book) bool { return b.Type != "" }},
+	{"publisher", func(b *Book) bool { return b.Publisher != "" }},
+	{"license", func(b *Book) bool { return b.License != "" }},
+	{"rights", func(b *Book) bool { return b.Rights != "" }},
+	{"issued", func(b *Book) bool { return b.IssuedDate != "" }},
+	{"modified", func(b *Book) bool { return b.Modified != "" }},
+	{"downloads", func(b *Book) bool { return b.DownloadCount > 0 }},
+	{"description", func(b *Book) bool { return strings.TrimSpace(b.Description) != "" }},
+	{"summary", func(b *Book) bool { return b.Summary != "" }},
+	{"reading ease", func(b *Book) bool { return b.ReadingEaseScore != "" }},
+}
+
+// FieldCoverage counts how many parsed books had each of coverageFields
+type FieldCoverage struct {
+	Files  int
+	Parsed int
+	Failed int
+	// Present is indexed like coverageFields
+	Present []int
+}
+
+// InspectCoverage parses the first n RDF files (all of them if n exceeds the
+// count) and counts how many books had each field, to show systematic parse
+// gaps across an archive without printing any file. Files that fail to parse
+// are counted but add to no field.
+func InspectCoverage(rdfFiles []string, n int) *FieldCoverage {
+	if n < len(rdfFiles) {
+		rdfFiles = rdfFiles[:n]
+	}
+	coverage := &FieldCoverage{Files: len(rdfFiles), Present: make([]int, len(coverageFields))}
+	for _, file := range rdfFiles {
+		book, err := ParseRDFFile(file)
+		if err != nil {
+			coverage.Failed++
+			continue
+		}
+		coverage.Parsed++
+		for i, field := range coverageFields {
+			if field.present(book) {
+				coverage.Present[i]++
+			}
+		}
+	}
+	return coverage
+}
+
+// Print writes one line per field with its count and percentage of the
+// books parsed
+func (c *FieldCoverage) Print(w io.Writer) {
+	fmt.Fprintf(w, "Field coverage over %d files (%d parsed, %d failed):\n", c.Files, c.Parsed, c.Failed)
+	for i, field := range coverageFields {
+		percent := 0.0
+		if c.Parsed > 0 {
+			percent = float64(c.Present[i]) / float64(c.Parsed) * 100
+		}
+		fmt.Fprintf(w, "  %-16s %8d  %6.1f%%\n", field.name, c.Present[i], percent)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// integritySampleSize is how many offending IDs are reported per issue
+const integritySampleSize = 5
+
+// IntegrityIssue is one kind of orphaned row found by CheckIntegrity
+type IntegrityIssue struct {
+	Check       string
+	Description string
+	Count       int
+	// SampleIDs holds up to integritySampleSize of the IDs described by
+	// Description, lowest first
+	SampleIDs []int64
+}
+
+// integrityCheck is an anti-join selecting the rows that break one reference
+type integrityCheck struct {
+	check       string
+	description string
+	// id is the column reported in SampleIDs; from is the FROM clause,
+	// including its WHERE, that selects the offending rows
+	id   string
+	from string
+}
+
+// integrityChecks lists every reference CheckIntegrity verifies. SQLite
+// doesn't enforce foreign keys unless PRAGMA foreign_keys is on, so rows can
+// outlive what they point to, and lookup rows can lose every link.
+var integrityChecks = []integrityCheck{
+	{"book_authors_missing_book", "book_authors rows for missing books (book IDs)",
+		"l.book_id", "book_authors l LEFT JOIN books b ON b.id = l.book_id WHERE b.id IS NULL"},
+	{"book_authors_missing_author", "book_authors rows for missing authors (author IDs)",
+		"l.author_id", "book_authors l LEFT JOIN authors a ON a.id = l.author_id WHERE a.id IS NULL"},
+	{"book_contributors_missing_book", "book_contributors rows for missing books (book IDs)",
+		"l.book_id", "book_contributors l LEFT JOIN books b ON b.id = l.book_id WHERE b.id IS NULL"},
+	{"book_contributors_missing_author", "book_contributors rows for missing authors (author IDs)",
+		"l.author_id", "book_contributors l LEFT JOIN authors a ON a.id = l.author_id WHERE a.id IS NULL"},
+	{"book_subjects_missing_book", "book_subjects rows for missing books (book IDs)",
+		"l.book_id", "book_subjects l LEFT JOIN books b ON b.id = l.book_id WHERE b.id IS NULL"},
+	{"book_subjects_missing_subject", "book_subjects rows for missing subjects (subject IDs)",
+		"l.subject_id", "book_subjects l LEFT JOIN subjects s ON s.id = l.subject_id WHERE s.id IS NULL"},
+	{"book_bookshelves_missing_book", "book_bookshelves rows for missing books (book IDs)",
+		"l.book_id", "book_bookshelves l LEFT JOIN books b ON b.id = l.book_id WHERE b.id IS NULL"},
+	{"book_bookshelves_missing_bookshelf", "book_bookshelves rows for missing bookshelves (bookshelf IDs)",
+		"l.bookshelf_id", "book_bookshelves l LEFT JOIN bookshelves s ON s.id = l.bookshelf_id WHERE s.id IS NULL"},
+	{"book_classifications_missing_book", "book_classifications rows for missing books (book IDs)",
+		"l.book_id", "book_classifications l LEFT JOIN books b ON b.id = l.book_id WHERE b.id IS NULL"},
+	{"book_languages_missing_book", "book_languages rows for missing books (book IDs)",
+		"l.book_id", "book_languages l LEFT JOIN books b ON b.id = l.book_id WHERE b.id IS NULL"},
+	{"formats_missing_book", "formats with no book (format IDs)",
+		"f.id", "formats f LEFT JOIN books b ON b.id = f.book_id WHERE b.id IS NULL"},
+	{"raw_rdf_missing_book", "raw_rdf rows for missing books (book IDs)",
+		"r.book_id", "raw_rdf r LEFT JOIN books b ON b.id = r.book_id WHERE b.id IS NULL"},
+	{"books_missing_publisher", "books pointing at a missing publisher (book IDs)",
+		"b.id", "books b LEFT JOIN publishers p ON p.id = b.publisher_id WHERE b.publisher_id IS NOT NULL AND p.id IS NULL"},
+	{"unlinked_authors", "authors with no books or contributions (author IDs)",
+		"a.id", "authors a WHERE NOT EXISTS (SELECT 1 FROM book_authors l WHERE l.author_id = a.id) AND NOT EXISTS (SELECT 1 FROM book_contributors l WHERE l.author_id = a.id)"},
+	{"unlinked_subjects", "subjects with no books (subject IDs)",
+		"s.id", "subjects s WHERE NOT EXISTS (SELECT 1 FROM book_subjects l WHERE l.subject_id = s.id)"},
+	{"unlinked_bookshelves", "bookshelves with no books (bookshelf IDs)",
+		"s.id", "bookshelves s WHERE NOT EXISTS (SELECT 1 FROM book_bookshelves l WHERE l.bookshelf_id = s.id)"},
+}
+
+// CheckIntegrity looks for orphaned rows: links to missing books, authors,
+// subjects or bookshelves, formats and raw RDF without a book, and lookup
+// rows no book uses. It returns one issue per check that found any rows, in
+// the order the checks are listed; none means the references are intact.
+func (db *DB) CheckIntegrity() ([]IntegrityIssue, error) {
+	var issues []IntegrityIssue
+	for _, check := range integrityChecks {
+		var count int
+		if err := db.conn.QueryRow("SELECT COUNT(*) FROM " + check.from).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to check %s: %w", check.check, err)
+		}
+		if count == 0 {
+			continue
+		}
+
+		rows, err := db.conn.Query(db.rebind(fmt.Sprintf("SELECT DISTINCT %s FROM %s ORDER BY 1 LIMIT ?", check.id, check.from)), integritySampleSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample %s: %w", check.check, err)
+		}
+		issue := IntegrityIssue{Check: check.check, Description: check.description, Count: count}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan %s: %w", check.check, err)
+			}
+			issue.SampleIDs = append(issue.SampleIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to sample %s: %w", check.check, err)
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// PrintIntegrityIssues writes the result of CheckIntegrity
+func PrintIntegrityIssues(w io.Writer, issues []IntegrityIssue) {
+	fmt.Fprintln(w, "\nReferential integrity:")
+	if len(issues) == 0 {
+		fmt.Fprintln(w, "  ✅ no orphaned rows")
+		return
+	}
+	for _, issue := range issues {
+		fmt.Fprintf(w, "  ❌ %s: %d (e.g. %v)\n", issue.Description, issue.Count, issue.SampleIDs)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import "strings"
+
+// iso639Codes maps ISO 639-1 and ISO 639-2 (bibliographic and terminology)
+// codes of languages common in the Gutenberg catalog to their ISO 639-1 code
+var iso639Codes = map[string]string{
+	"af": "af", "afr": "af",
+	"ar": "ar", "ara": "ar",
+	"bg": "bg", "bul": "bg",
+	"ca": "ca", "cat": "ca",
+	"cs": "cs", "cze": "cs", "ces": "cs",
+	"cy": "cy", "wel": "cy", "cym": "cy",
+	"da": "da", "dan": "da",
+	"de": "de", "ger": "de", "deu": "de",
+	"el": "el", "gre": "el", "ell": "el",
+	"en": "en", "eng": "en",
+	"eo": "eo", "epo": "eo",
+	"es": "es", "spa": "es",
+	"et": "et", "est": "et",
+	"fa": "fa", "per": "fa", "fas": "fa",
+	"fi": "fi", "fin": "fi",
+	"fr": "fr", "fre": "fr", "fra": "fr",
+	"fy": "fy", "fry": "fy",
+	"ga": "ga", "gle": "ga",
+	"gl": "gl", "glg": "gl",
+	"he": "he", "heb": "he",
+	"hu": "hu", "hun": "hu",
+	"ia": "ia", "ina": "ia",
+	"is": "is", "ice": "is", "isl": "is",
+	"it": "it", "ita": "it",
+	"ja": "ja", "jpn": "ja",
+	"ko": "ko", "kor": "ko",
+	"la": "la", "lat": "la",
+	"lt": "lt", "lit": "lt",
+	"nl": "nl", "dut": "nl", "nld": "nl",
+	"no": "no", "nor": "no",
+	"pl": "pl", "pol": "pl",
+	"pt": "pt", "por": "pt",
+	"ro": "ro", "rum": "ro", "ron": "ro",
+	"ru": "ru", "rus": "ru",
+	"sa": "sa", "san": "sa",
+	"sr": "sr", "srp": "sr",
+	"sv": "sv", "swe": "sv",
+	"tl": "tl", "tgl": "tl",
+	"zh": "zh", "chi": "zh", "zho": "zh",
+}
+
+// normalizeLanguage maps a language value to its ISO 639-1 code. It accepts
+// two- and three-letter codes in any case and resource URIs ending in a code,
+// such as ".../ISO639-2/eng". Unknown values are returned trimmed but
+// otherwise unchanged.
+func normalizeLanguage(value string) string {
+	value = strings.TrimSpace(value)
+	code := strings.ToLower(strings.TrimRight(value, "/"))
+	if i := strings.LastIndexAny(code, "/#"); i >= 0 {
+		code = code[i+1:]
+	}
+	if normalized, ok := iso639Codes[code]; ok {
+		return normalized
+	}
+	return value
+}
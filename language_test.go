@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"en", "en"},
+		{"eng", "en"},
+		{"ENG", "en"},
+		{" fr ", "fr"},
+		{"ger", "de"},
+		{"deu", "de"},
+		{"http://id.loc.gov/vocabulary/iso639-2/eng", "en"},
+		{"http://purl.org/dc/terms/ISO639-2/fre/", "fr"},
+		{"http://lexvo.org/id/iso639-3#lat", "la"},
+		{"enm", "enm"},
+		{"Klingon", "Klingon"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeLanguage(tt.value); got != tt.want {
+			t.Errorf("normalizeLanguage(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseRDFNormalizesLanguages(t *testing.T) {
+	resource := func(uri string) string {
+		return `<dcterms:language rdf:resource="` + uri + `"/>`
+	}
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"two-letter", languageXML("en"), []string{"en"}},
+		{"three-letter", languageXML("eng"), []string{"en"}},
+		{"URI value", languageXML("http://id.loc.gov/vocabulary/iso639-2/ger"), []string{"de"}},
+		{"URI resource", resource("http://id.loc.gov/vocabulary/iso639-2/fre"), []string{"fr"}},
+		{"several", languageXML("eng") + languageXML("lat"), []string{"en", "la"}},
+		{"unknown", languageXML("enm"), []string{"enm"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := parseTestRDF(t, rdfXML(ebookXML("1", "One", tt.body)))
+			if fmt.Sprint(book.Languages) != fmt.Sprint(tt.want) {
+				t.Errorf("Languages = %q, want %q", book.Languages, tt.want)
+			}
+			if book.Language != tt.want[0] {
+				t.Errorf("Language = %q, want %q", book.Language, tt.want[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/term"
+)
+
+// consoleWriter serializes what the progress bar and the logger write to the
+// same stream. The bar redraws its line without a trailing newline, so log
+// records are started on a fresh line rather than appended to the bar.
+type consoleWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	midLine bool
+}
+
+// stderr is shared by the import progress bars and the slog handler
+var stderr = &consoleWriter{w: os.Stderr}
+
+// Write writes bar output as is
+func (c *consoleWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.write(p)
+}
+
+// write writes p and remembers whether it left a line unfinished
+func (c *consoleWriter) write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if n > 0 {
+		c.midLine = p[n-1] != '\n'
+	}
+	return n, err
+}
+
+// records returns a writer for log records that begins each on a new line
+func (c *consoleWriter) records() io.Writer {
+	return recordWriter{c}
+}
+
+// recordWriter is the log record side of a consoleWriter
+type recordWriter struct {
+	c *consoleWriter
+}
+
+// Write writes one log record, first ending a line left open by the bar
+func (r recordWriter) Write(p []byte) (int, error) {
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+	if r.c.midLine {
+		if _, err := r.c.write([]byte("\n")); err != nil {
+			return 0, err
+		}
+	}
+	return r.c.write(p)
+}
+
+// progressHidden turns every progress bar off, as import --no-progress does
+var progressHidden bool
+
+// progressVisible reports whether progress bars are drawn: only when stderr,
+// where they draw, is a terminal. Piped to a file or a cron log, the bar's
+// redraws would leave a line of control codes for every update.
+func progressVisible() bool {
+	return !progressHidden && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// newProgressBar is progressbar.Default drawing on stderr, so log records
+// written during an import don't land in the middle of the bar. The bar still
+// counts but draws nothing when progressVisible is false.
+func newProgressBar(max int64, description string) *progressbar.ProgressBar {
+	return progressbar.NewOptions64(
+		max,
+		progressbar.OptionSetVisibility(progressVisible()),
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionSetWriter(stderr),
+		progressbar.OptionSetWidth(10),
+		progressbar.OptionShowTotalBytes(true),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowIts(),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(stderr, "\n")
+		}),
+		progressbar.OptionSpinnerType(14),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+	)
+}
+
+// setupLogging routes diagnostics to stderr through log/slog. format is
+// "text" (key=value lines) or "json" (one object per line); level is debug,
+// info, warn or error. Messages still written with the log package, such as
+// the errors that end a command, become error records.
+func setupLogging(format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q (use debug, info, warn or error)", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(stderr.records(), opts)
+	case "json":
+		handler = slog.NewJSONHandler(stderr.records(), opts)
+	default:
+		return fmt.Errorf("invalid log format %q (use text or json)", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	log.SetFlags(0)
+	log.SetOutput(slog.NewLogLogger(handler, slog.LevelError).Writer())
+	return nil
+}
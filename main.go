@@ -1,26 +1,194 @@
 package main
 
 import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 func main() {
-	// Parse command-line flags
-	dbPath := flag.String("db", "pg.db", "Path to SQLite database file")
-	zipPath := flag.String("zip", "rdf-files.tar.zip", "Path to RDF zip file")
-	batchSize := flag.Int("batch-size", 1000, "Number of records per batch")
-	workers := flag.Int("workers", 4, "Number of concurrent workers")
-	resume := flag.Bool("resume", false, "Skip already imported books")
-	flag.Parse()
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "import":
+		runImport(os.Args[2:])
+	case "verify":
+		runVerify(os.Args[2:])
+	case "inspect":
+		runInspect(os.Args[2:])
+	case "schema":
+		runSchema(os.Args[2:])
+	case "merge":
+		runMerge(os.Args[2:])
+	case "stats":
+		runStats(os.Args[2:])
+	case "repl":
+		runREPL(os.Args[2:])
+	case "check-formats":
+		runCheckFormats(os.Args[2:])
+	case "reparse":
+		runReparse(os.Args[2:])
+	case "dedupe-report":
+		runDedupeReport(os.Args[2:])
+	case "export":
+		runExport(os.Args[2:])
+	case "search":
+		runSearch(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		usage()
+	default:
+		if strings.HasPrefix(os.Args[1], "-") {
+			fmt.Fprintf(os.Stderr, "Import flags now follow the import command, e.g. %s import %s\n\n", os.Args[0], strings.Join(os.Args[1:], " "))
+		} else {
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", os.Args[1])
+		}
+		usage()
+		os.Exit(2)
+	}
+}
+
+// usage lists the commands; each prints its own flags with -h
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s <command> [flags]
+
+Commands:
+  import         Import an RDF archive or directory into a database
+  verify         Check table counts and sample books in a database
+  inspect        Show the raw and parsed form of the first RDF file in an archive
+  export         Write the catalog as JSON lines, CSV or a SQL dump
+  search         Full-text search of titles, descriptions and summaries
+  repl           Query a database interactively
+  stats          Print catalog statistics
+  schema         Print a database's schema
+  merge          Copy every book from one database into another
+  reparse        Refresh books from their stored raw RDF
+  check-formats  List formats with missing, malformed or dead URLs
+  dedupe-report  List clusters of books that are likely the same work
+
+Run '%s <command> -h' for a command's flags.
+`, os.Args[0], os.Args[0])
+}
+
+// runImport imports an RDF archive or directory into a database
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dbPath := fs.String("db", "pg.db", "Path to SQLite database file, or a postgres:// URL")
+	driver := fs.String("driver", "", "Database driver: sqlite or postgres (default: detected from -db)")
+	zipPath := fs.String("zip", "rdf-files.tar.zip", "Path to RDF zip file, or a directory of RDF files")
+	extractDir := fs.String("extract-dir", "", "Directory to extract the archive into and reuse (default: <zip name>-extracted in the working directory)")
+	reExtract := fs.Bool("re-extract", false, "Delete previously extracted RDF files and extract the archive again")
+	batchSize := fs.Int("batch-size", 1000, "Number of records per batch")
+	workers := fs.String("workers", "4", "Number of concurrent parsing workers, or auto (or 0) for one per CPU")
+	readers := fs.Int("readers", DefaultReaders, "Number of goroutines reading RDF files for the parsing workers")
+	readBuffer := fs.Int("read-buffer", 0, "Read files that may wait for a parsing worker (0: 4 per worker)")
+	parseBuffer := fs.Int("parse-buffer", 0, "Parsed books that may wait to be written (0: 2 per worker)")
+	resume := fs.Bool("resume", false, "Skip already imported books")
+	dumpUnmapped := fs.Bool("dump-unmapped", false, "Report RDF elements not mapped to any parser field, then exit")
+	sample := fs.Int("sample", 100, "Number of files to scan with -dump-unmapped")
+	maxRetries := fs.Int("max-retries", DefaultMaxRetries, "Times to retry a write that fails because the SQLite database is busy or locked")
+	retryDelay := fs.Duration("retry-delay", DefaultRetryDelay, "Delay before the first busy retry; doubles on each further attempt")
+	journalMode := fs.String("journal-mode", "WAL", "SQLite journal mode: DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF")
+	synchronous := fs.String("synchronous", "NORMAL", "SQLite synchronous mode: OFF (fastest, unsafe on power loss), NORMAL, FULL or EXTRA")
+	optimize := fs.Bool("optimize", false, "After importing, rebuild the database with VACUUM and refresh query statistics with ANALYZE, reporting the file size before and after")
+	emptyAsNull := fs.Bool("empty-as-null", false, "Store empty or whitespace-only text fields as NULL instead of empty strings")
+	validateArchive := fs.Bool("validate-archive", false, "Parse and validate every file without touching the database, then exit")
+	archiveURL := fs.String("url", "", "Download the archive from this URL to -zip before importing")
+	fetch := fs.Bool("fetch", false, "Download the Project Gutenberg catalog archive to -zip if it is missing or has changed upstream")
+	fetchForce := fs.Bool("fetch-force", false, "Like -fetch, but always download the archive")
+	downloadRetries := fs.Int("download-retries", 3, "Number of times to retry (and resume) a failed download")
+	checksumURL := fs.String("checksum-url", "", "URL of a SHA-256 checksum file used to verify the download")
+	shardByLanguage := fs.Bool("shard-by-language", false, "Write each language to its own database derived from -db (e.g. pg-en.db)")
+	requireSubject := fs.String("require-subject", "", "Only import books with a subject matching this value")
+	fs.StringVar(requireSubject, "subject-contains", "", "Same as -require-subject")
+	bookshelf := fs.String("bookshelf", "", "Only import books on this bookshelf (exact, case-insensitive)")
+	excludeSubject := fs.String("exclude-subject", "", "Skip books with a subject matching this value")
+	since := fs.String("since", "", "Only import books whose record was modified on or after this date (YYYY-MM-DD or RFC 3339); books without a modified date are imported")
+	languages := fs.String("languages", "", "Only import books whose primary language is in this comma-separated list, e.g. en,fr (default: all)")
+	subjectExact := fs.Bool("subject-exact", false, "Match -require-subject/-exclude-subject exactly instead of by substring")
+	warnAuthors := fs.Int("warn-authors", DefaultRelationThresholds().Authors, "Warn about books with more authors than this (0 to disable)")
+	warnSubjects := fs.Int("warn-subjects", DefaultRelationThresholds().Subjects, "Warn about books with more subjects than this (0 to disable)")
+	warnFormats := fs.Int("warn-formats", DefaultRelationThresholds().Formats, "Warn about books with more formats than this (0 to disable)")
+	twoPhase := fs.Bool("two-phase", false, "Commit each batch's authors and subjects before inserting its books, keeping transactions small")
+	manifestIn := fs.String("manifest", "", "Only import books that are new or changed relative to this manifest (JSON of gutenberg_id to hash)")
+	manifestOut := fs.String("manifest-out", "", "Write the updated manifest to this path after importing")
+	strict := fs.Bool("strict", false, "Fail books with invalid data (empty title, negative download count, death before birth, malformed format URL) instead of importing them with warnings")
+	storeRaw := fs.Bool("store-raw", false, "Also save each book's original RDF, gzipped, in the raw_rdf table so reparse can rerun the parser later (adds to the database size)")
+	failOnDuplicate := fs.Bool("fail-on-duplicate", false, "Fail files whose Gutenberg ID an earlier file in the same import had, instead of importing them over it with a warning")
+	progressInterval := fs.Duration("progress-interval", 0, "Log processed/total and the current rate at this interval, e.g. 30s (0: every 30s when stderr isn't a terminal, otherwise never)")
+	noProgress := fs.Bool("no-progress", false, "Draw no progress bar, and log progress only if -progress-interval is set")
+	metricsJSON := fs.String("metrics-json", "", "Write the final import statistics to this path as JSON")
+	trimFields := fs.String("trim-fields", "default", "Fields to trim: default, all, none, or a list like \"all,-summary\"")
+	stream := fs.Bool("stream", false, "Read RDF files straight from the archive instead of extracting them to disk first")
+	stripHTML := fs.Bool("strip-html", false, "Remove HTML tags from descriptions, summaries and production notes")
+	logLevel := fs.String("log-level", "info", "Minimum level of diagnostics logged to stderr: debug, info, warn or error")
+	logFormat := fs.String("log-format", "text", "Format of diagnostics logged to stderr: text or json")
+	errorLogPath := fs.String("error-log", "", "Append every failed file and its full error to this file as it happens")
+	limit := fs.Int("limit", 0, "Stop after processing this many files; files skipped by -resume don't count (0 for no limit)")
+	dryRun := fs.Bool("dry-run", false, "Parse and validate every file and print the summary without opening or writing the database")
+	fs.Parse(args)
+
+	if err := setupLogging(*logFormat, *logLevel); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	progressHidden = *noProgress
 
 	// Validate inputs
 	if *zipPath == "" {
 		log.Fatal("Error: zip file path is required")
 	}
 
+	if *archiveURL != "" && (*fetch || *fetchForce) {
+		log.Fatal("Error: -url cannot be combined with -fetch or -fetch-force")
+	}
+
+	if *archiveURL != "" {
+		fmt.Printf("Downloading archive: %s\n", *archiveURL)
+		err := DownloadArchive(*archiveURL, *zipPath, DownloadOptions{
+			Retries:     *downloadRetries,
+			RetryDelay:  2 * time.Second,
+			ChecksumURL: *checksumURL,
+		})
+		if err != nil {
+			log.Fatalf("Failed to download archive: %v", err)
+		}
+	}
+
+	if *fetch || *fetchForce {
+		fmt.Printf("Checking catalog archive: %s\n", CatalogArchiveURL)
+		downloaded, err := FetchArchive(CatalogArchiveURL, *zipPath, *fetchForce, DownloadOptions{
+			Retries:     *downloadRetries,
+			RetryDelay:  2 * time.Second,
+			ChecksumURL: *checksumURL,
+		})
+		switch {
+		case err != nil:
+			// Keep going with the archive already on disk, if there is one
+			if _, statErr := os.Stat(*zipPath); statErr != nil {
+				log.Fatalf("Failed to fetch archive: %v", err)
+			}
+			slog.Warn("failed to fetch archive; using the existing copy", "path", *zipPath, "error", err)
+		case downloaded:
+			fmt.Printf("Downloaded archive to: %s\n", *zipPath)
+		default:
+			fmt.Printf("Archive is up to date: %s\n", *zipPath)
+		}
+	}
+
 	if _, err := os.Stat(*zipPath); os.IsNotExist(err) {
 		log.Fatalf("Error: zip file not found: %s", *zipPath)
 	}
@@ -29,46 +197,690 @@ func main() {
 		log.Fatal("Error: batch-size must be greater than 0")
 	}
 
-	if *workers <= 0 {
-		log.Fatal("Error: workers must be greater than 0")
+	workerCount, err := ParseWorkers(*workers)
+	if err != nil {
+		log.Fatalf("Error: -workers: %v", err)
 	}
 
-	// Initialize database
-	fmt.Printf("Initializing database: %s\n", *dbPath)
-	db, err := NewDB(*dbPath)
+	if *readers <= 0 {
+		log.Fatal("Error: readers must be greater than 0")
+	}
+	if *readBuffer < 0 || *parseBuffer < 0 {
+		log.Fatal("Error: read-buffer and parse-buffer must not be negative")
+	}
+
+	if *limit < 0 {
+		log.Fatal("Error: limit must not be negative")
+	}
+	sqliteOpts, err := ParseSQLiteOptions(*journalMode, *synchronous)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		log.Fatalf("Error: %v", err)
+	}
+	sinceTime, err := ParseSince(*since)
+	if err != nil {
+		log.Fatalf("Error: -since: %v", err)
+	}
+	if *progressInterval < 0 {
+		log.Fatal("Error: progress-interval must not be negative")
 	}
-	defer db.Close()
 
-	// Extract RDF files
-	fmt.Printf("Extracting RDF files from: %s\n", *zipPath)
-	rdfFiles, cleanup, err := ExtractRDFFiles(*zipPath)
+	if *maxRetries < 0 {
+		log.Fatal("Error: max-retries must not be negative")
+	}
+
+	trimConfig, err := ParseTrimFields(*trimFields)
 	if err != nil {
-		log.Fatalf("Failed to extract RDF files: %v", err)
+		log.Fatalf("Error: %v", err)
+	}
+
+	if *driver == "" {
+		*driver = DetectDriver(*dbPath)
+	}
+	if *driver != DriverSQLite && *driver != DriverPostgres {
+		log.Fatalf("Error: unsupported driver %q (use sqlite or postgres)", *driver)
+	}
+	if *shardByLanguage && *driver != DriverSQLite {
+		log.Fatal("Error: -shard-by-language requires the sqlite driver")
+	}
+	if *shardByLanguage && *twoPhase {
+		log.Fatal("Error: -two-phase cannot be combined with -shard-by-language")
+	}
+	if *dryRun && (*resume || *shardByLanguage || *manifestOut != "" || *optimize) {
+		log.Fatal("Error: -dry-run cannot be combined with -resume, -shard-by-language, -manifest-out or -optimize")
+	}
+
+	if *dumpUnmapped {
+		runDumpUnmapped(*zipPath, *extractDir, *reExtract, *sample)
+		return
+	}
+
+	if *validateArchive {
+		runValidateArchive(*zipPath, *extractDir, *reExtract, workerCount)
+		return
 	}
-	defer cleanup()
 
-	fmt.Printf("Found %d RDF files\n", len(rdfFiles))
+	var manifest *Manifest
+	if *manifestIn != "" {
+		manifest, err = LoadManifest(*manifestIn)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Printf("Loaded manifest with %d books: %s\n", manifest.Len(), *manifestIn)
+	} else if *manifestOut != "" {
+		manifest = NewManifest()
+	}
+
+	// Initialize database; shards are opened lazily as languages are seen
+	var db *DB
+	var shards *ShardSet
+	if *dryRun {
+		fmt.Println("Dry run: parsing and validating only; the database is not opened")
+	} else if *shardByLanguage {
+		fmt.Printf("Sharding by language alongside: %s\n", *dbPath)
+		shards = NewShardSet(*dbPath, *batchSize, func(shard *DB) {
+			shard.SetEmptyAsNull(*emptyAsNull)
+			shard.SetRetryPolicy(*maxRetries, *retryDelay)
+			if _, err := shard.StartImportRun(*zipPath); err != nil {
+				slog.Error("failed to record import run", "error", err)
+			}
+		})
+		shards.SetSQLiteOptions(sqliteOpts)
+	} else {
+		fmt.Printf("Initializing database: %s\n", *dbPath)
+		var err error
+		db, err = NewDBWithOptions(*driver, *dbPath, sqliteOpts)
+		if err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer db.Close()
+		db.SetEmptyAsNull(*emptyAsNull)
+		db.SetRetryPolicy(*maxRetries, *retryDelay)
 
-	if len(rdfFiles) == 0 {
-		log.Fatal("No RDF files found in archive")
+		if _, err := db.StartImportRun(*zipPath); err != nil {
+			log.Fatalf("Failed to record import run: %v", err)
+		}
+	}
+
+	// Extract RDF files, or open the archive for streaming; a directory of
+	// RDF files is already on disk and is read in place either way
+	var rdfFiles []string
+	var entries <-chan RDFEntry
+	// Cancelled once the import returns, so an archive reader it stopped
+	// consuming early (e.g. at --limit) closes instead of blocking
+	streamCtx, stopStream := context.WithCancel(context.Background())
+	defer stopStream()
+	if info, err := os.Stat(*zipPath); err == nil && info.IsDir() {
+		fmt.Printf("Reading RDF files from directory: %s\n", *zipPath)
+		rdfFiles, _ = extractOrExit(*zipPath, *extractDir, false)
+		fmt.Printf("Found %d RDF files\n", len(rdfFiles))
+	} else if *stream {
+		fmt.Printf("Streaming RDF files from: %s\n", *zipPath)
+		entries, err = StreamRDFFiles(streamCtx, *zipPath)
+		if err != nil {
+			log.Fatalf("Failed to open archive: %v", err)
+		}
+	} else {
+		fmt.Printf("Extracting RDF files from: %s\n", *zipPath)
+		var cleanup func()
+		rdfFiles, cleanup = extractOrExit(*zipPath, *extractDir, *reExtract)
+		defer cleanup()
+
+		fmt.Printf("Found %d RDF files\n", len(rdfFiles))
 	}
 
 	// Create importer
-	importer := NewImporter(db, *batchSize, *workers, *resume)
+	importer := NewImporter(db, *batchSize, workerCount, *resume)
+	if shards != nil {
+		importer.SetShards(shards)
+	}
+	importer.SetParserOptions(ParserOptions{Trim: trimConfig, StripHTML: *stripHTML})
+	importer.SetTwoPhase(*twoPhase)
+	importer.SetDryRun(*dryRun)
+	importer.SetLimit(*limit)
+	importer.SetStrict(*strict)
+	importer.SetStoreRaw(*storeRaw)
+	importer.SetPipeline(PipelineConfig{
+		Readers:     *readers,
+		ReadBuffer:  *readBuffer,
+		ParseBuffer: *parseBuffer,
+	})
+	importer.SetFailOnDuplicate(*failOnDuplicate)
+	importer.SetProgressInterval(*progressInterval)
+	importer.SetRelationThresholds(RelationThresholds{
+		Authors:  *warnAuthors,
+		Subjects: *warnSubjects,
+		Formats:  *warnFormats,
+	})
+	if manifest != nil {
+		importer.SetManifest(manifest)
+	}
+	importer.SetLanguageFilter(ParseLanguageFilter(*languages))
+	importer.SetBookshelfFilter(BookshelfFilter(*bookshelf))
+	importer.SetModifiedFilter(ModifiedFilter{Since: sinceTime})
+	importer.SetSubjectFilter(SubjectFilter{
+		Require: *requireSubject,
+		Exclude: *excludeSubject,
+		Exact:   *subjectExact,
+	})
+
+	if *errorLogPath != "" {
+		errorLog, err := os.OpenFile(*errorLogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatalf("Failed to open error log: %v", err)
+		}
+		defer errorLog.Close()
+		importer.SetErrorLog(errorLog)
+	}
 
 	// Import files
-	fmt.Printf("Starting import with %d workers, batch size %d\n", *workers, *batchSize)
+	fmt.Printf("Starting import with %d workers, batch size %d\n", workerCount, *batchSize)
 	if *resume {
 		fmt.Println("Resume mode: skipping already imported books")
 	}
 
+	// Stop cleanly on Ctrl-C or SIGTERM: the writer stores the batch it holds
+	// and the import returns, leaving a database --resume can continue
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Use the concurrent import method
-	err = importer.Import(rdfFiles)
-	if err != nil {
+	if entries != nil {
+		err = importer.ImportStream(ctx, entries)
+		stopStream()
+	} else {
+		err = importer.Import(ctx, rdfFiles)
+	}
+	interrupted := errors.Is(err, context.Canceled)
+	if err != nil && !interrupted {
+		if db != nil {
+			db.FinishImportRun("failed")
+		}
+		if shards != nil {
+			shards.Close("failed")
+		}
 		log.Fatalf("Import failed: %v", err)
 	}
+	status := "completed"
+	if interrupted {
+		status = "interrupted"
+	}
+	if db != nil {
+		if err := db.FinishImportRun(status); err != nil {
+			slog.Warn("failed to record import run status", "status", status, "error", err)
+		}
+	}
 
+	if shards != nil {
+		if err := shards.Close(status); err != nil {
+			log.Fatalf("Failed to close shards: %v", err)
+		}
+		for _, path := range shards.Paths() {
+			fmt.Printf("Wrote shard: %s\n", path)
+		}
+	}
+
+	// The workers and writer are done, so the single connection has the
+	// database to itself; an interrupted import is left for --resume instead
+	if *optimize && !interrupted {
+		if db != nil {
+			if err := optimizeDatabase(db, *dbPath); err != nil {
+				log.Fatalf("Failed to optimize database: %v", err)
+			}
+		}
+		if shards != nil {
+			for _, path := range shards.Paths() {
+				shard, err := NewDBWithOptions(DriverSQLite, path, sqliteOpts)
+				if err != nil {
+					log.Fatalf("Failed to open shard %s: %v", path, err)
+				}
+				err = optimizeDatabase(shard, path)
+				shard.Close()
+				if err != nil {
+					log.Fatalf("Failed to optimize shard %s: %v", path, err)
+				}
+			}
+		}
+	}
+
+	if *metricsJSON != "" {
+		metrics := importer.Stats().Metrics()
+		metrics.Status = status
+		if err := WriteMetricsJSON(*metricsJSON, metrics); err != nil {
+			log.Fatalf("Failed to save metrics: %v", err)
+		}
+		fmt.Printf("Wrote import metrics: %s\n", *metricsJSON)
+	}
+
+	if *manifestOut != "" {
+		if err := manifest.Save(*manifestOut); err != nil {
+			log.Fatalf("Failed to save manifest: %v", err)
+		}
+		fmt.Printf("Wrote manifest with %d books: %s\n", manifest.Len(), *manifestOut)
+	}
+
+	if interrupted {
+		fmt.Println("\nImport interrupted; books stored so far are kept. Rerun with --resume to continue.")
+		if db != nil {
+			db.Close()
+		}
+		os.Exit(130)
+	}
+
+	if importer.LimitReached() {
+		fmt.Printf("\nStopped after the -limit of %d files.\n", *limit)
+	}
+	if *dryRun {
+		fmt.Println("\nDry run completed; nothing was written.")
+		return
+	}
 	fmt.Println("\nImport completed successfully!")
 }
+
+// extractOrExit extracts the archive's RDF files, exiting with a clear message
+// when extraction fails or the archive holds no RDF files
+func extractOrExit(zipPath, extractDir string, reextract bool) ([]string, func()) {
+	rdfFiles, cleanup, err := ExtractRDFFiles(zipPath, extractDir, reextract)
+	if errors.Is(err, ErrNoRDFFiles) {
+		log.Fatalf("No RDF files found in archive: %s", zipPath)
+	}
+	if err != nil {
+		log.Fatalf("Failed to extract RDF files: %v", err)
+	}
+	return rdfFiles, cleanup
+}
+
+// runDumpUnmapped scans a sample of RDF files and prints the unmapped element report
+func runDumpUnmapped(zipPath, extractDir string, reextract bool, sample int) {
+	if sample <= 0 {
+		log.Fatal("Error: sample must be greater than 0")
+	}
+
+	rdfFiles, cleanup := extractOrExit(zipPath, extractDir, reextract)
+	defer cleanup()
+
+	if len(rdfFiles) > sample {
+		rdfFiles = rdfFiles[:sample]
+	}
+
+	if err := DumpUnmapped(rdfFiles, os.Stdout); err != nil {
+		log.Fatalf("Unmapped element scan failed: %v", err)
+	}
+}
+
+// runValidateArchive parses every RDF file in the archive and exits nonzero if any failed
+func runValidateArchive(zipPath, extractDir string, reextract bool, workers int) {
+	rdfFiles, cleanup := extractOrExit(zipPath, extractDir, reextract)
+	defer cleanup()
+
+	result := ValidateArchive(rdfFiles, workers)
+	result.Print(os.Stdout)
+
+	if result.Failed() > 0 {
+		cleanup()
+		os.Exit(1)
+	}
+	fmt.Println("\nArchive is valid.")
+}
+
+// runVerify prints table counts and sample books from an imported database
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	dbPath := fs.String("db", "pg.db", "Path to SQLite database file")
+	concurrency := fs.Int("concurrency", 4, "Number of queries to run at once (1 runs them serially)")
+	fs.Parse(args)
+
+	report, err := VerifyDB(*dbPath, *concurrency)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	report.Print(os.Stdout)
+	if report.Failed() {
+		fmt.Println("\nDatabase verification failed.")
+		os.Exit(1)
+	}
+
+	// Orphaned rows are only looked for once every table can be read
+	db, err := OpenReadOnly(*dbPath)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	defer db.Close()
+	issues, err := db.CheckIntegrity()
+	if err != nil {
+		log.Fatalf("Integrity check failed: %v", err)
+	}
+	PrintIntegrityIssues(os.Stdout, issues)
+
+	if len(issues) > 0 {
+		db.Close()
+		fmt.Println("\nDatabase verification failed.")
+		os.Exit(1)
+	}
+	fmt.Println("\nDatabase verification complete!")
+}
+
+// runInspect prints the raw and parsed form of the first RDF file in an archive
+func runInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	zipPath := fs.String("zip", "rdf-files.tar.zip", "Path to RDF zip file, or a directory of RDF files")
+	extractDir := fs.String("extract-dir", "", "Directory to extract the archive into and reuse (default: <zip name>-extracted in the working directory)")
+	reExtract := fs.Bool("re-extract", false, "Delete previously extracted RDF files and extract the archive again")
+	file := fs.String("file", "", "RDF file to inspect: a path on disk, or a name in the archive such as pg1234.rdf or cache/epub/1234/pg1234.rdf")
+	index := fs.Int("index", 0, "Position of the RDF file to inspect in the archive, when -file isn't given")
+	coverage := fs.Int("coverage", 0, "Instead of dumping the first file, parse this many files and print how many had each field")
+	fs.Parse(args)
+
+	if *coverage < 0 {
+		log.Fatal("Error: coverage must not be negative")
+	}
+	if *coverage > 0 {
+		rdfFiles, cleanup := extractOrExit(*zipPath, *extractDir, *reExtract)
+		defer cleanup()
+		InspectCoverage(rdfFiles, *coverage).Print(os.Stdout)
+		return
+	}
+
+	InspectRDF(*zipPath, *extractDir, *reExtract, *file, *index)
+}
+
+// runSchema prints the live schema DDL of an existing database
+func runSchema(args []string) {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	dbPath := fs.String("db", "pg.db", "Path to SQLite database file")
+	fs.Parse(args)
+
+	db, err := OpenReadOnly(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.WriteSchema(os.Stdout); err != nil {
+		log.Fatalf("Failed to print schema: %v", err)
+	}
+}
+
+// runMerge copies all books from one database into another
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	intoPath := fs.String("into", "pg.db", "Database to merge books into (created if missing), or a postgres:// URL")
+	fromPath := fs.String("from", "", "Database to copy books from")
+	batchSize := fs.Int("batch-size", 1000, "Number of books per transaction")
+	fs.Parse(args)
+
+	if *fromPath == "" {
+		log.Fatal("Error: -from is required")
+	}
+	if *batchSize <= 0 {
+		log.Fatal("Error: batch-size must be greater than 0")
+	}
+
+	src, err := OpenReadOnly(*fromPath)
+	if err != nil {
+		log.Fatalf("Failed to open source database: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := NewDB(*intoPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer dst.Close()
+
+	fmt.Printf("Merging %s into %s\n", *fromPath, *intoPath)
+	merged, err := dst.MergeFrom(src, *batchSize)
+	if err != nil {
+		log.Fatalf("Merge failed after %d books: %v", merged, err)
+	}
+	fmt.Printf("Merged %d books\n", merged)
+}
+
+// runStats prints catalog statistics for an existing database
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	dbPath := fs.String("db", "pg.db", "Path to SQLite database file")
+	top := fs.Int("top", 10, "Number of most downloaded books, and of authors and subjects with the most books, to list (0 to skip)")
+	offset := fs.Int("offset", 0, "Number of most downloaded books to skip before listing -top")
+	fs.Parse(args)
+
+	if *top < 0 || *offset < 0 {
+		log.Fatal("Error: top and offset must not be negative")
+	}
+
+	db, err := OpenReadOnly(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.PrintStats(os.Stdout); err != nil {
+		log.Fatalf("Failed to compute stats: %v", err)
+	}
+	if *top > 0 {
+		if err := db.PrintTopBooks(os.Stdout, *top, *offset); err != nil {
+			log.Fatalf("Failed to list top books: %v", err)
+		}
+		if err := db.PrintTopAuthorsAndSubjects(os.Stdout, *top); err != nil {
+			log.Fatalf("Failed to rank authors and subjects: %v", err)
+		}
+	}
+}
+
+// runREPL starts an interactive query prompt on an existing database
+func runREPL(args []string) {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	dbPath := fs.String("db", "pg.db", "Path to SQLite database file")
+	fs.Parse(args)
+
+	db, err := OpenReadOnly(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := RunREPL(db, os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("REPL failed: %v", err)
+	}
+}
+
+// runCheckFormats lists formats with missing, malformed or (with -http) dead URLs
+func runCheckFormats(args []string) {
+	fs := flag.NewFlagSet("check-formats", flag.ExitOnError)
+	dbPath := fs.String("db", "pg.db", "Path to SQLite database file")
+	checkHTTP := fs.Bool("http", false, "Send a HEAD request to every URL to find dead links")
+	concurrency := fs.Int("concurrency", 4, "Number of HEAD requests in flight with -http")
+	rate := fs.Float64("rate", 5, "Maximum HEAD requests per second with -http (0 for unlimited)")
+	timeout := fs.Duration("timeout", 15*time.Second, "Timeout for each HEAD request")
+	fs.Parse(args)
+
+	if *concurrency <= 0 {
+		log.Fatal("Error: concurrency must be greater than 0")
+	}
+
+	db, err := OpenReadOnly(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	issues, checked, err := db.CheckFormats(FormatCheckOptions{
+		HTTP:              *checkHTTP,
+		Concurrency:       *concurrency,
+		RequestsPerSecond: *rate,
+		Client:            &http.Client{Timeout: *timeout},
+	})
+	if err != nil {
+		log.Fatalf("Format check failed: %v", err)
+	}
+
+	PrintFormatIssues(os.Stdout, issues, checked)
+	if len(issues) > 0 {
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+// runReparse refreshes books from their stored raw RDF using the current parser
+func runReparse(args []string) {
+	fs := flag.NewFlagSet("reparse", flag.ExitOnError)
+	dbPath := fs.String("db", "pg.db", "Path to SQLite database file, or a postgres:// URL")
+	batchSize := fs.Int("batch-size", 1000, "Number of raw documents read per batch")
+	trimFields := fs.String("trim-fields", "default", "Fields to trim: default, all, none, or a list like \"all,-summary\"")
+	stripHTML := fs.Bool("strip-html", false, "Remove HTML tags from descriptions, summaries and production notes")
+	fs.Parse(args)
+
+	if *batchSize <= 0 {
+		log.Fatal("Error: batch-size must be greater than 0")
+	}
+	trimConfig, err := ParseTrimFields(*trimFields)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	db, err := NewDB(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	stats, err := db.Reparse(ParserOptions{Trim: trimConfig, StripHTML: *stripHTML}, *batchSize)
+	if err != nil {
+		log.Fatalf("Reparse failed: %v", err)
+	}
+	stats.PrintSummary()
+}
+
+// runDedupeReport lists clusters of books that are likely the same work
+func runDedupeReport(args []string) {
+	fs := flag.NewFlagSet("dedupe-report", flag.ExitOnError)
+	dbPath := fs.String("db", "pg.db", "Path to SQLite database file")
+	fs.Parse(args)
+
+	db, err := OpenReadOnly(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	clusters, err := db.FindDuplicates()
+	if err != nil {
+		log.Fatalf("Failed to find duplicates: %v", err)
+	}
+	PrintDuplicateClusters(os.Stdout, clusters)
+}
+
+// runExport writes the catalog, or a filtered subset, to stdout or a file
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dbPath := fs.String("db", "pg.db", "Path to SQLite database file")
+	format := fs.String("format", "json", "Output format: json (newline-delimited, one book per line), csv (one row per book) or sql (schema and every table, for psql -f or sqlite3)")
+	dialect := fs.String("dialect", DialectPostgres, "SQL dialect for -format sql: postgres or sqlite")
+	outPath := fs.String("out", "", "Write to this file instead of stdout (gzip-compressed if it ends in .gz)")
+	gzipped := fs.Bool("gzip", false, "Compress the output with gzip")
+	language := fs.String("language", "", "Only export books in this language code")
+	subject := fs.String("subject", "", "Only export books with a subject containing this text")
+	author := fs.String("author", "", "Only export books with an author whose name contains this text")
+	rights := fs.String("rights", "", "Only export books with this rights status: public_domain_us, copyrighted or unknown")
+	fs.Parse(args)
+
+	if *rights != "" {
+		if err := CheckRightsStatus(*rights); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	filter := ExportFilter{Language: *language, Subject: *subject, Author: *author, Rights: *rights}
+	var export func(db *DB, w io.Writer, filter ExportFilter) error
+	switch *format {
+	case "json":
+		export = (*DB).ExportJSON
+	case "csv":
+		export = (*DB).ExportCSV
+	case "sql":
+		if filter != (ExportFilter{}) {
+			log.Fatal("Error: -format sql dumps the whole catalog and can't be filtered")
+		}
+		if *dialect != DialectPostgres && *dialect != DialectSQLite {
+			log.Fatalf("Error: unsupported SQL dialect %q (use postgres or sqlite)", *dialect)
+		}
+		export = func(db *DB, w io.Writer, _ ExportFilter) error {
+			return db.ExportSQL(w, *dialect)
+		}
+	default:
+		log.Fatalf("Error: unsupported export format %q (use json, csv or sql)", *format)
+	}
+
+	db, err := OpenReadOnly(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	out := os.Stdout
+	if *outPath != "" {
+		out, err = os.Create(*outPath)
+		if err != nil {
+			log.Fatalf("Failed to create output file: %v", err)
+		}
+	}
+	var dst io.Writer = out
+	var gz *gzip.Writer
+	if *gzipped || strings.HasSuffix(*outPath, ".gz") {
+		gz = gzip.NewWriter(out)
+		dst = gz
+	}
+	w := bufio.NewWriter(dst)
+
+	if err := export(db, w, filter); err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("Failed to write export: %v", err)
+	}
+	// log.Fatalf skips deferred calls, so the gzip trailer and the file are
+	// closed explicitly; an unclosed gzip stream is truncated
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			log.Fatalf("Failed to write export: %v", err)
+		}
+	}
+	if *outPath != "" {
+		if err := out.Close(); err != nil {
+			log.Fatalf("Failed to write export: %v", err)
+		}
+	}
+}
+
+// runSearch prints the books best matching a full-text query
+func runSearch(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	dbPath := fs.String("db", "pg.db", "Path to SQLite database file")
+	limit := fs.Int("limit", 20, "Maximum number of matches to print")
+	fs.Parse(args)
+
+	query := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		log.Fatal("Error: search needs a query, e.g. search -db pg.db whale ship")
+	}
+	if *limit <= 0 {
+		log.Fatal("Error: limit must be greater than 0")
+	}
+
+	db, err := OpenReadOnly(*dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	books, err := db.SearchBooks(query, *limit)
+	if err != nil {
+		log.Fatalf("Search failed: %v", err)
+	}
+	if len(books) == 0 {
+		fmt.Println("No books found.")
+		return
+	}
+	for _, book := range books {
+		fmt.Printf("%-8s %s (%d downloads)\n", book.GutenbergID, book.Title, book.DownloadCount)
+	}
+}
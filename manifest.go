@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Manifest maps Gutenberg IDs to the SHA-256 of the RDF file they were last
+// imported from. An import given a manifest only processes books that are new
+// or whose file changed, independent of what the database holds.
+type Manifest struct {
+	mu     sync.Mutex
+	hashes map[string]string
+	// pending holds hashes of books queued for insertion; they replace the
+	// recorded hash only once the book is stored
+	pending map[string]string
+}
+
+// NewManifest creates an empty manifest
+func NewManifest() *Manifest {
+	return &Manifest{
+		hashes:  make(map[string]string),
+		pending: make(map[string]string),
+	}
+}
+
+// LoadManifest reads a manifest written by Save
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	m := NewManifest()
+	if err := json.Unmarshal(data, &m.hashes); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if m.hashes == nil {
+		m.hashes = make(map[string]string)
+	}
+	return m, nil
+}
+
+// Save writes the manifest as a JSON object of gutenberg_id to hash
+func (m *Manifest) Save(path string) error {
+	m.mu.Lock()
+	data, err := json.MarshalIndent(m.hashes, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Changed reports whether a book is absent from the manifest or was recorded
+// with a different hash
+func (m *Manifest) Changed(gutenbergID, hash string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recorded, ok := m.hashes[gutenbergID]
+	return !ok || recorded != hash
+}
+
+// Stage remembers the hash of a book about to be inserted
+func (m *Manifest) Stage(gutenbergID, hash string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending[gutenbergID] = hash
+}
+
+// Commit records the staged hash of a book that was stored successfully
+func (m *Manifest) Commit(gutenbergID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hash, ok := m.pending[gutenbergID]; ok {
+		m.hashes[gutenbergID] = hash
+		delete(m.pending, gutenbergID)
+	}
+}
+
+// Len returns the number of books recorded in the manifest
+func (m *Manifest) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.hashes)
+}
+
+// HashBytes returns the hex-encoded SHA-256 of data, matching HashFile for a
+// file with the same contents
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashFile returns the hex-encoded SHA-256 of a file's contents
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestIncrementalImport(t *testing.T) {
+	original := map[string]string{
+		"1": rdfXML(ebookXML("1", "One", "")),
+		"2": rdfXML(ebookXML("2", "Two", "")),
+		"3": rdfXML(ebookXML("3", "Three", "")),
+	}
+	changed := rdfXML(ebookXML("2", "Two, Revised", ""))
+	added := rdfXML(ebookXML("4", "Four", ""))
+
+	tests := []struct {
+		name        string
+		docs        map[string]string
+		wantIDs     []string
+		wantSkipped int
+	}{
+		{"unchanged", original, nil, 3},
+		{"changed and new", map[string]string{"1": original["1"], "2": changed, "3": original["3"], "4": added}, []string{"2", "4"}, 2},
+		{"subset", map[string]string{"3": original["3"], "4": added}, []string{"4"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			first := NewManifest()
+			importer := newTestImporter(newTestDB(t))
+			importer.SetManifest(first)
+			importTestDocs(t, importer, original)
+			manifestPath := filepath.Join(dir, "manifest.json")
+			if err := first.Save(manifestPath); err != nil {
+				t.Fatal(err)
+			}
+
+			manifest, err := LoadManifest(manifestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// A fresh database holds only the books this run processed
+			db := newTestDB(t)
+			importer = newTestImporter(db)
+			importer.SetManifest(manifest)
+			importTestDocs(t, importer, tt.docs)
+
+			if got := bookIDs(t, db); fmt.Sprint(got) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("processed %v, want %v", got, tt.wantIDs)
+			}
+			if got := importer.Stats().Skipped; got != tt.wantSkipped {
+				t.Errorf("skipped %d, want %d", got, tt.wantSkipped)
+			}
+
+			outPath := filepath.Join(dir, "manifest-out.json")
+			if err := manifest.Save(outPath); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]string
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			// Books missing from this run keep their recorded hash
+			want := map[string]string{}
+			for id, doc := range original {
+				want[id] = HashBytes([]byte(doc))
+			}
+			for id, doc := range tt.docs {
+				want[id] = HashBytes([]byte(doc))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("output manifest = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestManifestCommitsOnlyStoredBooks(t *testing.T) {
+	manifest := NewManifest()
+	manifest.Stage("1", "a")
+	manifest.Stage("2", "b")
+	manifest.Commit("1")
+
+	tests := []struct {
+		id      string
+		hash    string
+		changed bool
+	}{
+		{"1", "a", false},
+		{"1", "other", true},
+		{"2", "b", true},
+		{"3", "c", true},
+	}
+	for _, tt := range tests {
+		if got := manifest.Changed(tt.id, tt.hash); got != tt.changed {
+			t.Errorf("Changed(%s, %s) = %v, want %v", tt.id, tt.hash, got, tt.changed)
+		}
+	}
+	if manifest.Len() != 1 {
+		t.Errorf("Len = %d, want 1", manifest.Len())
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// htmlTag matches an HTML tag, capturing its name
+var htmlTag = regexp.MustCompile(`</?([a-zA-Z][a-zA-Z0-9]*)[^>]*>`)
+
+// htmlBreakTags are tags replaced by a line break rather than removed, so
+// stripping markup doesn't run paragraphs together
+var htmlBreakTags = map[string]bool{
+	"br": true, "p": true, "div": true, "li": true, "tr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// cleanMarkup decodes HTML entities left in a text value after XML decoding,
+// such as "&#8212;" in a double-escaped description or "&amp;" inside CDATA.
+// With stripTags, HTML tags are removed first, block tags becoming line breaks
+// (except at either end of the value).
+func cleanMarkup(value string, stripTags bool) string {
+	if stripTags {
+		value = htmlTag.ReplaceAllStringFunc(value, func(tag string) string {
+			name := strings.ToLower(htmlTag.FindStringSubmatch(tag)[1])
+			if htmlBreakTags[name] {
+				return "\n"
+			}
+			return ""
+		})
+		value = strings.Trim(value, "\n")
+	}
+	return html.UnescapeString(value)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCleanMarkup(t *testing.T) {
+	tests := []struct {
+		value     string
+		stripTags bool
+		want      string
+	}{
+		{"Fish &amp; Chips &#8212; a history", false, "Fish & Chips — a history"},
+		{"&lt;i&gt;Emma&lt;/i&gt;", false, "<i>Emma</i>"},
+		{"<p>First.</p><p>Second &amp; last.</p>", false, "<p>First.</p><p>Second & last.</p>"},
+		{"<p>First.</p><p>Second &amp; last.</p>", true, "First.\n\nSecond & last."},
+		{"A <i>novel</i> by <b>Austen</b>", true, "A novel by Austen"},
+		{"Line one<br/>Line two<BR>Line three", true, "Line one\nLine two\nLine three"},
+		{"2 < 3 and 5 > 4", true, "2 < 3 and 5 > 4"},
+		{"&lt;p&gt;escaped tags stay&lt;/p&gt;", true, "<p>escaped tags stay</p>"},
+		{"", true, ""},
+	}
+	for _, tt := range tests {
+		if got := cleanMarkup(tt.value, tt.stripTags); got != tt.want {
+			t.Errorf("cleanMarkup(%q, %v) = %q, want %q", tt.value, tt.stripTags, got, tt.want)
+		}
+	}
+}
+
+func TestParseRDFDescriptionMarkup(t *testing.T) {
+	body := `<dcterms:description>&lt;p&gt;Fish &amp;amp; Chips&lt;/p&gt;&lt;p&gt;A &lt;i&gt;history&lt;/i&gt; &amp;#8212; abridged&lt;/p&gt;</dcterms:description>` +
+		`<pgterms:marc520>&lt;b&gt;Summary&lt;/b&gt; &amp;amp; notes</pgterms:marc520>`
+	tests := []struct {
+		name        string
+		stripHTML   bool
+		description string
+		summary     string
+	}{
+		{"entities only", false, "<p>Fish & Chips</p><p>A <i>history</i> — abridged</p>", "<b>Summary</b> & notes"},
+		{"strip tags", true, "Fish & Chips\n\nA history — abridged", "Summary & notes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book, err := ParseRDFWithOptions(strings.NewReader(rdfXML(ebookXML("1", "One", body))), ParserOptions{Trim: DefaultTrimConfig(), StripHTML: tt.stripHTML})
+			if err != nil {
+				t.Fatalf("ParseRDFWithOptions: %v", err)
+			}
+			if book.Description != tt.description {
+				t.Errorf("Description = %q, want %q", book.Description, tt.description)
+			}
+			if book.Summary != tt.summary {
+				t.Errorf("Summary = %q, want %q", book.Summary, tt.summary)
+			}
+		})
+	}
+}
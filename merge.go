@@ -0,0 +1,74 @@
+package main
+
+import "fmt"
+
+// MergeFrom copies every book and its relations from src into db, upserting on
+// gutenberg_id. Authors, subjects, bookshelves and publishers are matched by
+// their natural keys, so IDs from src are reconciled rather than copied. Books
+// are written in transactions of batchSize. Returns the number of books merged.
+func (db *DB) MergeFrom(src *DB, batchSize int) (int, error) {
+	merged := 0
+	var lastID int64
+
+	for {
+		books, nextID, err := src.scanBooks(lastID, batchSize)
+		if err != nil {
+			return merged, err
+		}
+		if len(books) == 0 {
+			return merged, nil
+		}
+		lastID = nextID
+
+		for _, book := range books {
+			if err := src.loadBookRelations(book); err != nil {
+				return merged, err
+			}
+		}
+
+		tx, err := db.begin()
+		if err != nil {
+			return merged, err
+		}
+		for _, book := range books {
+			if err := db.insertBook(tx, book, nil); err != nil {
+				tx.Rollback()
+				return merged, fmt.Errorf("failed to merge book %s: %w", book.GutenbergID, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return merged, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+
+		merged += len(books)
+	}
+}
+
+// scanBooks reads up to limit book rows with a row ID greater than afterID.
+// It returns the books and the row ID of the last one read.
+func (db *DB) scanBooks(afterID int64, limit int) ([]*Book, int64, error) {
+	rows, err := db.conn.Query(`
+		SELECT `+bookColumns+`
+		FROM books
+		WHERE id > ?
+		ORDER BY id
+		LIMIT ?
+	`, afterID, limit)
+	if err != nil {
+		return nil, afterID, fmt.Errorf("failed to query books: %w", err)
+	}
+	defer rows.Close()
+
+	var books []*Book
+	lastID := afterID
+	for rows.Next() {
+		book, id, err := scanBook(rows)
+		if err != nil {
+			return nil, afterID, fmt.Errorf("failed to scan book: %w", err)
+		}
+		lastID = id
+		books = append(books, book)
+	}
+
+	return books, lastID, rows.Err()
+}
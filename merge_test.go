@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMergeFrom(t *testing.T) {
+	twain := Author{Name: "Twain, Mark", AgentID: "53"}
+	austen := Author{Name: "Austen, Jane", AgentID: "68"}
+	book := func(id, title string, author Author, subjects ...string) *Book {
+		return &Book{GutenbergID: id, Title: title, Language: "en", Authors: []Author{author}, Subjects: subjects, Bookshelves: []string{"Best Books Ever Listings"}}
+	}
+
+	for _, batchSize := range []int{1, 2, 100} {
+		t.Run(fmt.Sprintf("batch %d", batchSize), func(t *testing.T) {
+			into := newTestDB(t)
+			insertTestBooks(t, into,
+				book("74", "Tom Sawyer", twain, "Boys -- Fiction"),
+				book("1342", "Pride and Prejudice", austen, "Courtship -- Fiction"),
+			)
+			from := newTestDB(t)
+			insertTestBooks(t, from,
+				// Austen is inserted first so her row ID differs between the databases
+				book("158", "Emma", austen, "Courtship -- Fiction", "England -- Fiction"),
+				book("76", "Huckleberry Finn", twain, "Boys -- Fiction"),
+				book("74", "The Adventures of Tom Sawyer", twain, "Boys -- Fiction"),
+			)
+
+			merged, err := into.MergeFrom(from, batchSize)
+			if err != nil {
+				t.Fatalf("MergeFrom: %v", err)
+			}
+			if merged != 3 {
+				t.Errorf("merged %d books, want 3", merged)
+			}
+
+			if got, want := bookIDs(t, into), []string{"1342", "158", "74", "76"}; fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("books %v, want %v", got, want)
+			}
+			for table, want := range map[string]int{"authors": 2, "subjects": 3, "bookshelves": 1, "book_authors": 4, "book_subjects": 5} {
+				if got := queryInt(t, into, "SELECT COUNT(*) FROM "+table); got != want {
+					t.Errorf("%d rows in %s, want %d", got, table, want)
+				}
+			}
+
+			tests := []struct {
+				id       string
+				title    string
+				author   string
+				subjects int
+			}{
+				{"74", "The Adventures of Tom Sawyer", "Twain, Mark", 1},
+				{"76", "Huckleberry Finn", "Twain, Mark", 1},
+				{"158", "Emma", "Austen, Jane", 2},
+				{"1342", "Pride and Prejudice", "Austen, Jane", 1},
+			}
+			for _, tt := range tests {
+				got, err := into.GetBook(tt.id)
+				if err != nil {
+					t.Fatalf("GetBook(%s): %v", tt.id, err)
+				}
+				if got.Title != tt.title || len(got.Authors) != 1 || got.Authors[0].Name != tt.author || len(got.Subjects) != tt.subjects {
+					t.Errorf("book %s = %q by %v with %d subjects, want %q by %s with %d", tt.id, got.Title, got.Authors, len(got.Subjects), tt.title, tt.author, tt.subjects)
+				}
+			}
+		})
+	}
+}
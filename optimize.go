@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Optimize rebuilds the database with VACUUM, reclaiming the space left by
+// updates and deletes, and refreshes the query planner's statistics with
+// ANALYZE. VACUUM needs the database to itself, so call it only once every
+// write is done. On SQLite the WAL is then checkpointed and truncated, so the
+// rebuilt file is all on disk in the main database file.
+func (db *DB) Optimize() error {
+	if _, err := db.conn.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	if _, err := db.conn.Exec("ANALYZE"); err != nil {
+		return fmt.Errorf("failed to analyze database: %w", err)
+	}
+	if db.driver == DriverSQLite {
+		if _, err := db.conn.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return fmt.Errorf("failed to checkpoint database: %w", err)
+		}
+	}
+	return nil
+}
+
+// databaseSize returns the on-disk size of a SQLite database file together
+// with its WAL, and false if path isn't a file (e.g. a PostgreSQL URL)
+func databaseSize(path string) (int64, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	size := info.Size()
+	if wal, err := os.Stat(path + "-wal"); err == nil {
+		size += wal.Size()
+	}
+	return size, true
+}
+
+// formatFileSize renders a byte count in MB with one decimal place
+func formatFileSize(size int64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+}
+
+// optimizeDatabase runs Optimize and prints the database's size before and
+// after when it is a file
+func optimizeDatabase(db *DB, path string) error {
+	before, sized := databaseSize(path)
+	fmt.Printf("Optimizing database (VACUUM, ANALYZE): %s\n", path)
+	if err := db.Optimize(); err != nil {
+		return err
+	}
+	if after, ok := databaseSize(path); sized && ok {
+		fmt.Printf("Database size: %s before, %s after\n", formatFileSize(before), formatFileSize(after))
+	}
+	return nil
+}
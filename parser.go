@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bufio"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,276 +12,470 @@ import (
 	"strings"
 )
 
+// Namespace URIs used in Project Gutenberg RDF files. Elements are matched by
+// namespace URI plus local name, so documents using different prefixes for the
+// same vocabularies still parse. Struct tags below must spell the URIs out
+// literally; keep them in sync with these constants.
+const (
+	nsRDF     = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsRDFS    = "http://www.w3.org/2000/01/rdf-schema#"
+	nsDCTerms = "http://purl.org/dc/terms/"
+	nsPGTerms = "http://www.gutenberg.org/2009/pgterms/"
+	nsDCAM    = "http://purl.org/dc/dcam/"
+	nsMARCRel = "http://id.loc.gov/vocabulary/relators/"
+)
+
 // RDFNamespaces defines the XML namespaces used in Project Gutenberg RDF files
 var RDFNamespaces = map[string]string{
-	"rdf":     "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
-	"rdfs":    "http://www.w3.org/2000/01/rdf-schema#",
-	"dcterms": "http://purl.org/dc/terms/",
-	"pgterms": "http://www.gutenberg.org/2009/pgterms/",
-	"dcam":    "http://purl.org/dc/dcam/",
+	"rdf":     nsRDF,
+	"rdfs":    nsRDFS,
+	"dcterms": nsDCTerms,
+	"pgterms": nsPGTerms,
+	"dcam":    nsDCAM,
+	"marcrel": nsMARCRel,
 }
 
-// RDFDocument represents the parsed RDF document
+// ErrNoEbook is returned when an RDF document has no pgterms:ebook element
+var ErrNoEbook = errors.New("no ebook element found")
+
+// ErrEmptyDocument is returned for input that is empty or only whitespace,
+// such as the zero-byte files a truncated archive leaves behind
+var ErrEmptyDocument = errors.New("empty RDF document")
+
+// RDFDocument represents the parsed RDF document. Gutenberg writes one ebook
+// per document; aggregated dumps can hold many.
 type RDFDocument struct {
-	XMLName xml.Name `xml:"RDF"`
-	Ebook   *Ebook   `xml:"ebook"`
-	Agents  []Agent  `xml:"agent"`
+	XMLName xml.Name `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# RDF"`
+	Ebooks  []Ebook  `xml:"http://www.gutenberg.org/2009/pgterms/ ebook"`
+	Agents  []Agent  `xml:"http://www.gutenberg.org/2009/pgterms/ agent"`
 }
 
 // Ebook represents the main pgterms:ebook element
 type Ebook struct {
-	About       string         `xml:"about,attr"`
-	Title       string         `xml:"title"`
-	Creator     []Creator      `xml:"creator"`
-	Subject     []Subject      `xml:"subject"`
-	Language    []Language     `xml:"language"`
-	Rights      string         `xml:"rights"`
-	Issued      string         `xml:"issued"`
-	Downloads   string         `xml:"downloads"`
-	Format      []RDFFormat    `xml:"hasFormat"`
-	Publisher   string         `xml:"publisher"`
-	License     LicenseElement `xml:"license"`
-	Description []string       `xml:"description"`
-	MARC508     string         `xml:"marc508"`
-	MARC520     string         `xml:"marc520"`
-	MARC908     string         `xml:"marc908"`
-	Bookshelf   []Bookshelf    `xml:"bookshelf"`
+	About       string         `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string         `xml:"http://purl.org/dc/terms/ title"`
+	Creator     []Creator      `xml:"http://purl.org/dc/terms/ creator"`
+	Subject     []Subject      `xml:"http://purl.org/dc/terms/ subject"`
+	Language    []Language     `xml:"http://purl.org/dc/terms/ language"`
+	Rights      string         `xml:"http://purl.org/dc/terms/ rights"`
+	Issued      string         `xml:"http://purl.org/dc/terms/ issued"`
+	Modified    string         `xml:"http://purl.org/dc/terms/ modified"`
+	Downloads   string         `xml:"http://www.gutenberg.org/2009/pgterms/ downloads"`
+	Format      []RDFFormat    `xml:"http://purl.org/dc/terms/ hasFormat"`
+	Publisher   Publisher      `xml:"http://purl.org/dc/terms/ publisher"`
+	License     LicenseElement `xml:"http://purl.org/dc/terms/ license"`
+	Description []string       `xml:"http://purl.org/dc/terms/ description"`
+	MARC508     string         `xml:"http://www.gutenberg.org/2009/pgterms/ marc508"`
+	MARC520     string         `xml:"http://www.gutenberg.org/2009/pgterms/ marc520"`
+	MARC908     string         `xml:"http://www.gutenberg.org/2009/pgterms/ marc908"`
+	Bookshelf   []Bookshelf    `xml:"http://www.gutenberg.org/2009/pgterms/ bookshelf"`
+	Type        *TypeElement   `xml:"http://purl.org/dc/terms/ type"`
+
+	// Contributors by MARC relator role
+	Editors           []Creator `xml:"http://id.loc.gov/vocabulary/relators/ edt"`
+	Translators       []Creator `xml:"http://id.loc.gov/vocabulary/relators/ trl"`
+	Illustrators      []Creator `xml:"http://id.loc.gov/vocabulary/relators/ ill"`
+	IntroAuthors      []Creator `xml:"http://id.loc.gov/vocabulary/relators/ aui"`
+	AfterwordAuthors  []Creator `xml:"http://id.loc.gov/vocabulary/relators/ aft"`
+	Annotators        []Creator `xml:"http://id.loc.gov/vocabulary/relators/ ann"`
+	Commentators      []Creator `xml:"http://id.loc.gov/vocabulary/relators/ cmm"`
+	Compilers         []Creator `xml:"http://id.loc.gov/vocabulary/relators/ com"`
+	Adapters          []Creator `xml:"http://id.loc.gov/vocabulary/relators/ adp"`
+	Photographers     []Creator `xml:"http://id.loc.gov/vocabulary/relators/ pht"`
+	OtherContributors []Creator `xml:"http://id.loc.gov/vocabulary/relators/ ctb"`
+	Others            []Creator `xml:"http://id.loc.gov/vocabulary/relators/ oth"`
+}
+
+// contributorRole pairs a contributor role with the agents listed in it
+type contributorRole struct {
+	Role     string
+	Creators []Creator
+}
+
+// contributorRoles returns the ebook's contributors grouped by role
+func (e *Ebook) contributorRoles() []contributorRole {
+	return []contributorRole{
+		{"editor", e.Editors},
+		{"translator", e.Translators},
+		{"illustrator", e.Illustrators},
+		{"author of introduction", e.IntroAuthors},
+		{"author of afterword", e.AfterwordAuthors},
+		{"annotator", e.Annotators},
+		{"commentator", e.Commentators},
+		{"compiler", e.Compilers},
+		{"adapter", e.Adapters},
+		{"photographer", e.Photographers},
+		{"contributor", e.OtherContributors},
+		{"other", e.Others},
+	}
 }
 
 // Bookshelf represents a pgterms:bookshelf element
 type Bookshelf struct {
-	Description *BookshelfDescription `xml:"Description"`
+	Description *BookshelfDescription `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# Description"`
 }
 
 // BookshelfDescription represents the nested Description in bookshelf
 type BookshelfDescription struct {
-	Value string `xml:"value"`
+	Value string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# value"`
+}
+
+// TypeElement represents a dcterms:type element
+type TypeElement struct {
+	Description *TypeDescription `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# Description"`
+}
+
+// TypeDescription represents the nested Description in type
+type TypeDescription struct {
+	Value string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# value"`
+}
+
+// Publisher represents a dcterms:publisher element. It is usually plain
+// text, but may instead hold an rdf:Description with an rdf:value, or a
+// pgterms:agent with a pgterms:name.
+type Publisher struct {
+	Text        string                `xml:",chardata"`
+	Description *PublisherDescription `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# Description"`
+	Agent       *Agent                `xml:"http://www.gutenberg.org/2009/pgterms/ agent"`
+}
+
+// PublisherDescription represents the nested Description in a publisher
+type PublisherDescription struct {
+	Value string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# value"`
+}
+
+// name returns the publisher's name from whichever form the element takes
+func (p Publisher) name() string {
+	if p.Description != nil && strings.TrimSpace(p.Description.Value) != "" {
+		return p.Description.Value
+	}
+	if p.Agent != nil && strings.TrimSpace(p.Agent.Name) != "" {
+		return p.Agent.Name
+	}
+	return p.Text
 }
 
 // LicenseElement represents a dcterms:license element with resource attribute
 type LicenseElement struct {
-	Resource string `xml:"resource,attr"`
+	Resource string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# resource,attr"`
 }
 
 // Creator represents a creator element
 type Creator struct {
-	Agent *Agent `xml:"agent"`
+	Agent *Agent `xml:"http://www.gutenberg.org/2009/pgterms/ agent"`
 }
 
 // WebpageElement represents a pgterms:webpage element with resource attribute
 type WebpageElement struct {
-	Resource string `xml:"resource,attr"`
+	Resource string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# resource,attr"`
 }
 
 // Agent represents a pgterms:agent element
 type Agent struct {
-	About     string           `xml:"about,attr"`
-	Name      string           `xml:"name"`
-	BirthDate string           `xml:"birthdate"`
-	DeathDate string           `xml:"deathdate"`
-	Alias     []string         `xml:"alias"`
-	Webpage   []WebpageElement `xml:"webpage"`
+	About     string           `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Name      string           `xml:"http://www.gutenberg.org/2009/pgterms/ name"`
+	BirthDate string           `xml:"http://www.gutenberg.org/2009/pgterms/ birthdate"`
+	DeathDate string           `xml:"http://www.gutenberg.org/2009/pgterms/ deathdate"`
+	Alias     []string         `xml:"http://www.gutenberg.org/2009/pgterms/ alias"`
+	Webpage   []WebpageElement `xml:"http://www.gutenberg.org/2009/pgterms/ webpage"`
 }
 
 // Subject represents a subject element with nested Description
 type Subject struct {
-	Description *SubjectDescription `xml:"Description"`
+	Description *SubjectDescription `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# Description"`
 }
 
 // SubjectDescription represents the nested Description in subject
 type SubjectDescription struct {
-	Value string `xml:"value"`
+	Value string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# value"`
+	// MemberOf names the vocabulary of the value: LCSH headings or LCC classes
+	MemberOf *MemberOf `xml:"http://purl.org/dc/dcam/ memberOf"`
+}
+
+// MemberOf represents a dcam:memberOf element
+type MemberOf struct {
+	Resource string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# resource,attr"`
+}
+
+// isLCC reports whether a subject is a Library of Congress Classification
+// code (memberOf .../LCC) rather than a subject heading
+func (d *SubjectDescription) isLCC() bool {
+	return d.MemberOf != nil && strings.HasSuffix(strings.TrimSpace(d.MemberOf.Resource), "/LCC")
 }
 
 // Language represents a language element
 type Language struct {
-	Description *LanguageDescription `xml:"Description"`
-	Resource    string               `xml:"resource,attr"`
+	Description *LanguageDescription `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# Description"`
+	Resource    string               `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# resource,attr"`
 	Value       string               `xml:",chardata"`
 }
 
 // LanguageDescription represents the nested Description in language
 type LanguageDescription struct {
-	Value string `xml:"value"`
+	Value string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# value"`
 }
 
 // RDFFormat represents a format element (dcterms:hasFormat with pgterms:file)
 type RDFFormat struct {
-	File *FileElement `xml:"file"`
+	File *FileElement `xml:"http://www.gutenberg.org/2009/pgterms/ file"`
 }
 
 // FileElement represents a pgterms:file element
 type FileElement struct {
-	About  string             `xml:"about,attr"`
-	Extent string             `xml:"extent"`
-	Format *FormatDescription `xml:"format>Description"`
+	About  string         `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Extent string         `xml:"http://purl.org/dc/terms/ extent"`
+	Format *FormatElement `xml:"http://purl.org/dc/terms/ format"`
+	// MD5 is listed by some mirrors for content verification
+	MD5 string `xml:"http://www.gutenberg.org/2009/pgterms/ md5"`
+	// Modified is when the file was last regenerated
+	Modified string `xml:"http://purl.org/dc/terms/ modified"`
+}
+
+// FormatElement represents a dcterms:format element inside pgterms:file
+type FormatElement struct {
+	Description *FormatDescription `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# Description"`
 }
 
 // FormatDescription represents the nested Description in format
 type FormatDescription struct {
-	Value string `xml:"value"`
+	Value string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# value"`
+}
+
+// ParserOptions configures how RDF values are cleaned up during parsing
+type ParserOptions struct {
+	Trim TrimConfig
+	// StripHTML removes HTML tags from description, summary and production
+	// notes; HTML entities in those fields are decoded either way
+	StripHTML bool
+}
+
+// DefaultParserOptions returns the options used by ParseRDF and ParseRDFFile
+func DefaultParserOptions() ParserOptions {
+	return ParserOptions{
+		Trim: DefaultTrimConfig(),
+	}
 }
 
 // ParseRDFFile parses an RDF/XML file and extracts book metadata
 func ParseRDFFile(filePath string) (*Book, error) {
+	return ParseRDFFileWithOptions(filePath, DefaultParserOptions())
+}
+
+// ParseRDFFileWithOptions parses an RDF/XML file using the given options
+func ParseRDFFileWithOptions(filePath string, opts ParserOptions) (*Book, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	return ParseRDF(file)
+	return ParseRDFWithOptions(file, opts)
 }
 
-// ParseRDF parses RDF/XML content from a reader
+// ParseRDF parses RDF/XML content from a reader. A document with several
+// ebooks yields the first; see ParseRDFAll.
 func ParseRDF(reader io.Reader) (*Book, error) {
-	decoder := xml.NewDecoder(reader)
+	return ParseRDFWithOptions(reader, DefaultParserOptions())
+}
+
+// ParseRDFWithOptions parses RDF/XML content from a reader using the given
+// options, returning the document's first ebook
+func ParseRDFWithOptions(reader io.Reader, opts ParserOptions) (*Book, error) {
+	books, err := ParseRDFAllWithOptions(reader, opts)
+	if err != nil {
+		return nil, err
+	}
+	return books[0], nil
+}
+
+// ParseRDFAll parses RDF/XML content holding any number of pgterms:ebook
+// elements, such as an aggregated dump, returning a book for each in document
+// order.
+func ParseRDFAll(reader io.Reader) ([]*Book, error) {
+	return ParseRDFAllWithOptions(reader, DefaultParserOptions())
+}
+
+// ParseRDFAllWithOptions is ParseRDFAll using the given options. It returns
+// ErrEmptyDocument if the input is empty or only whitespace, and ErrNoEbook if
+// the document has no ebook.
+func ParseRDFAllWithOptions(reader io.Reader, opts ParserOptions) ([]*Book, error) {
+	buffered := bufio.NewReader(reader)
+	if err := skipWhitespace(buffered); err == io.EOF {
+		return nil, ErrEmptyDocument
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	decoder := xml.NewDecoder(buffered)
 	decoder.Strict = false // Be lenient with XML parsing
+	// Only called for documents declaring an encoding other than UTF-8
+	var charset string
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		charset = strings.ToLower(label)
+		return charsetReader(label, input)
+	}
 
 	var doc RDFDocument
 	if err := decoder.Decode(&doc); err != nil {
 		return nil, fmt.Errorf("failed to decode XML: %w", err)
 	}
 
-	book := &Book{
-		Authors:     []Author{},
-		Subjects:    []string{},
-		Formats:     []Format{},
-		Bookshelves: []string{},
+	if len(doc.Ebooks) == 0 {
+		return nil, ErrNoEbook
 	}
 
-	if doc.Ebook == nil {
-		return nil, fmt.Errorf("no ebook element found")
+	books := make([]*Book, len(doc.Ebooks))
+	for i := range doc.Ebooks {
+		books[i] = doc.Ebooks[i].book(opts)
+		books[i].Charset = charset
 	}
+	return books, nil
+}
 
-	ebook := doc.Ebook
+// skipWhitespace consumes leading whitespace, returning io.EOF if nothing
+// else follows
+func skipWhitespace(reader *bufio.Reader) error {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return reader.UnreadByte()
+	}
+}
+
+// book extracts the ebook's metadata
+func (e *Ebook) book(opts ParserOptions) *Book {
+	book := &Book{
+		Authors:         []Author{},
+		Subjects:        []string{},
+		Classifications: []string{},
+		Formats:         []Format{},
+		Bookshelves:     []string{},
+	}
 
 	// Extract Gutenberg ID
-	if ebook.About != "" {
-		book.GutenbergID = extractGutenbergID(ebook.About)
+	if e.About != "" {
+		book.GutenbergID = extractGutenbergID(e.About)
 	}
 
 	// Extract title
-	book.Title = strings.TrimSpace(ebook.Title)
+	book.Title = opts.Trim.apply(FieldTitle, e.Title)
+
+	// Extract DCMI type (Text, Sound, Image, ...); records without one are texts
+	book.Type = "Text"
+	if e.Type != nil && e.Type.Description != nil {
+		if value := strings.TrimSpace(e.Type.Description.Value); value != "" {
+			book.Type = value
+		}
+	}
 
 	// Extract publisher
-	book.Publisher = strings.TrimSpace(ebook.Publisher)
+	book.Publisher = opts.Trim.apply(FieldPublisher, e.Publisher.name())
 
 	// Extract license
-	book.License = strings.TrimSpace(ebook.License.Resource)
+	book.License = opts.Trim.apply(FieldLicense, e.License.Resource)
 
 	// Extract rights
-	book.Rights = strings.TrimSpace(ebook.Rights)
+	book.Rights = opts.Trim.apply(FieldRights, e.Rights)
 
 	// Extract issued date
-	book.IssuedDate = strings.TrimSpace(ebook.Issued)
+	book.IssuedDate = opts.Trim.apply(FieldIssued, e.Issued)
+
+	// Extract the catalog record's last-modified timestamp, kept verbatim
+	book.Modified = e.Modified
 
 	// Extract download count
-	if ebook.Downloads != "" {
-		if count, err := strconv.Atoi(strings.TrimSpace(ebook.Downloads)); err == nil {
+	if e.Downloads != "" {
+		if count, err := strconv.Atoi(strings.TrimSpace(e.Downloads)); err == nil {
 			book.DownloadCount = count
 		}
 	}
 
-	// Extract language
-	for _, lang := range ebook.Language {
-		if book.Language == "" {
-			// Check for nested Description structure (most common)
-			if lang.Description != nil && lang.Description.Value != "" {
-				book.Language = strings.TrimSpace(lang.Description.Value)
-			} else if lang.Resource != "" {
-				// Extract language code from resource URI
-				book.Language = lang.Resource
-			} else if lang.Value != "" {
-				// Fallback to direct value (chardata)
-				book.Language = strings.TrimSpace(lang.Value)
-			}
+	// Extract languages; the first one is the book's primary language
+	for _, lang := range e.Language {
+		var code string
+		// Check for nested Description structure (most common)
+		if lang.Description != nil && lang.Description.Value != "" {
+			code = strings.TrimSpace(lang.Description.Value)
+		} else if lang.Resource != "" {
+			// Extract language code from resource URI
+			code = lang.Resource
+		} else if lang.Value != "" {
+			// Fallback to direct value (chardata)
+			code = strings.TrimSpace(lang.Value)
+		}
+		code = normalizeLanguage(code)
+		if code != "" && !containsString(book.Languages, code) {
+			book.Languages = append(book.Languages, code)
 		}
 	}
+	if len(book.Languages) > 0 {
+		book.Language = book.Languages[0]
+	}
 
 	// Extract creators/authors
-	for _, creator := range ebook.Creator {
+	for _, creator := range e.Creator {
 		if creator.Agent != nil {
-			fullName := strings.TrimSpace(creator.Agent.Name)
-			firstName, lastName := splitName(fullName)
-
-			author := Author{
-				Name:      fullName,
-				FirstName: firstName,
-				LastName:  lastName,
-				AgentID:   strings.TrimSpace(creator.Agent.About),
-			}
-
-			// Extract aliases (join multiple with semicolon)
-			if len(creator.Agent.Alias) > 0 {
-				aliases := make([]string, 0, len(creator.Agent.Alias))
-				for _, alias := range creator.Agent.Alias {
-					if trimmed := strings.TrimSpace(alias); trimmed != "" {
-						aliases = append(aliases, trimmed)
-					}
-				}
-				author.Alias = strings.Join(aliases, "; ")
-			}
-
-			// Extract webpages (join multiple with semicolon)
-			if len(creator.Agent.Webpage) > 0 {
-				webpages := make([]string, 0, len(creator.Agent.Webpage))
-				for _, webpage := range creator.Agent.Webpage {
-					if trimmed := strings.TrimSpace(webpage.Resource); trimmed != "" {
-						webpages = append(webpages, trimmed)
-					}
-				}
-				author.Webpage = strings.Join(webpages, "; ")
+			if author := agentAuthor(creator.Agent); author.Name != "" {
+				book.Authors = append(book.Authors, author)
 			}
+		}
+	}
 
-			if creator.Agent.BirthDate != "" {
-				if year := extractYear(creator.Agent.BirthDate); year != nil {
-					author.BirthYear = year
-				}
-			}
-			if creator.Agent.DeathDate != "" {
-				if year := extractYear(creator.Agent.DeathDate); year != nil {
-					author.DeathYear = year
+	// Extract contributors (editors, translators, illustrators, ...)
+	for _, role := range e.contributorRoles() {
+		for _, creator := range role.Creators {
+			if creator.Agent != nil {
+				if author := agentAuthor(creator.Agent); author.Name != "" {
+					book.Contributors = append(book.Contributors, Contributor{Author: author, Role: role.Role})
 				}
 			}
-			if author.Name != "" {
-				book.Authors = append(book.Authors, author)
-			}
 		}
 	}
 
 	// Extract descriptions (join multiple with newlines)
-	if len(ebook.Description) > 0 {
-		descriptions := make([]string, 0, len(ebook.Description))
-		for _, desc := range ebook.Description {
-			if trimmed := strings.TrimSpace(desc); trimmed != "" {
-				descriptions = append(descriptions, trimmed)
+	if len(e.Description) > 0 {
+		descriptions := make([]string, 0, len(e.Description))
+		for _, desc := range e.Description {
+			// Whitespace-only entries are always dropped
+			if strings.TrimSpace(desc) != "" {
+				descriptions = append(descriptions, opts.Trim.apply(FieldDescription, cleanMarkup(desc, opts.StripHTML)))
 			}
 		}
 		book.Description = strings.Join(descriptions, "\n\n")
 	}
 
 	// Extract summary (marc520)
-	book.Summary = strings.TrimSpace(ebook.MARC520)
+	book.Summary = opts.Trim.apply(FieldSummary, cleanMarkup(e.MARC520, opts.StripHTML))
 
 	// Extract production notes (marc508)
-	book.ProductionNotes = strings.TrimSpace(ebook.MARC508)
+	book.ProductionNotes = opts.Trim.apply(FieldProductionNotes, cleanMarkup(e.MARC508, opts.StripHTML))
 
 	// Extract reading ease score (marc908)
-	book.ReadingEaseScore = strings.TrimSpace(ebook.MARC908)
+	book.ReadingEaseScore = opts.Trim.apply(FieldReadingEaseScore, e.MARC908)
 
-	// Extract subjects
-	for _, subject := range ebook.Subject {
+	// Extract subjects, routing LCC class codes to classifications
+	for _, subject := range e.Subject {
 		if subject.Description != nil {
 			subj := strings.TrimSpace(subject.Description.Value)
-			if subj != "" {
+			if subj == "" {
+				continue
+			}
+			if subject.Description.isLCC() {
+				book.Classifications = append(book.Classifications, subj)
+			} else {
 				book.Subjects = append(book.Subjects, subj)
 			}
 		}
 	}
 
 	// Extract bookshelves
-	for _, bookshelf := range ebook.Bookshelf {
+	for _, bookshelf := range e.Bookshelf {
 		if bookshelf.Description != nil {
 			bs := strings.TrimSpace(bookshelf.Description.Value)
 			if bs != "" {
@@ -289,7 +485,7 @@ func ParseRDF(reader io.Reader) (*Book, error) {
 	}
 
 	// Extract formats
-	for _, format := range ebook.Format {
+	for _, format := range e.Format {
 		if format.File != nil {
 			f := Format{
 				FileURL: format.File.About,
@@ -302,13 +498,16 @@ func ParseRDF(reader io.Reader) (*Book, error) {
 				}
 			}
 
+			f.Checksum = strings.ToLower(strings.TrimSpace(format.File.MD5))
+			f.Modified = strings.TrimSpace(format.File.Modified)
+
 			// Extract format type
-			if format.File.Format != nil {
-				f.Type = strings.TrimSpace(format.File.Format.Value)
+			if format.File.Format != nil && format.File.Format.Description != nil {
+				f.Type = strings.TrimSpace(format.File.Format.Description.Value)
 			}
 
 			if f.Type == "" {
-				// Try to extract from URL
+				// Missing, empty or whitespace-only type: try to extract from URL
 				f.Type = extractFormatFromURL(format.File.About)
 			}
 
@@ -317,8 +516,37 @@ func ParseRDF(reader io.Reader) (*Book, error) {
 			}
 		}
 	}
+	book.CoverURL = bestCoverURL(book.Formats)
+
+	return book
+}
 
-	return book, nil
+// coverSizeRank orders Gutenberg cover variants, e.g. pg1.cover.medium.jpg,
+// from most to least preferred; unlisted covers rank below these
+var coverSizeRank = []string{".cover.medium.", ".cover.large.", ".cover.small."}
+
+// bestCoverURL returns the URL of the preferred cover image among formats:
+// an image whose URL mentions a cover, the medium size winning over large
+// and small. It returns "" when the book has no cover.
+func bestCoverURL(formats []Format) string {
+	best, bestRank := "", -1
+	for _, format := range formats {
+		url := strings.ToLower(format.FileURL)
+		if !strings.HasPrefix(format.Type, "image/") || !strings.Contains(url, "cover") {
+			continue
+		}
+		rank := 0
+		for i, size := range coverSizeRank {
+			if strings.Contains(url, size) {
+				rank = len(coverSizeRank) - i
+				break
+			}
+		}
+		if rank > bestRank {
+			best, bestRank = format.FileURL, rank
+		}
+	}
+	return best
 }
 
 // extractGutenbergID extracts the Gutenberg ID from a resource URI
@@ -331,16 +559,85 @@ func extractGutenbergID(uri string) string {
 	return ""
 }
 
-// extractYear extracts a year from a date string
-func extractYear(dateStr string) *int {
-	re := regexp.MustCompile(`(\d{4})`)
-	matches := re.FindStringSubmatch(dateStr)
-	if len(matches) > 1 {
-		if year, err := strconv.Atoi(matches[1]); err == nil {
-			return &year
+// Patterns used by extractYear
+var (
+	// yearPattern matches a standalone year of up to four digits, optionally
+	// negative (PG writes BCE years as negative integers) or a decade ("1770s")
+	yearPattern = regexp.MustCompile(`(-?)\b(\d{1,4})(s?)\b`)
+	// bcePattern matches an era marker placing the year before the common era
+	bcePattern = regexp.MustCompile(`(?i)\b(BCE|B\.\s?C\.(\s?E\.)?|BC)(\W|$)`)
+	// approximateYearPattern matches markers of an uncertain year: circa,
+	// floruit, a question mark, or a choice or range of years
+	approximateYearPattern = regexp.MustCompile(`(?i)((^|[\s(\[])(c|ca|circa|fl|approx)\.?(\s|\d|$)|\?|\d\s+or\s+-?\d|\d{3,4}\s*[-–/]\s*\d{3,4}\b)`)
+)
+
+// extractYear extracts a year from a date string, negative for BCE dates. It
+// also reports whether the string marks the year as approximate ("c. 1400",
+// "fl. 1580", "1564?", "1770 or 1771", "1770s"); for a choice or range the
+// first year is returned.
+func extractYear(dateStr string) (*int, bool) {
+	matches := yearPattern.FindStringSubmatch(dateStr)
+	if matches == nil {
+		return nil, false
+	}
+	year, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return nil, false
+	}
+	if matches[1] == "-" || bcePattern.MatchString(dateStr) {
+		year = -year
+	}
+	approximate := matches[3] != "" || approximateYearPattern.MatchString(dateStr)
+	return &year, approximate
+}
+
+// agentAuthor converts a pgterms:agent into an Author
+func agentAuthor(agent *Agent) Author {
+	fullName := strings.TrimSpace(agent.Name)
+	firstName, middleName, lastName, suffix := splitName(fullName)
+
+	author := Author{
+		Name:       fullName,
+		FirstName:  firstName,
+		MiddleName: middleName,
+		LastName:   lastName,
+		Suffix:     suffix,
+		AgentID:    strings.TrimSpace(agent.About),
+	}
+
+	// Extract aliases (join multiple with semicolon)
+	if len(agent.Alias) > 0 {
+		aliases := make([]string, 0, len(agent.Alias))
+		for _, alias := range agent.Alias {
+			if trimmed := strings.TrimSpace(alias); trimmed != "" {
+				aliases = append(aliases, trimmed)
+			}
 		}
+		author.Alias = strings.Join(aliases, "; ")
 	}
-	return nil
+
+	// Extract webpages (join multiple with semicolon)
+	if len(agent.Webpage) > 0 {
+		webpages := make([]string, 0, len(agent.Webpage))
+		for _, webpage := range agent.Webpage {
+			if trimmed := strings.TrimSpace(webpage.Resource); trimmed != "" {
+				webpages = append(webpages, trimmed)
+			}
+		}
+		author.Webpage = strings.Join(webpages, "; ")
+	}
+
+	if agent.BirthDate != "" {
+		year, approximate := extractYear(agent.BirthDate)
+		author.BirthYear = year
+		author.YearIsApproximate = year != nil && approximate
+	}
+	if agent.DeathDate != "" {
+		year, approximate := extractYear(agent.DeathDate)
+		author.DeathYear = year
+		author.YearIsApproximate = author.YearIsApproximate || (year != nil && approximate)
+	}
+	return author
 }
 
 // findAgentByResource finds an agent description by resource URI
@@ -353,9 +650,30 @@ func findAgentByResource(doc *RDFDocument, resource string) *Agent {
 	return nil
 }
 
+// urlExtensionTypes maps file extensions to MIME types for extractFormatFromURL.
+// Extensions are checked before the looser substring rules, so a cover under
+// /cache/epub/ is an image and a zipped text file is a zip.
+var urlExtensionTypes = []struct {
+	extension string
+	mimeType  string
+}{
+	{".zip", "application/zip"},
+	{".mp3", "audio/mpeg"},
+	{".rdf", "application/rdf+xml"},
+	{".jpg", "image/jpeg"},
+	{".jpeg", "image/jpeg"},
+	{".png", "image/png"},
+	{".gif", "image/gif"},
+}
+
 // extractFormatFromURL extracts format type from a URL
 func extractFormatFromURL(url string) string {
 	url = strings.ToLower(url)
+	for _, ext := range urlExtensionTypes {
+		if strings.HasSuffix(url, ext.extension) {
+			return ext.mimeType
+		}
+	}
 	if strings.Contains(url, "epub") {
 		return "application/epub+zip"
 	}
@@ -371,16 +689,19 @@ func extractFormatFromURL(url string) string {
 	return ""
 }
 
-// splitName splits a full name into first name and last name.
+// splitName splits a full name into first, middle and last name plus a
+// generational suffix.
 // Handles various formats:
-// - "Last, First" (most common in Gutenberg)
+// - "Last, First Middle" (most common in Gutenberg)
+// - "Last, First Middle, Jr."
 // - "First Last"
 // - "First Middle Last"
 // - Single names (organizations, etc.)
-func splitName(fullName string) (firstName, lastName string) {
-	fullName = strings.TrimSpace(fullName)
+// Everything between the first and last token is kept as the middle name.
+func splitName(fullName string) (firstName, middleName, lastName, suffix string) {
+	fullName, suffix = splitNameSuffix(strings.TrimSpace(fullName))
 	if fullName == "" {
-		return "", ""
+		return "", "", "", suffix
 	}
 
 	// Check for "Last, First" format (comma-separated)
@@ -388,23 +709,67 @@ func splitName(fullName string) (firstName, lastName string) {
 		parts := strings.SplitN(fullName, ",", 2)
 		if len(parts) == 2 {
 			lastName = strings.TrimSpace(parts[0])
-			firstName = strings.TrimSpace(parts[1])
-			return firstName, lastName
+			given := strings.Fields(parts[1])
+			if len(given) > 0 {
+				firstName = given[0]
+				middleName = strings.Join(given[1:], " ")
+			}
+			return firstName, middleName, lastName, suffix
 		}
 	}
 
 	// Split by spaces for "First Last" or "First Middle Last" format
 	parts := strings.Fields(fullName)
 	if len(parts) == 0 {
-		return "", ""
+		return "", "", "", suffix
 	} else if len(parts) == 1 {
 		// Single name - treat as last name (could be organization)
-		return "", parts[0]
+		return "", "", parts[0], suffix
 	} else {
-		// Multiple parts: first name is first part, last name is last part
-		// Middle names are ignored for simplicity
+		// Multiple parts: first name is first part, last name is last part,
+		// and anything in between is the middle name
 		firstName = parts[0]
+		middleName = strings.Join(parts[1:len(parts)-1], " ")
 		lastName = parts[len(parts)-1]
-		return firstName, lastName
+		return firstName, middleName, lastName, suffix
+	}
+}
+
+// nameSuffixes are the generational suffixes recognized by splitName,
+// lowercased and without a trailing period
+var nameSuffixes = map[string]bool{
+	"jr":  true,
+	"sr":  true,
+	"ii":  true,
+	"iii": true,
+	"iv":  true,
+}
+
+// splitNameSuffix removes a trailing generational suffix such as "Jr." or
+// "III" from a name, along with the comma before it. A lone token is never
+// treated as a suffix.
+func splitNameSuffix(name string) (rest, suffix string) {
+	fields := strings.Fields(name)
+	if len(fields) < 2 {
+		return name, ""
+	}
+
+	last := fields[len(fields)-1]
+	if !nameSuffixes[strings.ToLower(strings.TrimSuffix(last, "."))] {
+		return name, ""
+	}
+
+	rest = strings.TrimSpace(strings.TrimSuffix(name, last))
+	rest = strings.TrimSpace(strings.TrimSuffix(rest, ","))
+	return rest, last
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
+	return false
 }
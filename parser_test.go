@@ -0,0 +1,453 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// renamePrefixes rewrites an RDF document to use other prefixes for the same
+// namespaces
+func renamePrefixes(doc string, prefixes map[string]string) string {
+	for from, to := range prefixes {
+		doc = strings.ReplaceAll(doc, "xmlns:"+from+"=", "xmlns:"+to+"=")
+		doc = strings.ReplaceAll(doc, "<"+from+":", "<"+to+":")
+		doc = strings.ReplaceAll(doc, "</"+from+":", "</"+to+":")
+		doc = strings.ReplaceAll(doc, " "+from+":", " "+to+":")
+	}
+	return doc
+}
+
+func TestParseRDFNamespacePrefixes(t *testing.T) {
+	fixture := fixtureRDF(t, "1")
+	want := parseTestRDF(t, fixture)
+	if want.Title != "Book One" || len(want.Authors) == 0 || len(want.Formats) == 0 {
+		t.Fatalf("fixture parsed incompletely: %+v", want)
+	}
+
+	tests := []struct {
+		name     string
+		prefixes map[string]string
+	}{
+		{"pgterms and dcterms renamed", map[string]string{"pgterms": "pg", "dcterms": "dc"}},
+		{"rdf renamed", map[string]string{"rdf": "r"}},
+		{"every prefix renamed", map[string]string{
+			"rdf": "a", "dcterms": "b", "pgterms": "c", "dcam": "d", "marcrel": "e", "rdfs": "f",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := renamePrefixes(fixture, tt.prefixes)
+			if doc == fixture {
+				t.Fatal("document unchanged by prefix rename")
+			}
+			got := parseTestRDF(t, doc)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parsed book differs:\n got %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseRDFIgnoresForeignNamespaces(t *testing.T) {
+	// A title and a creator in another vocabulary share the local names of
+	// the Dublin Core ones and must not be mistaken for them
+	doc := rdfXML(ebookXML("7", "Real Title", `
+<foo:title xmlns:foo="http://example.org/other/">Wrong Title</foo:title>
+<foo:creator xmlns:foo="http://example.org/other/"><pgterms:agent><pgterms:name>Wrong, Author</pgterms:name></pgterms:agent></foo:creator>`))
+	book := parseTestRDF(t, doc)
+	if book.GutenbergID != "7" {
+		t.Errorf("GutenbergID = %q, want 7", book.GutenbergID)
+	}
+	if book.Title != "Real Title" {
+		t.Errorf("Title = %q, want %q", book.Title, "Real Title")
+	}
+	if len(book.Authors) != 0 {
+		t.Errorf("Authors = %+v, want none", book.Authors)
+	}
+}
+
+func TestParseFormatChecksum(t *testing.T) {
+	file := func(url, md5 string) string {
+		checksum := ""
+		if md5 != "" {
+			checksum = "<pgterms:md5>" + md5 + "</pgterms:md5>"
+		}
+		return `<dcterms:hasFormat><pgterms:file rdf:about="` + url + `"><dcterms:extent>100</dcterms:extent>` + checksum +
+			`<dcterms:format><rdf:Description><rdf:value>text/plain</rdf:value></rdf:Description></dcterms:format></pgterms:file></dcterms:hasFormat>`
+	}
+
+	tests := []struct {
+		name string
+		md5  string
+		want string
+	}{
+		{"lowercase", "9e107d9d372bb6826bd81d3542a419d6", "9e107d9d372bb6826bd81d3542a419d6"},
+		{"uppercase and padded", "  9E107D9D372BB6826BD81D3542A419D6\n", "9e107d9d372bb6826bd81d3542a419d6"},
+		{"absent", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const url = "https://www.gutenberg.org/ebooks/5.txt.utf-8"
+			book := parseTestRDF(t, rdfXML(ebookXML("5", "Five", file(url, tt.md5))))
+			if len(book.Formats) != 1 {
+				t.Fatalf("parsed %d formats, want 1", len(book.Formats))
+			}
+			if got := book.Formats[0].Checksum; got != tt.want {
+				t.Errorf("Checksum = %q, want %q", got, tt.want)
+			}
+
+			db := newTestDB(t)
+			insertTestBooks(t, db, book)
+			var stored sql.NullString
+			if err := db.conn.QueryRow("SELECT checksum FROM formats WHERE file_url = ?", url).Scan(&stored); err != nil {
+				t.Fatal(err)
+			}
+			if want := (sql.NullString{String: tt.want, Valid: tt.want != ""}); stored != want {
+				t.Errorf("stored checksum = %v, want %v", stored, want)
+			}
+			loaded, err := db.GetBook("5")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := loaded.Formats[0].Checksum; got != tt.want {
+				t.Errorf("GetBook checksum = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitNameMiddle(t *testing.T) {
+	tests := []struct {
+		name                string
+		first, middle, last string
+	}{
+		{"", "", "", ""},
+		{"Homer", "", "", "Homer"},
+		{"Jane Austen", "Jane", "", "Austen"},
+		{"Johann Wolfgang von Goethe", "Johann", "Wolfgang von", "Goethe"},
+		{"  Arthur   Conan  Doyle ", "Arthur", "Conan", "Doyle"},
+		{"Austen, Jane", "Jane", "", "Austen"},
+		{"Goethe, Johann Wolfgang von", "Johann", "Wolfgang von", "Goethe"},
+		{"Anonymous,", "", "", "Anonymous"},
+		{"Holmes, Oliver Wendell", "Oliver", "Wendell", "Holmes"},
+	}
+	for _, tt := range tests {
+		first, middle, last, _ := splitName(tt.name)
+		if first != tt.first || middle != tt.middle || last != tt.last {
+			t.Errorf("splitName(%q) = %q, %q, %q; want %q, %q, %q", tt.name, first, middle, last, tt.first, tt.middle, tt.last)
+		}
+	}
+}
+
+func TestMiddleNameStored(t *testing.T) {
+	doc := rdfXML(ebookXML("8", "Faust", `<dcterms:creator><pgterms:agent rdf:about="2009/agents/586"><pgterms:name>Goethe, Johann Wolfgang von</pgterms:name></pgterms:agent></dcterms:creator>`))
+	db := newTestDB(t)
+	insertTestBooks(t, db, parseTestRDF(t, doc))
+
+	var first, middle, last string
+	if err := db.conn.QueryRow("SELECT first_name, middle_name, last_name FROM authors").Scan(&first, &middle, &last); err != nil {
+		t.Fatal(err)
+	}
+	if first != "Johann" || middle != "Wolfgang von" || last != "Goethe" {
+		t.Errorf("stored %q, %q, %q; want Johann, Wolfgang von, Goethe", first, middle, last)
+	}
+}
+
+func TestSplitNameSuffix(t *testing.T) {
+	tests := []struct {
+		name                        string
+		first, middle, last, suffix string
+	}{
+		{"Holmes, Oliver Wendell, Jr.", "Oliver", "Wendell", "Holmes", "Jr."},
+		{"Holmes, Oliver Wendell, Jr", "Oliver", "Wendell", "Holmes", "Jr"},
+		{"Oliver Wendell Holmes Jr.", "Oliver", "Wendell", "Holmes", "Jr."},
+		{"Oliver Wendell Holmes, Sr.", "Oliver", "Wendell", "Holmes", "Sr."},
+		{"Davis, Richard Harding, SR", "Richard", "Harding", "Davis", "SR"},
+		{"King, Martin Luther, II", "Martin", "Luther", "King", "II"},
+		{"Henry III", "", "", "Henry", "III"},
+		{"Stevenson, Adlai E., III", "Adlai", "E.", "Stevenson", "III"},
+		{"Doe, John, IV.", "John", "", "Doe", "IV."},
+		{"Louis XIV", "Louis", "", "XIV", ""},
+		{"Jr.", "", "", "Jr.", ""},
+		{"Smith, Juniper", "Juniper", "", "Smith", ""},
+	}
+	for _, tt := range tests {
+		first, middle, last, suffix := splitName(tt.name)
+		if first != tt.first || middle != tt.middle || last != tt.last || suffix != tt.suffix {
+			t.Errorf("splitName(%q) = %q, %q, %q, %q; want %q, %q, %q, %q", tt.name, first, middle, last, suffix, tt.first, tt.middle, tt.last, tt.suffix)
+		}
+	}
+}
+
+func BenchmarkParseRDF(b *testing.B) {
+	doc := fixtureRDF(b, "1")
+	b.SetBytes(int64(len(doc)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseRDF(strings.NewReader(doc)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseCoverURL(t *testing.T) {
+	file := func(url, mimeType string) string {
+		return `<dcterms:hasFormat><pgterms:file rdf:about="` + url + `"><dcterms:format><rdf:Description><rdf:value>` + mimeType + `</rdf:value></rdf:Description></dcterms:format></pgterms:file></dcterms:hasFormat>`
+	}
+	const base = "https://www.gutenberg.org/cache/epub/7/"
+	tests := []struct {
+		name    string
+		formats string
+		want    string
+	}{
+		{"medium cover", file(base+"pg7.cover.medium.jpg", "image/jpeg"), base + "pg7.cover.medium.jpg"},
+		{"medium preferred over large and small", file(base+"pg7.cover.small.jpg", "image/jpeg") + file(base+"pg7.cover.large.jpg", "image/jpeg") + file(base+"pg7.cover.medium.jpg", "image/jpeg"), base + "pg7.cover.medium.jpg"},
+		{"large preferred over small", file(base+"pg7.cover.small.jpg", "image/jpeg") + file(base+"pg7.cover.large.jpg", "image/jpeg"), base + "pg7.cover.large.jpg"},
+		{"covers directory", file("https://www.gutenberg.org/files/7/covers/front.png", "image/png"), "https://www.gutenberg.org/files/7/covers/front.png"},
+		{"illustration isn't a cover", file("https://www.gutenberg.org/files/7/images/plate1.jpg", "image/jpeg"), ""},
+		{"cover-named text isn't an image", file("https://www.gutenberg.org/files/7/cover.txt", "text/plain"), ""},
+		{"no formats", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := parseTestRDF(t, rdfXML(ebookXML("7", "Seven", tt.formats)))
+			if book.CoverURL != tt.want {
+				t.Errorf("CoverURL = %q, want %q", book.CoverURL, tt.want)
+			}
+			if got := strings.Count(tt.formats, "<pgterms:file"); len(book.Formats) != got {
+				t.Errorf("%d formats kept, want all %d", len(book.Formats), got)
+			}
+
+			db := newTestDB(t)
+			insertTestBooks(t, db, book)
+			stored, err := db.GetBook("7")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.CoverURL != tt.want {
+				t.Errorf("stored cover_url = %q, want %q", stored.CoverURL, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFormatTypeFallback(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		format string
+		want   string
+	}{
+		{"empty value, epub URL", "https://www.gutenberg.org/ebooks/7.epub.images", `<dcterms:format><rdf:Description><rdf:value></rdf:value></rdf:Description></dcterms:format>`, "application/epub+zip"},
+		{"whitespace value, epub URL", "https://www.gutenberg.org/ebooks/7.epub3.images", "<dcterms:format><rdf:Description><rdf:value>\n  </rdf:value></rdf:Description></dcterms:format>", "application/epub+zip"},
+		{"no format element", "https://www.gutenberg.org/ebooks/7.kindle.images", "", "application/x-mobipocket-ebook"},
+		{"zip", "https://www.gutenberg.org/files/7/7-0.zip", "", "application/zip"},
+		{"mp3", "https://www.gutenberg.org/files/7/mp3/7-01.mp3", "", "audio/mpeg"},
+		{"rdf", "https://www.gutenberg.org/ebooks/7.rdf", "", "application/rdf+xml"},
+		{"cover image under epub cache", "https://www.gutenberg.org/cache/epub/7/pg7.cover.medium.jpg", "", "image/jpeg"},
+		{"png", "https://www.gutenberg.org/files/7/7-h/images/plate.png", "", "image/png"},
+		{"html", "https://www.gutenberg.org/ebooks/7.html.images", "", "text/html"},
+		{"plain text", "https://www.gutenberg.org/ebooks/7.txt.utf-8", "", "text/plain"},
+		{"unknown", "https://www.gutenberg.org/ebooks/7.unknown", "", ""},
+		{"declared type wins", "https://www.gutenberg.org/ebooks/7.epub.images", `<dcterms:format><rdf:Description><rdf:value> text/x-custom </rdf:value></rdf:Description></dcterms:format>`, "text/x-custom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formats := `<dcterms:hasFormat><pgterms:file rdf:about="` + tt.url + `">` + tt.format + `</pgterms:file></dcterms:hasFormat>`
+			book := parseTestRDF(t, rdfXML(ebookXML("7", "Seven", formats)))
+			if len(book.Formats) != 1 {
+				t.Fatalf("got %d formats, want 1", len(book.Formats))
+			}
+			if got := book.Formats[0].Type; got != tt.want {
+				t.Errorf("Type = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// yearString formats an optional year for test messages
+func yearString(year *int) string {
+	if year == nil {
+		return "nil"
+	}
+	return fmt.Sprint(*year)
+}
+
+func TestExtractYear(t *testing.T) {
+	year := func(y int) *int { return &y }
+	tests := []struct {
+		date            string
+		want            *int
+		wantApproximate bool
+	}{
+		{"1812", year(1812), false},
+		{"384 BCE", year(-384), false},
+		{"-384", year(-384), false},
+		{"44 B.C.", year(-44), false},
+		{"c. 1400", year(1400), true},
+		{"ca. 1400", year(1400), true},
+		{"circa 1400", year(1400), true},
+		{"fl. 1350", year(1350), true},
+		{"1564?", year(1564), true},
+		{"1770 or 1771", year(1770), true},
+		{"1770s", year(1770), true},
+		{"c. 470 BC", year(-470), true},
+		{"unknown", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			got, approximate := extractYear(tt.date)
+			if yearString(got) != yearString(tt.want) {
+				t.Errorf("year = %s, want %s", yearString(got), yearString(tt.want))
+			}
+			if approximate != tt.wantApproximate {
+				t.Errorf("approximate = %v, want %v", approximate, tt.wantApproximate)
+			}
+		})
+	}
+}
+
+func TestAuthorYearsStored(t *testing.T) {
+	tests := []struct {
+		name            string
+		birth, death    string
+		wantBirth       sql.NullInt64
+		wantDeath       sql.NullInt64
+		wantApproximate bool
+	}{
+		{"plain", "1812", "1870", sql.NullInt64{Int64: 1812, Valid: true}, sql.NullInt64{Int64: 1870, Valid: true}, false},
+		{"BCE", "384 BCE", "322 BCE", sql.NullInt64{Int64: -384, Valid: true}, sql.NullInt64{Int64: -322, Valid: true}, false},
+		{"approximate death", "1340", "c. 1400", sql.NullInt64{Int64: 1340, Valid: true}, sql.NullInt64{Int64: 1400, Valid: true}, true},
+		{"no dates", "", "", sql.NullInt64{}, sql.NullInt64{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dates string
+			if tt.birth != "" {
+				dates += "<pgterms:birthdate>" + tt.birth + "</pgterms:birthdate>"
+			}
+			if tt.death != "" {
+				dates += "<pgterms:deathdate>" + tt.death + "</pgterms:deathdate>"
+			}
+			db := newTestDB(t)
+			insertTestBooks(t, db, parseTestRDF(t, rdfXML(ebookXML("1", "One",
+				`<dcterms:creator><pgterms:agent rdf:about="2009/agents/1"><pgterms:name>Author</pgterms:name>`+dates+`</pgterms:agent></dcterms:creator>`))))
+
+			var birth, death sql.NullInt64
+			var approximate bool
+			if err := db.conn.QueryRow("SELECT birth_year, death_year, year_is_approximate FROM authors").Scan(&birth, &death, &approximate); err != nil {
+				t.Fatal(err)
+			}
+			if birth != tt.wantBirth || death != tt.wantDeath {
+				t.Errorf("birth, death = %v, %v, want %v, %v", birth, death, tt.wantBirth, tt.wantDeath)
+			}
+			if approximate != tt.wantApproximate {
+				t.Errorf("year_is_approximate = %v, want %v", approximate, tt.wantApproximate)
+			}
+		})
+	}
+}
+
+func TestParseRDFAll(t *testing.T) {
+	aggregate, err := os.ReadFile(filepath.Join("testdata", "aggregate.rdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		doc          string
+		wantIDs      []string
+		wantTitles   []string
+		wantAuthors  []string
+		wantSubjects []int
+		wantErr      error
+	}{
+		{"aggregate fixture", string(aggregate), []string{"11", "2701"}, []string{"Alice's Adventures in Wonderland", "Moby Dick; Or, The Whale"}, []string{"Carroll, Lewis", "Melville, Herman"}, []int{1, 2}, nil},
+		{"single ebook", rdfXML(ebookXML("5", "Five", "")), []string{"5"}, []string{"Five"}, []string{""}, []int{0}, nil},
+		{"three ebooks", rdfXML(ebookXML("1", "One", ""), ebookXML("2", "Two", ""), ebookXML("3", "Three", "")), []string{"1", "2", "3"}, []string{"One", "Two", "Three"}, []string{"", "", ""}, []int{0, 0, 0}, nil},
+		{"no ebook", rdfXML(`<cc:Work rdf:about=""/>`), nil, nil, nil, nil, ErrNoEbook},
+		{"empty", "", nil, nil, nil, nil, ErrEmptyDocument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			books, err := ParseRDFAll(strings.NewReader(tt.doc))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseRDFAll error = %v, want %v", err, tt.wantErr)
+			}
+			if len(books) != len(tt.wantIDs) {
+				t.Fatalf("%d books, want %d", len(books), len(tt.wantIDs))
+			}
+			for i, book := range books {
+				var author string
+				if len(book.Authors) > 0 {
+					author = book.Authors[0].Name
+				}
+				if book.GutenbergID != tt.wantIDs[i] || book.Title != tt.wantTitles[i] || author != tt.wantAuthors[i] || len(book.Subjects) != tt.wantSubjects[i] {
+					t.Errorf("book %d = %s %q by %q with %d subjects, want %s %q by %q with %d", i, book.GutenbergID, book.Title, author, len(book.Subjects), tt.wantIDs[i], tt.wantTitles[i], tt.wantAuthors[i], tt.wantSubjects[i])
+				}
+			}
+
+			// ParseRDF returns the first of the same books
+			if len(tt.wantIDs) > 0 {
+				first, err := ParseRDF(strings.NewReader(tt.doc))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if first.GutenbergID != tt.wantIDs[0] {
+					t.Errorf("ParseRDF returned %s, want the first ebook %s", first.GutenbergID, tt.wantIDs[0])
+				}
+			}
+		})
+	}
+}
+
+func TestParseRDFEmptyDocument(t *testing.T) {
+	tests := []struct {
+		name      string
+		doc       string
+		wantEmpty bool
+	}{
+		{"zero bytes", "", true},
+		{"spaces", "   ", true},
+		{"newlines and tabs", "\n\t\r\n", true},
+		{"truncated after declaration", `<?xml version="1.0" encoding="utf-8"?>`, false},
+		{"not XML", "garbage", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRDF(strings.NewReader(tt.doc))
+			if err == nil {
+				t.Fatal("ParseRDF succeeded")
+			}
+			if errors.Is(err, ErrEmptyDocument) != tt.wantEmpty {
+				t.Errorf("ParseRDF error = %v, want ErrEmptyDocument: %v", err, tt.wantEmpty)
+			}
+		})
+	}
+}
+
+func TestImportCountsEmptyFiles(t *testing.T) {
+	db := newTestDB(t)
+	importer := newTestImporter(db)
+	importTestDocs(t, importer, map[string]string{
+		"1": rdfXML(ebookXML("1", "One", "")),
+		"2": "",
+		"3": " \n",
+		"4": rdfXML(ebookXML("4", "Four", ""))[:200],
+	})
+
+	stats := importer.Stats()
+	if stats.Successful != 1 || stats.Empty != 2 || stats.Failed != 1 {
+		t.Errorf("successful %d, empty %d, failed %d; want 1, 2, 1", stats.Successful, stats.Empty, stats.Failed)
+	}
+	if got := bookIDs(t, db); len(got) != 1 || got[0] != "1" {
+		t.Errorf("books = %v, want [1]", got)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Statuses recorded in import_progress
+const (
+	progressImported = "imported"
+	progressFailed   = "failed"
+	progressFiltered = "filtered"
+)
+
+// ProgressRecord is the outcome of importing one RDF file, identified by name
+// and the hash of its contents
+type ProgressRecord struct {
+	File   string
+	Hash   string
+	Status string
+}
+
+// MarkProcessed records the outcome of importing an RDF file, replacing any
+// earlier record for it
+func (db *DB) MarkProcessed(file, hash, status string) error {
+	return db.MarkProcessedBatch([]ProgressRecord{{File: file, Hash: hash, Status: status}})
+}
+
+// MarkProcessedBatch records the outcome of several files in one transaction,
+// retried if the database is busy
+func (db *DB) MarkProcessedBatch(records []ProgressRecord) error {
+	return db.withRetry(func() error {
+		return db.markProcessedTx(records)
+	})
+}
+
+// markProcessedTx runs one attempt of MarkProcessedBatch
+func (db *DB) markProcessedTx(records []ProgressRecord) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, record := range records {
+		_, err := tx.Exec(`
+			INSERT INTO import_progress (file_name, content_hash, status, processed_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(file_name) DO UPDATE SET
+				content_hash = excluded.content_hash,
+				status = excluded.status,
+				processed_at = excluded.processed_at
+		`, record.File, record.Hash, record.Status, now)
+		if err != nil {
+			return fmt.Errorf("failed to record progress for %s: %w", record.File, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit progress: %w", err)
+	}
+	return nil
+}
+
+// WasProcessed reports whether a file with these contents was already
+// imported. A file that failed, was filtered out, or has changed since is
+// not considered processed.
+func (db *DB) WasProcessed(file, hash string) (bool, error) {
+	var count int
+	err := db.conn.QueryRow(db.rebind(`
+		SELECT COUNT(*) FROM import_progress
+		WHERE file_name = ? AND content_hash = ? AND status = ?
+	`), file, hash, progressImported).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to query progress for %s: %w", file, err)
+	}
+	return count > 0, nil
+}
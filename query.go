@@ -0,0 +1,373 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// bookColumns lists the books columns read by scanBook, in order
+const bookColumns = `id, gutenberg_id, title, book_type, language, publisher, license, rights, issued_date, modified_date, cover_url,
+		       download_count, description, summary, production_notes, reading_ease_score`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanBook reads a row selected with bookColumns, followed by any extra
+// destinations, returning the book and its row ID
+func scanBook(row rowScanner, extra ...interface{}) (*Book, int64, error) {
+	var id int64
+	var title, bookType, language, publisher, license, rights, issued, modified, cover sql.NullString
+	var description, summary, notes, readingEase sql.NullString
+	var downloads sql.NullInt64
+	book := &Book{}
+	dest := append([]interface{}{&id, &book.GutenbergID, &title, &bookType, &language, &publisher, &license, &rights, &issued, &modified, &cover,
+		&downloads, &description, &summary, &notes, &readingEase}, extra...)
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, 0, err
+	}
+	book.Title = title.String
+	book.Type = bookType.String
+	book.Language = language.String
+	book.Publisher = publisher.String
+	book.License = license.String
+	book.Rights = rights.String
+	book.IssuedDate = issued.String
+	book.Modified = modified.String
+	book.CoverURL = cover.String
+	book.DownloadCount = int(downloads.Int64)
+	book.Description = description.String
+	book.Summary = summary.String
+	book.ProductionNotes = notes.String
+	book.ReadingEaseScore = readingEase.String
+	return book, id, nil
+}
+
+// ErrNotFound is returned by GetBook when no book has the given Gutenberg ID
+var ErrNotFound = errors.New("book not found")
+
+// GetBook loads a single book by Gutenberg ID, fully populated with its
+// authors, contributors, subjects, classifications, languages, bookshelves
+// and formats.
+// It returns ErrNotFound if the book isn't in the catalog.
+func (db *DB) GetBook(gutenbergID string) (*Book, error) {
+	row := db.conn.QueryRow(db.rebind(`SELECT `+bookColumns+` FROM books WHERE gutenberg_id = ?`), gutenbergID)
+	book, bookID, err := scanBook(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query book: %w", err)
+	}
+
+	if err := db.loadBookRelationsByID(book, bookID); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// People returns everyone credited on a book, from the book_people view:
+// authors first, with Role "author", then contributors by role, each group
+// ordered by name. It returns ErrNotFound if the book isn't in the catalog.
+func (db *DB) People(gutenbergID string) ([]Contributor, error) {
+	rows, err := db.conn.Query(db.rebind(`
+		SELECT `+authorColumns+`, p.role
+		FROM book_people p
+		JOIN authors a ON a.id = p.author_id
+		WHERE p.gutenberg_id = ?
+		ORDER BY CASE WHEN p.role = 'author' THEN 0 ELSE 1 END, p.role, a.name, a.id
+	`), gutenbergID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query people: %w", err)
+	}
+	defer rows.Close()
+
+	people := []Contributor{}
+	for rows.Next() {
+		var role string
+		author, err := scanAuthor(rows, &role)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan person: %w", err)
+		}
+		people = append(people, Contributor{Author: author, Role: role})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read people: %w", err)
+	}
+
+	if len(people) == 0 {
+		exists, err := db.BookExists(gutenbergID)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrNotFound
+		}
+	}
+	return people, nil
+}
+
+// searchTitles returns books whose title contains the query, most downloaded first
+func (db *DB) searchTitles(query string, limit int) ([]*Book, error) {
+	return db.queryBooks(`
+		SELECT `+bookColumns+` FROM books
+		WHERE title LIKE '%' || ? || '%'
+		ORDER BY download_count DESC, id
+		LIMIT ?
+	`, query, limit)
+}
+
+// booksByAuthorName returns books by authors whose name contains the query
+func (db *DB) booksByAuthorName(name string, limit int) ([]*Book, error) {
+	return db.queryBooks(`
+		SELECT `+bookColumns+` FROM books
+		WHERE id IN (
+			SELECT ba.book_id FROM book_authors ba
+			JOIN authors a ON a.id = ba.author_id
+			WHERE a.name LIKE '%' || ? || '%'
+		)
+		ORDER BY download_count DESC, id
+		LIMIT ?
+	`, name, limit)
+}
+
+// BooksByAuthor returns a page of the books credited to the author with
+// exactly this name, most downloaded first. Book columns are filled in;
+// relations are not, load them with GetBook when needed.
+func (db *DB) BooksByAuthor(name string, limit, offset int) ([]*Book, error) {
+	return db.queryBooks(`
+		SELECT `+bookColumns+` FROM books
+		WHERE id IN (
+			SELECT ba.book_id FROM book_authors ba
+			JOIN authors a ON a.id = ba.author_id
+			WHERE a.name = ?
+		)
+		ORDER BY download_count DESC, id
+		LIMIT ? OFFSET ?
+	`, name, limit, offset)
+}
+
+// BooksBySubject returns a page of the books with exactly this subject,
+// most downloaded first. Like BooksByAuthor, relations are not loaded.
+func (db *DB) BooksBySubject(subject string, limit, offset int) ([]*Book, error) {
+	return db.queryBooks(`
+		SELECT `+bookColumns+` FROM books
+		WHERE id IN (
+			SELECT bs.book_id FROM book_subjects bs
+			JOIN subjects s ON s.id = bs.subject_id
+			WHERE s.subject = ?
+		)
+		ORDER BY download_count DESC, id
+		LIMIT ? OFFSET ?
+	`, subject, limit, offset)
+}
+
+// queryBooks runs a query selecting bookColumns and scans every row
+func (db *DB) queryBooks(query string, args ...interface{}) ([]*Book, error) {
+	rows, err := db.conn.Query(db.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query books: %w", err)
+	}
+	defer rows.Close()
+
+	books := []*Book{}
+	for rows.Next() {
+		book, _, err := scanBook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan book: %w", err)
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+// loadBookRelations fills a book's authors, subjects, classifications, bookshelves and formats
+func (db *DB) loadBookRelations(book *Book) error {
+	var bookID int64
+	if err := db.conn.QueryRow(db.rebind("SELECT id FROM books WHERE gutenberg_id = ?"), book.GutenbergID).Scan(&bookID); err != nil {
+		return fmt.Errorf("failed to get book ID: %w", err)
+	}
+	return db.loadBookRelationsByID(book, bookID)
+}
+
+// loadBookRelationsByID is loadBookRelations for a book whose row ID is known
+func (db *DB) loadBookRelationsByID(book *Book, bookID int64) error {
+	// Authors
+	rows, err := db.conn.Query(db.rebind(`
+		SELECT `+authorColumns+`
+		FROM authors a
+		JOIN book_authors ba ON ba.author_id = a.id
+		WHERE ba.book_id = ?
+		ORDER BY a.id
+	`), bookID)
+	if err != nil {
+		return fmt.Errorf("failed to query authors: %w", err)
+	}
+	book.Authors = []Author{}
+	for rows.Next() {
+		author, err := scanAuthor(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan author: %w", err)
+		}
+		book.Authors = append(book.Authors, author)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read authors: %w", err)
+	}
+
+	// Contributors
+	rows, err = db.conn.Query(db.rebind(`
+		SELECT `+authorColumns+`, bc.role
+		FROM authors a
+		JOIN book_contributors bc ON bc.author_id = a.id
+		WHERE bc.book_id = ?
+		ORDER BY bc.role, a.id
+	`), bookID)
+	if err != nil {
+		return fmt.Errorf("failed to query contributors: %w", err)
+	}
+	book.Contributors = []Contributor{}
+	for rows.Next() {
+		var role string
+		author, err := scanAuthor(rows, &role)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan contributor: %w", err)
+		}
+		book.Contributors = append(book.Contributors, Contributor{Author: author, Role: role})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read contributors: %w", err)
+	}
+
+	// Subjects
+	book.Subjects, err = db.queryStrings(`
+		SELECT s.subject FROM subjects s
+		JOIN book_subjects bs ON bs.subject_id = s.id
+		WHERE bs.book_id = ?
+		ORDER BY s.id
+	`, bookID)
+	if err != nil {
+		return fmt.Errorf("failed to query subjects: %w", err)
+	}
+
+	// LCC classifications
+	book.Classifications, err = db.queryStrings(`
+		SELECT lcc_code FROM book_classifications
+		WHERE book_id = ?
+		ORDER BY lcc_code
+	`, bookID)
+	if err != nil {
+		return fmt.Errorf("failed to query classifications: %w", err)
+	}
+
+	// Languages
+	book.Languages, err = db.queryStrings(`
+		SELECT language_code FROM book_languages
+		WHERE book_id = ?
+		ORDER BY language_code
+	`, bookID)
+	if err != nil {
+		return fmt.Errorf("failed to query languages: %w", err)
+	}
+
+	// Bookshelves
+	book.Bookshelves, err = db.queryStrings(`
+		SELECT b.bookshelf FROM bookshelves b
+		JOIN book_bookshelves bb ON bb.bookshelf_id = b.id
+		WHERE bb.book_id = ?
+		ORDER BY b.id
+	`, bookID)
+	if err != nil {
+		return fmt.Errorf("failed to query bookshelves: %w", err)
+	}
+
+	// Formats
+	rows, err = db.conn.Query(db.rebind(`
+		SELECT format_type, file_url, file_size, checksum, modified_date FROM formats
+		WHERE book_id = ?
+		ORDER BY id
+	`), bookID)
+	if err != nil {
+		return fmt.Errorf("failed to query formats: %w", err)
+	}
+	defer rows.Close()
+	book.Formats = []Format{}
+	for rows.Next() {
+		var fileURL sql.NullString
+		var fileSize sql.NullInt64
+		var checksum, modified sql.NullString
+		format := Format{}
+		if err := rows.Scan(&format.Type, &fileURL, &fileSize, &checksum, &modified); err != nil {
+			return fmt.Errorf("failed to scan format: %w", err)
+		}
+		format.FileURL = fileURL.String
+		format.Checksum = checksum.String
+		format.Modified = modified.String
+		if fileSize.Valid {
+			size := fileSize.Int64
+			format.FileSize = &size
+		}
+		book.Formats = append(book.Formats, format)
+	}
+
+	return rows.Err()
+}
+
+// authorColumns lists the author columns read by scanAuthor; authors must be aliased as a
+const authorColumns = `a.name, a.first_name, a.middle_name, a.last_name, a.suffix, a.agent_id, a.alias, a.webpage, a.birth_year, a.death_year, a.year_is_approximate`
+
+// scanAuthor scans authorColumns, followed by any extra destinations, into an Author
+func scanAuthor(row rowScanner, extra ...interface{}) (Author, error) {
+	var firstName, middleName, lastName, suffix, agentID, alias, webpage sql.NullString
+	var birthYear, deathYear sql.NullInt64
+	author := Author{}
+	dest := append([]interface{}{&author.Name, &firstName, &middleName, &lastName, &suffix, &agentID, &alias, &webpage, &birthYear, &deathYear, &author.YearIsApproximate}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return Author{}, err
+	}
+	author.FirstName = firstName.String
+	author.MiddleName = middleName.String
+	author.LastName = lastName.String
+	author.Suffix = suffix.String
+	author.AgentID = agentID.String
+	author.Alias = alias.String
+	author.Webpage = webpage.String
+	author.BirthYear = nullIntPtr(birthYear)
+	author.DeathYear = nullIntPtr(deathYear)
+	return author, nil
+}
+
+// queryStrings runs a query returning a single text column
+func (db *DB) queryStrings(query string, args ...interface{}) ([]string, error) {
+	rows, err := db.conn.Query(db.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// nullIntPtr converts a nullable integer column to an *int
+func nullIntPtr(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	v := int(value.Int64)
+	return &v
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestGetBookRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"full record", fixtureRDF(t, "1")},
+		{"bilingual", rdfXML(ebookXML("2", "Two Tongues", languageXML("en")+languageXML("fr")+subjectXML("Poetry")))},
+		{"title only", rdfXML(ebookXML("3", "Three", ""))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			want := parseTestRDF(t, tt.doc)
+			insertTestBooks(t, db, want)
+
+			got, err := db.GetBook(want.GutenbergID)
+			if err != nil {
+				t.Fatalf("GetBook: %v", err)
+			}
+			if !reflect.DeepEqual(emptySlices(got), emptySlices(want)) {
+				t.Errorf("GetBook returned\n%+v\nwant\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestGetBookNotFound(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.GetBook("404"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetBook error = %v, want ErrNotFound", err)
+	}
+}
+
+// emptySlices replaces a book's nil list fields with empty ones, so books
+// compare equal whether a list was never set or loaded with no rows
+func emptySlices(book *Book) *Book {
+	v := reflect.ValueOf(book).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if field := v.Field(i); field.Kind() == reflect.Slice && field.IsNil() {
+			field.Set(reflect.MakeSlice(field.Type(), 0, 0))
+		}
+	}
+	return book
+}
+
+func TestBooksByAuthorAndSubject(t *testing.T) {
+	twain := []Author{{Name: "Twain, Mark", AgentID: "53"}}
+	db := newTestDB(t)
+	insertTestBooks(t, db,
+		&Book{GutenbergID: "74", Title: "Tom Sawyer", DownloadCount: 500, Authors: twain, Subjects: []string{"Boys -- Fiction", "Humorous stories"}},
+		&Book{GutenbergID: "76", Title: "Huckleberry Finn", DownloadCount: 900, Authors: twain, Subjects: []string{"Boys -- Fiction"}},
+		&Book{GutenbergID: "3176", Title: "Innocents Abroad", DownloadCount: 100, Authors: twain, Subjects: []string{"Humorous stories"}},
+		&Book{GutenbergID: "1342", Title: "Pride and Prejudice", DownloadCount: 2000, Authors: []Author{{Name: "Austen, Jane"}}, Subjects: []string{"Courtship -- Fiction"}},
+	)
+
+	tests := []struct {
+		name   string
+		list   func(string, int, int) ([]*Book, error)
+		key    string
+		limit  int
+		offset int
+		want   []string
+	}{
+		{"author", db.BooksByAuthor, "Twain, Mark", 10, 0, []string{"76 Huckleberry Finn 900", "74 Tom Sawyer 500", "3176 Innocents Abroad 100"}},
+		{"author first page", db.BooksByAuthor, "Twain, Mark", 2, 0, []string{"76 Huckleberry Finn 900", "74 Tom Sawyer 500"}},
+		{"author second page", db.BooksByAuthor, "Twain, Mark", 2, 2, []string{"3176 Innocents Abroad 100"}},
+		{"author past the end", db.BooksByAuthor, "Twain, Mark", 2, 4, nil},
+		{"author needs exact name", db.BooksByAuthor, "Twain", 10, 0, nil},
+		{"subject", db.BooksBySubject, "Boys -- Fiction", 10, 0, []string{"76 Huckleberry Finn 900", "74 Tom Sawyer 500"}},
+		{"subject page", db.BooksBySubject, "Humorous stories", 1, 1, []string{"3176 Innocents Abroad 100"}},
+		{"unknown subject", db.BooksBySubject, "Whaling", 10, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			books, err := tt.list(tt.key, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, book := range books {
+				got = append(got, fmt.Sprintf("%s %s %d", book.GutenbergID, book.Title, book.DownloadCount))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// rawRDFUpsertQuery stores a book's gzip-compressed RDF document. xml is left
+// empty for compressed documents; it stays NOT NULL for older databases.
+const rawRDFUpsertQuery = `
+	INSERT INTO raw_rdf (book_id, xml, xml_gzip) VALUES (?, '', ?)
+	ON CONFLICT(book_id) DO UPDATE SET xml = excluded.xml, xml_gzip = excluded.xml_gzip
+`
+
+// compressRDF gzips an RDF document for raw_rdf.xml_gzip. Catalog RDF is
+// repetitive XML and typically shrinks to a fifth of its size or less.
+func compressRDF(xml []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(xml); err != nil {
+		return nil, fmt.Errorf("failed to compress RDF: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress RDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressRDF reverses compressRDF
+func decompressRDF(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress RDF: %w", err)
+	}
+	defer gz.Close()
+	xml, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress RDF: %w", err)
+	}
+	return xml, nil
+}
+
+// StoreRawRDF saves the original RDF document of the book with row ID bookID
+// in raw_rdf, gzip-compressed, replacing any document stored before, so the
+// book can later be reparsed without the archive. The importer does this for
+// every book with --store-raw.
+func (db *DB) StoreRawRDF(bookID int64, xml []byte) error {
+	compressed, err := compressRDF(xml)
+	if err != nil {
+		return err
+	}
+	if _, err := db.conn.Exec(db.rebind(rawRDFUpsertQuery), bookID, compressed); err != nil {
+		return fmt.Errorf("failed to store raw RDF: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoRawRDF is returned by Reparse when raw_rdf holds no documents, as after
+// imports run without --store-raw
+var ErrNoRawRDF = errors.New("no raw RDF stored; import with --store-raw")
+
+// rawRDF is a stored raw RDF document and the book it was imported as
+type rawRDF struct {
+	bookID int64
+	xml    string
+	// gzipped holds the document instead of xml when it was stored compressed
+	gzipped []byte
+}
+
+// document returns the stored RDF document, decompressing it if needed
+func (r rawRDF) document() (string, error) {
+	if r.gzipped == nil {
+		return r.xml, nil
+	}
+	xml, err := decompressRDF(r.gzipped)
+	return string(xml), err
+}
+
+// Reparse re-runs the current parser over every raw RDF document stored in
+// raw_rdf and upserts the result, refreshing metadata without the original
+// archive. Documents are read batchSize at a time; each book is written in
+// its own transaction so one bad document doesn't hold back the rest. It
+// returns ErrNoRawRDF when no documents are stored.
+func (db *DB) Reparse(opts ParserOptions, batchSize int) (*ImportStats, error) {
+	var total int
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM raw_rdf").Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count raw RDF: %w", err)
+	}
+	if total == 0 {
+		return nil, ErrNoRawRDF
+	}
+
+	stats := NewImportStats(total)
+	db.SetWarningHandler(stats.RecordWarning)
+	bar := newProgressBar(int64(total), "Reparsing books")
+
+	var lastID int64
+	for {
+		docs, err := db.rawRDFBatch(lastID, batchSize)
+		if err != nil {
+			return stats, err
+		}
+		if len(docs) == 0 {
+			break
+		}
+		lastID = docs[len(docs)-1].bookID
+
+		for _, doc := range docs {
+			xml, err := doc.document()
+			var book *Book
+			if err == nil {
+				book, err = ParseRDFWithOptions(strings.NewReader(xml), opts)
+			}
+			if err != nil {
+				stats.RecordFailure(fmt.Errorf("failed to parse raw RDF of book row %d: %w", doc.bookID, err), "book_row", doc.bookID)
+			} else if err := db.InsertBook(book); err != nil {
+				stats.RecordFailure(fmt.Errorf("failed to update book %s: %w", book.GutenbergID, err), "gutenberg_id", book.GutenbergID)
+			} else {
+				stats.RecordSuccess(book.Completeness())
+			}
+			bar.Add(1)
+		}
+	}
+	bar.Finish()
+
+	return stats, nil
+}
+
+// rawRDFBatch reads up to limit raw RDF documents with a book ID greater than afterID
+func (db *DB) rawRDFBatch(afterID int64, limit int) ([]rawRDF, error) {
+	rows, err := db.conn.Query(db.rebind(`
+		SELECT book_id, xml, xml_gzip FROM raw_rdf
+		WHERE book_id > ?
+		ORDER BY book_id
+		LIMIT ?
+	`), afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query raw RDF: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []rawRDF
+	for rows.Next() {
+		var doc rawRDF
+		if err := rows.Scan(&doc.bookID, &doc.xml, &doc.gzipped); err != nil {
+			return nil, fmt.Errorf("failed to scan raw RDF: %w", err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReparse(t *testing.T) {
+	docs := map[string]string{
+		"1": rdfXML(ebookXML("1", "One", "")),
+		"2": rdfXML(ebookXML("2", "Two", "")),
+	}
+	// store imports docs, with their RDF kept when storeRaw is set
+	store := func(t *testing.T, storeRaw bool) *DB {
+		db := newTestDB(t)
+		importer := newTestImporter(db)
+		importer.SetStoreRaw(storeRaw)
+		importTestDocs(t, importer, docs)
+		if _, err := db.conn.Exec("UPDATE books SET title = 'Stale'"); err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+
+	tests := []struct {
+		name        string
+		setup       func(t *testing.T) *DB
+		wantErr     error
+		wantSuccess int
+		wantFailed  int
+		wantStale   int
+	}{
+		{"nothing stored", func(t *testing.T) *DB { return newTestDB(t) }, ErrNoRawRDF, 0, 0, 0},
+		{"imported without store-raw", func(t *testing.T) *DB { return store(t, false) }, ErrNoRawRDF, 0, 0, 2},
+		{"imported with store-raw", func(t *testing.T) *DB { return store(t, true) }, nil, 2, 0, 0},
+		{"uncompressed and broken documents", func(t *testing.T) *DB {
+			db := store(t, false)
+			if _, err := db.conn.Exec(`INSERT INTO raw_rdf (book_id, xml) SELECT id, ? FROM books WHERE gutenberg_id = '1'`, docs["1"]); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.conn.Exec(`INSERT INTO raw_rdf (book_id, xml) SELECT id, '<rdf:RDF' FROM books WHERE gutenberg_id = '2'`); err != nil {
+				t.Fatal(err)
+			}
+			return db
+		}, nil, 1, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := tt.setup(t)
+			stats, err := db.Reparse(ParserOptions{Trim: DefaultTrimConfig()}, 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reparse error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (stats.Successful != tt.wantSuccess || stats.Failed != tt.wantFailed) {
+				t.Errorf("reparsed %d, failed %d; want %d, %d", stats.Successful, stats.Failed, tt.wantSuccess, tt.wantFailed)
+			}
+			if got := queryInt(t, db, "SELECT COUNT(*) FROM books WHERE title = 'Stale'"); got != tt.wantStale {
+				t.Errorf("%d books left stale, want %d", got, tt.wantStale)
+			}
+		})
+	}
+}
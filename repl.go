@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// replResultLimit caps the number of books listed by search and author
+const replResultLimit = 20
+
+// RunREPL reads commands from in and writes results to out until "quit" or
+// end of input (Ctrl-D). Commands only go through the query API; raw SQL is
+// never accepted.
+func RunREPL(db *DB, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+
+	fmt.Fprintln(out, `Type "help" for commands, Ctrl-D to exit.`)
+	for {
+		fmt.Fprint(out, "pg> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		command, arg, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		arg = strings.TrimSpace(arg)
+
+		var err error
+		switch command {
+		case "":
+			continue
+		case "help":
+			printREPLHelp(out)
+		case "quit", "exit":
+			return nil
+		case "search":
+			err = replListBooks(out, arg, db.searchTitles)
+		case "author":
+			err = replListBooks(out, arg, db.booksByAuthorName)
+		case "book":
+			err = replShowBook(db, out, arg)
+		case "stats":
+			err = db.PrintStats(out)
+		default:
+			fmt.Fprintf(out, "Unknown command %q. Type \"help\" for commands.\n", command)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+		}
+	}
+}
+
+// printREPLHelp lists the available REPL commands
+func printREPLHelp(out io.Writer) {
+	fmt.Fprintln(out, "Commands:")
+	fmt.Fprintln(out, "  search <query>   Find books by title")
+	fmt.Fprintln(out, "  book <id>        Show a book by Gutenberg ID")
+	fmt.Fprintln(out, "  author <name>    List books by an author")
+	fmt.Fprintln(out, "  stats            Show catalog statistics")
+	fmt.Fprintln(out, "  help             Show this help")
+	fmt.Fprintln(out, "  quit             Exit (or press Ctrl-D)")
+}
+
+// replListBooks prints one line per book returned by query
+func replListBooks(out io.Writer, arg string, query func(string, int) ([]*Book, error)) error {
+	if arg == "" {
+		return fmt.Errorf("missing argument")
+	}
+
+	books, err := query(arg, replResultLimit)
+	if err != nil {
+		return err
+	}
+	if len(books) == 0 {
+		fmt.Fprintln(out, "No books found.")
+		return nil
+	}
+	for _, book := range books {
+		fmt.Fprintf(out, "  %-8s %s (%d downloads)\n", book.GutenbergID, book.Title, book.DownloadCount)
+	}
+	return nil
+}
+
+// replShowBook prints the details of a single book
+func replShowBook(db *DB, out io.Writer, gutenbergID string) error {
+	if gutenbergID == "" {
+		return fmt.Errorf("missing book ID")
+	}
+
+	book, err := db.GetBook(gutenbergID)
+	if errors.Is(err, ErrNotFound) {
+		fmt.Fprintf(out, "Book %s not found.\n", gutenbergID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "ID:        %s\n", book.GutenbergID)
+	fmt.Fprintf(out, "Title:     %s\n", book.Title)
+	fmt.Fprintf(out, "Type:      %s\n", book.Type)
+	for _, author := range book.Authors {
+		fmt.Fprintf(out, "Author:    %s\n", author.Name)
+	}
+	for _, contributor := range book.Contributors {
+		fmt.Fprintf(out, "Credit:    %s (%s)\n", contributor.Name, contributor.Role)
+	}
+	fmt.Fprintf(out, "Language:  %s\n", strings.Join(book.Languages, ", "))
+	fmt.Fprintf(out, "Issued:    %s\n", book.IssuedDate)
+	fmt.Fprintf(out, "Modified:  %s\n", book.Modified)
+	if book.CoverURL != "" {
+		fmt.Fprintf(out, "Cover:     %s\n", book.CoverURL)
+	}
+	fmt.Fprintf(out, "Downloads: %d\n", book.DownloadCount)
+	for _, subject := range book.Subjects {
+		fmt.Fprintf(out, "Subject:   %s\n", subject)
+	}
+	if len(book.Classifications) > 0 {
+		fmt.Fprintf(out, "LCC:       %s\n", strings.Join(book.Classifications, ", "))
+	}
+	for _, format := range book.Formats {
+		fmt.Fprintf(out, "Format:    %s %s\n", format.Type, format.FileURL)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRunREPL(t *testing.T) {
+	db := newTestDB(t)
+	insertTestBooks(t, db, parseTestRDF(t, fixtureRDF(t, "1")), parseTestRDF(t, fixtureRDF(t, "2")))
+
+	const prompt = "pg> "
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"book", "book 1\n", `ID:        1
+Title:     Book One
+Type:      Text
+Author:    Jefferson, Thomas
+Credit:    Doe, John (translator)
+Language:  en
+Issued:    1971-12-01
+Modified:  2024-06-01T10:00:00
+Cover:     https://www.gutenberg.org/cache/epub/1/pg1.cover.medium.jpg
+Downloads: 1234
+Subject:   United States -- History -- Revolution, 1775-1783 -- Sources
+LCC:       E201
+Format:    application/epub+zip https://www.gutenberg.org/ebooks/1.epub3.images
+Format:    image/jpeg https://www.gutenberg.org/cache/epub/1/pg1.cover.medium.jpg
+Format:    text/plain; charset=utf-8 https://www.gutenberg.org/ebooks/1.txt.utf-8
+`},
+		{"unknown book", "book 99\n", "Book 99 not found.\n"},
+		{"missing book id", "book\n", "Error: missing book ID\n"},
+		{"search", "search book one\n", "  1        Book One (1234 downloads)\n  2        Book One (1234 downloads)\n"},
+		{"search without results", "search zebra\n", "No books found.\n"},
+		{"author", "author Jefferson\n", "  1        Book One (1234 downloads)\n  2        Book One (1234 downloads)\n"},
+		{"unknown command", "SELECT * FROM books\n", "Unknown command \"SELECT\". Type \"help\" for commands.\n"},
+		{"blank line", "\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := RunREPL(db, strings.NewReader(tt.input), &out); err != nil {
+				t.Fatalf("RunREPL: %v", err)
+			}
+			// The banner and prompts surround the command's output, and end of
+			// input (Ctrl-D) ends the session with a newline after the last prompt
+			want := "Type \"help\" for commands, Ctrl-D to exit.\n" + prompt + tt.want + prompt + "\n"
+			if got := out.String(); got != want {
+				t.Errorf("output:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestRunREPLQuit(t *testing.T) {
+	var out strings.Builder
+	if err := RunREPL(newTestDB(t), strings.NewReader("quit\nbook 1\n"), &out); err != nil {
+		t.Fatalf("RunREPL: %v", err)
+	}
+	if strings.Contains(out.String(), "Book 1") {
+		t.Errorf("commands after quit were run:\n%s", out.String())
+	}
+}
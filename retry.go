@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Default retry policy for transactions that hit a busy or locked database
+const (
+	DefaultMaxRetries = 5
+	DefaultRetryDelay = 50 * time.Millisecond
+)
+
+// SQLite primary result codes for a busy or locked database
+const (
+	sqliteBusy   = 5
+	sqliteLocked = 6
+)
+
+// SetRetryPolicy sets how often a transaction that fails with SQLITE_BUSY or
+// SQLITE_LOCKED is retried, and the delay before the first retry; the delay
+// doubles on each further attempt. maxRetries of 0 disables retrying.
+func (db *DB) SetRetryPolicy(maxRetries int, baseDelay time.Duration) {
+	db.maxRetries = maxRetries
+	db.retryDelay = baseDelay
+}
+
+// withRetry runs fn, running it again with exponential backoff while it fails
+// because the database is busy or locked. fn must be safe to repeat, i.e. run
+// a whole transaction that is rolled back on failure.
+func (db *DB) withRetry(fn func() error) error {
+	delay := db.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= db.maxRetries || !isBusyError(err) {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isBusyError reports whether err means the SQLite database was busy or
+// locked by another connection, which is worth retrying
+func isBusyError(err error) bool {
+	var coded interface{ Code() int }
+	if errors.As(err, &coded) {
+		// Extended result codes keep the primary code in the low byte
+		switch coded.Code() & 0xff {
+		case sqliteBusy, sqliteLocked:
+			return true
+		}
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "SQLITE_BUSY")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// lockDatabase takes an exclusive lock on the SQLite file at path from a
+// second connection and returns a function releasing it
+func lockDatabase(t *testing.T, path string) func() {
+	t.Helper()
+	other, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Close() })
+	conn, err := other.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(context.Background(), "BEGIN EXCLUSIVE"); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "COMMIT"); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	}
+}
+
+func TestInsertRetriesLockedDatabase(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		lockFor    time.Duration
+		wantErr    bool
+	}{
+		{"lock released during retries", 10, 100 * time.Millisecond, false},
+		{"retrying disabled", 0, 100 * time.Millisecond, true},
+		{"lock outlasts retries", 2, 300 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pg.db")
+			db, err := NewDB(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			db.SetRetryPolicy(tt.maxRetries, 10*time.Millisecond)
+
+			unlock := lockDatabase(t, path)
+			released := make(chan struct{})
+			go func() {
+				defer close(released)
+				time.Sleep(tt.lockFor)
+				unlock()
+			}()
+			err = db.InsertBook(&Book{GutenbergID: "1", Title: "One"})
+			<-released
+
+			if tt.wantErr {
+				if err == nil || !isBusyError(err) {
+					t.Fatalf("InsertBook error = %v, want a busy error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InsertBook: %v", err)
+			}
+			if got := len(bookIDs(t, db)); got != 1 {
+				t.Errorf("%d books stored, want 1", got)
+			}
+		})
+	}
+}
+
+// codedError mimics a driver error carrying an SQLite result code
+type codedError int
+
+func (e codedError) Error() string { return fmt.Sprintf("sqlite error %d", int(e)) }
+func (e codedError) Code() int     { return int(e) }
+
+func TestIsBusyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{codedError(sqliteBusy), true},
+		{codedError(sqliteLocked), true},
+		{codedError(sqliteBusy | 2<<8), true}, // SQLITE_BUSY_SNAPSHOT
+		{fmt.Errorf("failed to commit transaction: %w", codedError(sqliteBusy)), true},
+		{errors.New("database is locked (5) (SQLITE_BUSY)"), true},
+		{codedError(19), false}, // SQLITE_CONSTRAINT
+		{errors.New("no such table: books"), false},
+	}
+	for _, tt := range tests {
+		if got := isBusyError(tt.err); got != tt.want {
+			t.Errorf("isBusyError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithRetryAttempts(t *testing.T) {
+	busy := codedError(sqliteBusy)
+	tests := []struct {
+		name         string
+		maxRetries   int
+		failures     int
+		err          error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"succeeds first time", 3, 0, busy, 1, false},
+		{"succeeds after retries", 3, 2, busy, 3, false},
+		{"gives up", 3, 10, busy, 4, true},
+		{"other errors aren't retried", 3, 10, errors.New("constraint failed"), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{}
+			db.SetRetryPolicy(tt.maxRetries, time.Millisecond)
+			attempts := 0
+			err := db.withRetry(func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			if attempts != tt.wantAttempts || (err != nil) != tt.wantErr {
+				t.Errorf("%d attempts, error %v; want %d attempts, error %v", attempts, err, tt.wantAttempts, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Values of books.rights_status, the normalized form of dcterms:rights
+const (
+	RightsPublicDomainUS = "public_domain_us"
+	RightsCopyrighted    = "copyrighted"
+	RightsUnknown        = "unknown"
+)
+
+// rightsStatuses lists every value normalizeRights returns
+var rightsStatuses = []string{RightsPublicDomainUS, RightsCopyrighted, RightsUnknown}
+
+// normalizeRights maps a book's free-text rights statement to one of
+// rightsStatuses. Gutenberg uses "Public domain in the USA." for almost every
+// book, and variants of "Copyrighted. Read the copyright notice inside this
+// book for details." for the rest; anything else, including no statement, is
+// unknown.
+func normalizeRights(rights string) string {
+	normalized := strings.ToLower(strings.Join(strings.Fields(rights), " "))
+	switch {
+	case strings.HasPrefix(normalized, "public domain in the usa"):
+		return RightsPublicDomainUS
+	case strings.HasPrefix(normalized, "copyright"):
+		return RightsCopyrighted
+	default:
+		return RightsUnknown
+	}
+}
+
+// CheckRightsStatus returns an error unless value is one of rightsStatuses
+func CheckRightsStatus(value string) error {
+	if !containsString(rightsStatuses, value) {
+		return fmt.Errorf("unknown rights status %q (use %s)", value, strings.Join(rightsStatuses, ", "))
+	}
+	return nil
+}
+
+// backfillRightsStatus sets rights_status on books imported before the
+// column existed. Books share a handful of rights statements, so each
+// distinct statement is normalized once and updated in bulk.
+func (db *DB) backfillRightsStatus() error {
+	rows, err := db.conn.Query(`SELECT DISTINCT COALESCE(rights, '') FROM books WHERE rights_status IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to read rights statements: %w", err)
+	}
+	var statements []string
+	for rows.Next() {
+		var rights string
+		if err := rows.Scan(&rights); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read rights statements: %w", err)
+		}
+		statements = append(statements, rights)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read rights statements: %w", err)
+	}
+
+	for _, rights := range statements {
+		if _, err := db.conn.Exec(db.rebind(`UPDATE books SET rights_status = ? WHERE rights_status IS NULL AND COALESCE(rights, '') = ?`), normalizeRights(rights), rights); err != nil {
+			return fmt.Errorf("failed to backfill rights status: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// SchemaVersion returns the schema version recorded in the database
+func (db *DB) SchemaVersion() (int, error) {
+	var version int
+	if err := db.conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// WriteSchema writes the live CREATE TABLE/INDEX/VIEW/TRIGGER statements from
+// sqlite_master, preceded by the schema version
+func (db *DB) WriteSchema(w io.Writer) error {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "-- Schema version: %d\n", version)
+
+	rows, err := db.conn.Query(`
+		SELECT sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+		ORDER BY CASE type
+			WHEN 'table' THEN 0
+			WHEN 'view' THEN 1
+			WHEN 'index' THEN 2
+			ELSE 3
+		END, name
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query schema: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ddl string
+		if err := rows.Scan(&ddl); err != nil {
+			return fmt.Errorf("failed to scan schema: %w", err)
+		}
+		fmt.Fprintf(w, "\n%s;\n", ddl)
+	}
+
+	return rows.Err()
+}
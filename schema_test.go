@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWriteSchema(t *testing.T) {
+	db := newTestDB(t)
+	var out bytes.Buffer
+	if err := db.WriteSchema(&out); err != nil {
+		t.Fatalf("WriteSchema: %v", err)
+	}
+	schema := out.String()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"version line", fmt.Sprintf("-- Schema version: %d\n", schemaVersion)},
+		{"books table", "CREATE TABLE books ("},
+		{"books column", "gutenberg_id TEXT UNIQUE NOT NULL"},
+		{"authors table", "CREATE TABLE authors ("},
+		{"index", "CREATE INDEX idx_books_rights_status"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(schema, tt.want) {
+				t.Errorf("schema lacks %q:\n%s", tt.want, schema)
+			}
+		})
+	}
+	if !strings.HasPrefix(schema, "-- Schema version:") {
+		t.Errorf("schema doesn't start with the version line:\n%.200s", schema)
+	}
+	if strings.Contains(schema, "sqlite_") {
+		t.Error("schema includes SQLite's internal tables")
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil || version != schemaVersion {
+		t.Errorf("SchemaVersion() = %d, %v; want %d", version, err, schemaVersion)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// searchIndexSchema creates the FTS5 index over book titles, descriptions and
+// summaries. It is an external-content table backed by books, kept in sync by
+// triggers so every insert, upsert and delete of a book updates the index.
+const searchIndexSchema = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS books_fts USING fts5(
+		title, description, summary,
+		content='books', content_rowid='id'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS books_fts_insert AFTER INSERT ON books BEGIN
+		INSERT INTO books_fts (rowid, title, description, summary)
+		VALUES (new.id, new.title, new.description, new.summary);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS books_fts_delete AFTER DELETE ON books BEGIN
+		INSERT INTO books_fts (books_fts, rowid, title, description, summary)
+		VALUES ('delete', old.id, old.title, old.description, old.summary);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS books_fts_update AFTER UPDATE OF title, description, summary ON books BEGIN
+		INSERT INTO books_fts (books_fts, rowid, title, description, summary)
+		VALUES ('delete', old.id, old.title, old.description, old.summary);
+		INSERT INTO books_fts (rowid, title, description, summary)
+		VALUES (new.id, new.title, new.description, new.summary);
+	END;
+`
+
+// initSearchIndex creates the full-text index on SQLite. A build without FTS5
+// only logs a warning; SearchBooks then falls back to a LIKE scan. Books
+// imported before the index existed are indexed when it is first created.
+func (db *DB) initSearchIndex() error {
+	if db.driver != DriverSQLite {
+		return nil
+	}
+
+	existed, err := db.hasSearchIndex()
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.conn.Exec(searchIndexSchema); err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			slog.Warn("full-text search unavailable: SQLite built without FTS5; search will scan instead")
+			return nil
+		}
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	if !existed {
+		return db.RebuildSearchIndex()
+	}
+	return nil
+}
+
+// RebuildSearchIndex reindexes every book from the books table
+func (db *DB) RebuildSearchIndex() error {
+	if _, err := db.conn.Exec(`INSERT INTO books_fts (books_fts) VALUES ('rebuild')`); err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+	return nil
+}
+
+// hasSearchIndex reports whether the books_fts table exists
+func (db *DB) hasSearchIndex() (bool, error) {
+	if db.driver != DriverSQLite {
+		return false, nil
+	}
+	var name string
+	err := db.conn.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'books_fts'`).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check for search index: %w", err)
+	}
+	return true, nil
+}
+
+// SearchBooks returns up to limit books whose title, description or summary
+// match query, best match first. Every word of the query must match. Without
+// a full-text index (PostgreSQL, or SQLite lacking FTS5) it falls back to a
+// substring scan ordered by downloads.
+func (db *DB) SearchBooks(query string, limit int) ([]*Book, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return []*Book{}, nil
+	}
+
+	indexed, err := db.hasSearchIndex()
+	if err != nil {
+		return nil, err
+	}
+	if !indexed {
+		return db.scanSearch(terms, limit)
+	}
+
+	return db.queryBooks(`
+		SELECT `+bookColumns+` FROM books
+		JOIN (
+			SELECT rowid AS match_id, rank FROM books_fts WHERE books_fts MATCH ?
+		) matches ON matches.match_id = books.id
+		ORDER BY matches.rank, download_count DESC
+		LIMIT ?
+	`, ftsQuery(terms), limit)
+}
+
+// ftsQuery quotes each term as an FTS5 string so punctuation in user input,
+// such as hyphens or colons, is matched rather than parsed as query syntax
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// scanSearch is SearchBooks without an index: every term must appear in the
+// title, description or summary
+func (db *DB) scanSearch(terms []string, limit int) ([]*Book, error) {
+	var where []string
+	var args []interface{}
+	for _, term := range terms {
+		where = append(where, `(title LIKE '%' || ? || '%' OR description LIKE '%' || ? || '%' OR summary LIKE '%' || ? || '%')`)
+		args = append(args, term, term, term)
+	}
+	args = append(args, limit)
+
+	return db.queryBooks(`
+		SELECT `+bookColumns+` FROM books
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY download_count DESC, id
+		LIMIT ?
+	`, args...)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ShardSet routes books to one SQLite database per language. Each shard has
+// its own writer goroutine, so shards are written concurrently while every
+// individual file still sees a single writer.
+type ShardSet struct {
+	basePath  string
+	buffer    int
+	configure func(*DB)
+	stats     *ImportStats
+	manifest  *Manifest
+	// sqlite is the journal and synchronous modes shards are opened with
+	sqlite SQLiteOptions
+
+	mu      sync.Mutex
+	writers map[string]*shardWriter
+	wg      sync.WaitGroup
+	drain   sync.Once
+}
+
+// shardWriter owns one shard database and the channel feeding it
+type shardWriter struct {
+	db    *DB
+	books chan *Book
+}
+
+// NewShardSet creates a ShardSet whose shard files are derived from basePath,
+// e.g. "pg.db" becomes "pg-en.db", "pg-fr.db". configure, if non-nil, is
+// applied to each shard database after it is opened.
+func NewShardSet(basePath string, buffer int, configure func(*DB)) *ShardSet {
+	return &ShardSet{
+		basePath:  basePath,
+		buffer:    buffer,
+		configure: configure,
+		sqlite:    DefaultSQLiteOptions(),
+		writers:   make(map[string]*shardWriter),
+	}
+}
+
+// SetSQLiteOptions sets the journal and synchronous modes for shards opened
+// from now on
+func (s *ShardSet) SetSQLiteOptions(opts SQLiteOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sqlite = opts
+}
+
+// ShardKey returns the shard a book belongs to, based on its language
+func ShardKey(book *Book) string {
+	lang := strings.ToLower(strings.TrimSpace(book.Language))
+	if lang == "" {
+		return "unknown"
+	}
+	for _, r := range lang {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return "unknown"
+		}
+	}
+	return lang
+}
+
+// ShardPath returns the database path for a shard key
+func (s *ShardSet) ShardPath(key string) string {
+	ext := filepath.Ext(s.basePath)
+	return strings.TrimSuffix(s.basePath, ext) + "-" + key + ext
+}
+
+// BookExists checks whether a book already exists in its shard
+func (s *ShardSet) BookExists(book *Book) (bool, error) {
+	writer, err := s.writer(ShardKey(book))
+	if err != nil {
+		return false, err
+	}
+	return writer.db.BookExists(book.GutenbergID)
+}
+
+// ContainsID reports whether a book with the Gutenberg ID exists in any shard
+// opened so far. Shards are opened as books reach them, so false doesn't rule
+// out the book being in a shard file not yet opened in this run.
+func (s *ShardSet) ContainsID(gutenbergID string) (bool, error) {
+	s.mu.Lock()
+	writers := make([]*shardWriter, 0, len(s.writers))
+	for _, writer := range s.writers {
+		writers = append(writers, writer)
+	}
+	s.mu.Unlock()
+
+	for _, writer := range writers {
+		exists, err := writer.db.BookExists(gutenbergID)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+	return false, nil
+}
+
+// Send queues a book for insertion into its shard, opening the shard on first use
+func (s *ShardSet) Send(book *Book) error {
+	writer, err := s.writer(ShardKey(book))
+	if err != nil {
+		return err
+	}
+	writer.books <- book
+	return nil
+}
+
+// Drain stops the shard writers once they have stored every book sent to
+// them, and waits for them. No book may be sent afterwards; calling it again
+// does nothing.
+func (s *ShardSet) Drain() {
+	s.drain.Do(func() {
+		s.mu.Lock()
+		for _, writer := range s.writers {
+			close(writer.books)
+		}
+		s.mu.Unlock()
+
+		s.wg.Wait()
+	})
+}
+
+// Close drains the shard writers, marks each shard's import run with status
+// ("completed", "interrupted" or "failed", as for a single database) and
+// closes the shard databases
+func (s *ShardSet) Close(status string) error {
+	s.Drain()
+
+	var firstErr error
+	for key, writer := range s.writers {
+		if err := writer.db.FinishImportRun(status); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to finish run on shard %s: %w", key, err)
+		}
+		if err := writer.db.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close shard %s: %w", key, err)
+		}
+	}
+	return firstErr
+}
+
+// Paths returns the database paths of all opened shards
+func (s *ShardSet) Paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths := make([]string, 0, len(s.writers))
+	for key := range s.writers {
+		paths = append(paths, s.ShardPath(key))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// writer returns the writer for a shard, starting it if needed
+func (s *ShardSet) writer(key string) (*shardWriter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if writer, ok := s.writers[key]; ok {
+		return writer, nil
+	}
+
+	db, err := NewDBWithOptions(DriverSQLite, s.ShardPath(key), s.sqlite)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shard %s: %w", key, err)
+	}
+	if s.configure != nil {
+		s.configure(db)
+	}
+	if s.stats != nil {
+		db.SetWarningHandler(s.stats.RecordWarning)
+	}
+
+	writer := &shardWriter{
+		db:    db,
+		books: make(chan *Book, s.buffer),
+	}
+	s.writers[key] = writer
+
+	s.wg.Add(1)
+	go s.run(writer)
+
+	return writer, nil
+}
+
+// run inserts books from a shard's channel until it is closed
+func (s *ShardSet) run(writer *shardWriter) {
+	defer s.wg.Done()
+
+	for book := range writer.books {
+		if err := writer.db.InsertBook(book); err != nil {
+			s.stats.RecordFailure(fmt.Errorf("failed to insert book %s: %w", book.GutenbergID, err), "gutenberg_id", book.GutenbergID)
+		} else {
+			s.stats.RecordSuccess(book.Completeness())
+			if s.manifest != nil {
+				s.manifest.Commit(book.GutenbergID)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestShardKey(t *testing.T) {
+	tests := []struct {
+		language string
+		want     string
+	}{
+		{"en", "en"},
+		{" FR ", "fr"},
+		{"zh-hans", "zh-hans"},
+		{"", "unknown"},
+		{"../etc", "unknown"},
+		{"e n", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := ShardKey(&Book{Language: tt.language}); got != tt.want {
+			t.Errorf("ShardKey(%q) = %q, want %q", tt.language, got, tt.want)
+		}
+	}
+}
+
+func TestShardedImportWritesEachShard(t *testing.T) {
+	dir := t.TempDir()
+	languages := map[string][]string{
+		"en":      {"1", "2", "3", "4", "5", "6", "7"},
+		"fr":      {"10", "11", "12", "13", "14"},
+		"de":      {"20", "21", "22"},
+		"unknown": {"30"},
+	}
+	docs := make(map[string]string)
+	var names []string
+	for language, ids := range languages {
+		for _, id := range ids {
+			body := ""
+			if language != "unknown" {
+				body = languageXML(language)
+			}
+			name := fmt.Sprintf("pg%s.rdf", id)
+			docs[name] = rdfXML(ebookXML(id, "Title "+id, body))
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	files := writeRDFFiles(t, filepath.Join(dir, "rdf"), docs, names...)
+
+	tests := []struct {
+		name   string
+		status string
+	}{
+		{"completed", "completed"},
+		{"interrupted", "interrupted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := filepath.Join(t.TempDir(), "pg.db")
+			shards := NewShardSet(base, 2, func(shard *DB) {
+				if _, err := shard.StartImportRun("test"); err != nil {
+					t.Errorf("StartImportRun: %v", err)
+				}
+			})
+			importer := newTestImporter(nil)
+			importer.SetShards(shards)
+			if err := importer.Import(context.Background(), files); err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			if err := shards.Close(tt.status); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			if stats := importer.Stats(); stats.Successful != len(files) || stats.Failed != 0 {
+				t.Errorf("successful %d, failed %d; want %d, 0", stats.Successful, stats.Failed, len(files))
+			}
+			if got := len(shards.Paths()); got != len(languages) {
+				t.Errorf("%d shards written, want %d", got, len(languages))
+			}
+
+			for language, ids := range languages {
+				path := shards.ShardPath(language)
+				shard, err := OpenReadOnly(path)
+				if err != nil {
+					t.Fatalf("open shard %s: %v", path, err)
+				}
+				got, err := shard.queryStrings("SELECT gutenberg_id FROM books ORDER BY gutenberg_id")
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := append([]string(nil), ids...)
+				sort.Strings(want)
+				if fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Errorf("shard %s holds %v, want %v", language, got, want)
+				}
+				statuses, err := shard.queryStrings("SELECT status FROM import_runs")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(statuses) != 1 || statuses[0] != tt.status {
+					t.Errorf("shard %s import runs = %v, want [%s]", language, statuses, tt.status)
+				}
+				shard.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQL dump dialects accepted by ExportSQL
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+// sqlDumpTables lists the tables ExportSQL copies, parents before the tables
+// whose foreign keys point at them. The full-text index isn't dumped; SQLite
+// rebuilds it when the loaded database is first opened by this tool.
+var sqlDumpTables = []string{
+	"import_runs", "import_progress", "publishers", "books", "authors", "subjects", "bookshelves",
+	"book_authors", "book_contributors", "book_subjects", "book_languages", "book_classifications",
+	"book_bookshelves", "formats", "raw_rdf",
+}
+
+// sqlDumpBatchSize is the number of rows per INSERT statement
+const sqlDumpBatchSize = 500
+
+// ExportSQL writes the whole catalog as a SQL script for psql -f or sqlite3:
+// the schema, as the importer would create it for dialect, followed by
+// multi-row INSERT statements for every table in dependency order, all in
+// one transaction. Row IDs are kept, and on PostgreSQL the identity
+// sequences are moved past them so later imports can insert. Only the
+// columns of the importer's schema are dumped, so columns added by hand are
+// left out, and tables and columns an older database lacks are left empty.
+// The script expects an empty database.
+func (db *DB) ExportSQL(w io.Writer, dialect string) error {
+	ddl := func(stmt string) string { return stmt }
+	switch dialect {
+	case DialectPostgres:
+		ddl = postgresDDL.Replace
+	case DialectSQLite:
+	default:
+		return fmt.Errorf("unsupported SQL dialect %q (use %s or %s)", dialect, DialectPostgres, DialectSQLite)
+	}
+
+	schemaColumns, err := catalogColumns()
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "-- Project Gutenberg catalog dump (%s)\nBEGIN;\n%s\n", dialect, strings.TrimSpace(ddl(catalogSchema))); err != nil {
+		return err
+	}
+	for _, migration := range indexMigrations {
+		if !strings.HasPrefix(migration, "CREATE") {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s;\n", ddl(migration)); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range sqlDumpTables {
+		hasID, err := db.dumpTable(w, table, schemaColumns[table], dialect)
+		if err != nil {
+			return err
+		}
+		if hasID && dialect == DialectPostgres {
+			if _, err := fmt.Fprintf(w, "SELECT setval(pg_get_serial_sequence('%s', 'id'), MAX(id)) FROM %s;\n", table, table); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = fmt.Fprintln(w, "\nCOMMIT;")
+	return err
+}
+
+// catalogColumns returns the columns of each dumped table in the importer's
+// current schema, read from a new in-memory catalog
+func catalogColumns() (map[string][]string, error) {
+	catalog, err := NewDB(MemoryDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reference schema: %w", err)
+	}
+	defer catalog.Close()
+
+	columns := make(map[string][]string)
+	for _, table := range sqlDumpTables {
+		if columns[table], err = catalog.tableColumns(table); err != nil {
+			return nil, err
+		}
+	}
+	return columns, nil
+}
+
+// tableColumns returns the column names of a table, or nil if the database
+// has no such table
+func (db *DB) tableColumns(table string) ([]string, error) {
+	rows, err := db.conn.Query("SELECT * FROM " + table + " LIMIT 0")
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") || strings.Contains(err.Error(), "does not exist") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s columns: %w", table, err)
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+// dumpTable writes the rows of one table as INSERT statements, copying the
+// schema columns the database has, and reports whether the table has an id
+// column
+func (db *DB) dumpTable(w io.Writer, table string, schemaColumns []string, dialect string) (bool, error) {
+	if _, err := fmt.Fprintf(w, "\n-- %s\n", table); err != nil {
+		return false, err
+	}
+	existing, err := db.tableColumns(table)
+	if err != nil {
+		return false, err
+	}
+	var columns []string
+	for _, column := range existing {
+		if containsString(schemaColumns, column) {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return false, nil
+	}
+
+	rows, err := db.conn.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), table))
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s columns: %w", table, err)
+	}
+	booleans := make([]bool, len(types))
+	for i, t := range types {
+		booleans[i] = strings.HasPrefix(strings.ToUpper(t.DatabaseTypeName()), "BOOL")
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", table, strings.Join(columns, ", "))
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	n := 0
+	var row strings.Builder
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return false, fmt.Errorf("failed to scan %s: %w", table, err)
+		}
+		row.Reset()
+		if n%sqlDumpBatchSize == 0 {
+			if n > 0 {
+				row.WriteString(";\n")
+			}
+			row.WriteString(insert)
+		} else {
+			row.WriteString(",\n")
+		}
+		row.WriteString("(")
+		for i, value := range values {
+			if i > 0 {
+				row.WriteString(", ")
+			}
+			row.WriteString(sqlLiteral(value, booleans[i], dialect))
+		}
+		row.WriteString(")")
+		if _, err := io.WriteString(w, row.String()); err != nil {
+			return false, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	if n > 0 {
+		if _, err := io.WriteString(w, ";\n"); err != nil {
+			return false, err
+		}
+	}
+	return containsString(columns, "id"), nil
+}
+
+// sqlLiteral renders a scanned value as a SQL literal for dialect. Strings
+// are single-quoted with embedded quotes doubled, which is all either dialect
+// needs since PostgreSQL treats backslashes literally by default. boolean
+// marks a BOOLEAN column, which SQLite stores as 0 or 1 but PostgreSQL only
+// accepts as TRUE or FALSE.
+func sqlLiteral(value interface{}, boolean bool, dialect string) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		if boolean && dialect == DialectPostgres {
+			return sqlLiteral(v != 0, false, dialect)
+		}
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return sqlQuote(v.Format("2006-01-02 15:04:05.999999999-07:00"))
+	case []byte:
+		if dialect == DialectPostgres {
+			return `'\x` + hex.EncodeToString(v) + `'::bytea`
+		}
+		return "X'" + hex.EncodeToString(v) + "'"
+	case string:
+		return sqlQuote(v)
+	default:
+		return sqlQuote(fmt.Sprint(v))
+	}
+}
+
+// sqlQuote quotes a string as a SQL literal
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
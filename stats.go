@@ -0,0 +1,344 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Size bucket thresholds for approx_size, in bytes of plain text
+const (
+	shortBookMaxSize  = 100 * 1024 // roughly under 20,000 words
+	mediumBookMaxSize = 500 * 1024 // roughly under 100,000 words
+)
+
+// Size bucket names
+const (
+	SizeShort   = "short"
+	SizeMedium  = "medium"
+	SizeLong    = "long"
+	SizeUnknown = "unknown"
+)
+
+// SizeBucket classifies an approximate plain-text size
+func SizeBucket(size *int64) string {
+	switch {
+	case size == nil:
+		return SizeUnknown
+	case *size < shortBookMaxSize:
+		return SizeShort
+	case *size < mediumBookMaxSize:
+		return SizeMedium
+	default:
+		return SizeLong
+	}
+}
+
+// SizeBucketCounts returns the number of books in each size bucket
+func (db *DB) SizeBucketCounts() (map[string]int, error) {
+	rows, err := db.conn.Query(`
+		SELECT CASE
+			WHEN approx_size IS NULL THEN ?
+			WHEN approx_size < ? THEN ?
+			WHEN approx_size < ? THEN ?
+			ELSE ?
+		END AS bucket, COUNT(*)
+		FROM books
+		GROUP BY bucket
+	`, SizeUnknown, shortBookMaxSize, SizeShort, mediumBookMaxSize, SizeMedium, SizeLong)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query size buckets: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var bucket string
+		var count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan size bucket: %w", err)
+		}
+		counts[bucket] = count
+	}
+	return counts, rows.Err()
+}
+
+// FormatTypeUnknown is the FormatTypeCounts bucket for formats without a type
+const FormatTypeUnknown = "unknown"
+
+// normalizeFormatType reduces a format's MIME type to its bare, lowercase
+// media type, so that variants such as "text/plain; charset=utf-8" and
+// "text/plain" are counted together
+func normalizeFormatType(formatType string) string {
+	mediaType, _, _ := strings.Cut(formatType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return FormatTypeUnknown
+	}
+	return mediaType
+}
+
+// FormatTypeCounts returns the number of format files of each type, keyed by
+// the normalized MIME type (see normalizeFormatType)
+func (db *DB) FormatTypeCounts() (map[string]int, error) {
+	rows, err := db.conn.Query(`SELECT format_type, COUNT(*) FROM formats GROUP BY format_type`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query format types: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var formatType string
+		var count int
+		if err := rows.Scan(&formatType, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan format type: %w", err)
+		}
+		counts[normalizeFormatType(formatType)] += count
+	}
+	return counts, rows.Err()
+}
+
+// UnknownDecade is the BooksByIssuedDecade bucket for books without an
+// issued_date year. No Gutenberg book was issued in the years 0-9.
+const UnknownDecade = 0
+
+// issuedDecade returns the decade of the year in an issued_date, e.g. 1990
+// for "1997-03-01", or UnknownDecade if it has no year
+func issuedDecade(issued string) int {
+	year, _ := extractYear(issued)
+	if year == nil {
+		return UnknownDecade
+	}
+	decade := *year / 10 * 10
+	if *year < 0 && *year%10 != 0 {
+		decade -= 10 // round BCE years down, so -5 is in the -10s
+	}
+	return decade
+}
+
+// BooksByIssuedDecade returns the number of books issued in each decade,
+// keyed by its first year, with books whose issued_date has no year under
+// UnknownDecade. issued_date is free text, so years are read from it with
+// the same pattern as author life dates.
+func (db *DB) BooksByIssuedDecade() (map[int]int, error) {
+	rows, err := db.conn.Query(`SELECT COALESCE(issued_date, ''), COUNT(*) FROM books GROUP BY issued_date`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query issued dates: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var issued string
+		var count int
+		if err := rows.Scan(&issued, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan issued date: %w", err)
+		}
+		counts[issuedDecade(issued)] += count
+	}
+	return counts, rows.Err()
+}
+
+// PrintStats writes the catalog statistics report
+func (db *DB) PrintStats(w io.Writer) error {
+	buckets, err := db.SizeBucketCounts()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Books by size (largest plain-text format):\n")
+	for _, bucket := range []string{SizeShort, SizeMedium, SizeLong, SizeUnknown} {
+		fmt.Fprintf(w, "  %-8s %d\n", bucket+":", buckets[bucket])
+	}
+
+	total, err := db.TotalDownloads()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nTotal downloads: %d\n", total)
+
+	formatTypes, err := db.FormatTypeCounts()
+	if err != nil {
+		return err
+	}
+	types := make([]string, 0, len(formatTypes))
+	for formatType := range formatTypes {
+		types = append(types, formatType)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if formatTypes[types[i]] != formatTypes[types[j]] {
+			return formatTypes[types[i]] > formatTypes[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	fmt.Fprintf(w, "\nFormat files by type:\n")
+	for _, formatType := range types {
+		fmt.Fprintf(w, "  %-8d %s\n", formatTypes[formatType], formatType)
+	}
+
+	decades, err := db.BooksByIssuedDecade()
+	if err != nil {
+		return err
+	}
+	years := make([]int, 0, len(decades))
+	for decade := range decades {
+		if decade != UnknownDecade {
+			years = append(years, decade)
+		}
+	}
+	sort.Ints(years)
+	fmt.Fprintf(w, "\nBooks by issued decade:\n")
+	for _, decade := range years {
+		fmt.Fprintf(w, "  %-8s %d\n", fmt.Sprintf("%ds:", decade), decades[decade])
+	}
+	if n := decades[UnknownDecade]; n > 0 {
+		fmt.Fprintf(w, "  %-8s %d\n", "unknown:", n)
+	}
+
+	return nil
+}
+
+// TotalDownloads returns the sum of download_count over all books
+func (db *DB) TotalDownloads() (int64, error) {
+	var total int64
+	if err := db.conn.QueryRow(`SELECT COALESCE(SUM(download_count), 0) FROM books`).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to sum downloads: %w", err)
+	}
+	return total, nil
+}
+
+// TopBooks returns a page of the most downloaded books, skipping offset
+// books. Book columns are filled in, and Authors holds just the name of the
+// primary author (the first linked to the book) when there is one.
+func (db *DB) TopBooks(limit, offset int) ([]*Book, error) {
+	rows, err := db.conn.Query(db.rebind(`
+		SELECT `+bookColumns+`, (
+			SELECT a.name FROM book_authors ba
+			JOIN authors a ON a.id = ba.author_id
+			WHERE ba.book_id = books.id
+			ORDER BY a.id
+			LIMIT 1
+		)
+		FROM books
+		ORDER BY COALESCE(download_count, 0) DESC, id
+		LIMIT ? OFFSET ?
+	`), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top books: %w", err)
+	}
+	defer rows.Close()
+
+	books := []*Book{}
+	for rows.Next() {
+		var author sql.NullString
+		book, _, err := scanBook(rows, &author)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan book: %w", err)
+		}
+		book.Authors = []Author{}
+		if author.Valid {
+			book.Authors = append(book.Authors, Author{Name: author.String})
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+// PrintTopBooks writes a ranked page of the most downloaded books
+func (db *DB) PrintTopBooks(w io.Writer, limit, offset int) error {
+	books, err := db.TopBooks(limit, offset)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nMost downloaded books:\n")
+	for i, book := range books {
+		author := "unknown author"
+		if len(book.Authors) > 0 {
+			author = book.Authors[0].Name
+		}
+		fmt.Fprintf(w, "  %3d. %-8d %s (%s) [#%s]\n", offset+i+1, book.DownloadCount, book.Title, author, book.GutenbergID)
+	}
+	return nil
+}
+
+// RankedName is an author or subject with the number of books linked to it
+type RankedName struct {
+	Name  string
+	Books int
+}
+
+// AuthorsByBookCount returns the limit authors credited on the most books,
+// ties broken by name
+func (db *DB) AuthorsByBookCount(limit int) ([]RankedName, error) {
+	return db.rankNames(`
+		SELECT a.name, COUNT(*) AS books FROM book_authors ba
+		JOIN authors a ON a.id = ba.author_id
+		GROUP BY a.id, a.name
+		ORDER BY books DESC, a.name
+		LIMIT ?
+	`, limit)
+}
+
+// SubjectsByBookCount returns the limit subjects with the most books, ties
+// broken by subject
+func (db *DB) SubjectsByBookCount(limit int) ([]RankedName, error) {
+	return db.rankNames(`
+		SELECT s.subject, COUNT(*) AS books FROM book_subjects bs
+		JOIN subjects s ON s.id = bs.subject_id
+		GROUP BY s.id, s.subject
+		ORDER BY books DESC, s.subject
+		LIMIT ?
+	`, limit)
+}
+
+// rankNames runs a query selecting a name and a book count
+func (db *DB) rankNames(query string, limit int) ([]RankedName, error) {
+	rows, err := db.conn.Query(db.rebind(query), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank: %w", err)
+	}
+	defer rows.Close()
+
+	ranked := []RankedName{}
+	for rows.Next() {
+		var r RankedName
+		if err := rows.Scan(&r.Name, &r.Books); err != nil {
+			return nil, fmt.Errorf("failed to scan ranking: %w", err)
+		}
+		ranked = append(ranked, r)
+	}
+	return ranked, rows.Err()
+}
+
+// PrintTopAuthorsAndSubjects writes how many distinct authors and subjects
+// are linked to books, and the limit largest of each by book count
+func (db *DB) PrintTopAuthorsAndSubjects(w io.Writer, limit int) error {
+	sections := []struct {
+		title, countQuery string
+		rank              func(int) ([]RankedName, error)
+	}{
+		{"authors", `SELECT COUNT(DISTINCT author_id) FROM book_authors`, db.AuthorsByBookCount},
+		{"subjects", `SELECT COUNT(DISTINCT subject_id) FROM book_subjects`, db.SubjectsByBookCount},
+	}
+
+	for _, section := range sections {
+		var total int
+		if err := db.conn.QueryRow(section.countQuery).Scan(&total); err != nil {
+			return fmt.Errorf("failed to count %s: %w", section.title, err)
+		}
+		ranked, err := section.rank(limit)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "\nTop %s by number of books (%d distinct):\n", section.title, total)
+		for i, r := range ranked {
+			fmt.Fprintf(w, "  %3d. %-6d %s\n", i+1, r.Books, r.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApproxSizeBuckets(t *testing.T) {
+	size := func(n int64) *int64 { return &n }
+	format := func(formatType string, fileSize *int64) Format {
+		return Format{Type: formatType, FileURL: fmt.Sprintf("https://example.org/%s/%v", formatType, fileSize), FileSize: fileSize}
+	}
+
+	tests := []struct {
+		id         string
+		formats    []Format
+		wantSize   *int64
+		wantBucket string
+	}{
+		{"1", []Format{format("text/plain; charset=utf-8", size(50*1024))}, size(50 * 1024), SizeShort},
+		{"2", []Format{
+			format("text/plain; charset=us-ascii", size(120*1024)),
+			format("text/plain; charset=utf-8", size(300*1024)),
+			format("application/epub+zip", size(900*1024)),
+		}, size(300 * 1024), SizeMedium},
+		{"3", []Format{format("text/plain", size(500*1024))}, size(500 * 1024), SizeLong},
+		{"4", []Format{format("application/epub+zip", size(900*1024))}, nil, SizeUnknown},
+		{"5", []Format{format("text/plain", nil)}, nil, SizeUnknown},
+		{"6", nil, nil, SizeUnknown},
+	}
+
+	db := newTestDB(t)
+	want := map[string]int{}
+	for _, tt := range tests {
+		book := &Book{GutenbergID: tt.id, Title: "Book " + tt.id, Formats: tt.formats}
+		got := book.ApproxSize()
+		if fmt.Sprint(deref(got)) != fmt.Sprint(deref(tt.wantSize)) {
+			t.Errorf("book %s: ApproxSize = %v, want %v", tt.id, deref(got), deref(tt.wantSize))
+		}
+		if bucket := SizeBucket(got); bucket != tt.wantBucket {
+			t.Errorf("book %s: SizeBucket = %s, want %s", tt.id, bucket, tt.wantBucket)
+		}
+		insertTestBooks(t, db, book)
+		want[tt.wantBucket]++
+	}
+
+	counts, err := db.SizeBucketCounts()
+	if err != nil {
+		t.Fatalf("SizeBucketCounts: %v", err)
+	}
+	if fmt.Sprint(counts) != fmt.Sprint(want) {
+		t.Errorf("SizeBucketCounts = %v, want %v", counts, want)
+	}
+}
+
+// deref returns *n, or "nil" for a nil pointer, for comparing and printing
+func deref(n *int64) interface{} {
+	if n == nil {
+		return "nil"
+	}
+	return *n
+}
+
+func TestIssuedDecade(t *testing.T) {
+	tests := []struct {
+		issued string
+		want   int
+	}{
+		{"1997-03-01", 1990},
+		{"1971-12-01", 1970},
+		{"2000-01-01", 2000},
+		{"2009", 2000},
+		{"c. 1855", 1850},
+		{"-5", -10},
+		{"-40", -40},
+		{"", UnknownDecade},
+		{"None", UnknownDecade},
+	}
+	for _, tt := range tests {
+		if got := issuedDecade(tt.issued); got != tt.want {
+			t.Errorf("issuedDecade(%q) = %d, want %d", tt.issued, got, tt.want)
+		}
+	}
+}
+
+func TestBooksByIssuedDecade(t *testing.T) {
+	db := newTestDB(t)
+	issued := []string{"1971-12-01", "1979-06-30", "1997-03-01", "1998-01-01", "1999-12-31", "2004-08-01", "", "unknown"}
+	for i, date := range issued {
+		insertTestBooks(t, db, &Book{GutenbergID: fmt.Sprint(i + 1), Title: "Book", IssuedDate: date})
+	}
+
+	got, err := db.BooksByIssuedDecade()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{1970: 2, 1990: 3, 2000: 1, UnknownDecade: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BooksByIssuedDecade() = %v, want %v", got, want)
+	}
+
+	var out strings.Builder
+	if err := db.PrintStats(&out); err != nil {
+		t.Fatal(err)
+	}
+	_, section, ok := strings.Cut(out.String(), "Books by issued decade:\n")
+	wantSection := "  1970s:   2\n  1990s:   3\n  2000s:   1\n  unknown: 2\n"
+	if !ok || section != wantSection {
+		t.Errorf("stats report:\n%s\nwant it to end with the decades\n%s", out.String(), wantSection)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Supported database drivers
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Store is the write side of the catalog used by the importer. *DB satisfies
+// it for both the SQLite and PostgreSQL backends.
+type Store interface {
+	InsertBook(book *Book) error
+	BatchInsertBooks(books []*Book) []error
+	InsertBooksTwoPhase(books []*Book) []error
+	BookExists(gutenbergID string) (bool, error)
+	MarkProcessed(file, hash, status string) error
+	MarkProcessedBatch(records []ProgressRecord) error
+	WasProcessed(file, hash string) (bool, error)
+	SetWarningHandler(handler func(gutenbergID, message string))
+	Close() error
+}
+
+var _ Store = (*DB)(nil)
+
+// DetectDriver picks the driver for a DSN: postgres:// and postgresql://
+// URLs use PostgreSQL, anything else is treated as a SQLite file path
+func DetectDriver(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return DriverPostgres
+	}
+	return DriverSQLite
+}
+
+// rebind rewrites ? placeholders to the driver's placeholder style.
+// PostgreSQL uses numbered $1, $2, ... placeholders; quoted strings are left alone.
+func (db *DB) rebind(query string) string {
+	if db.driver != DriverPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inQuote := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inQuote = !inQuote
+			b.WriteByte(c)
+		case c == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// dbTx is a transaction that rebinds placeholders for the database's driver,
+// so write paths can be shared between SQLite and PostgreSQL
+type dbTx struct {
+	*sql.Tx
+	db *DB
+	// stmts, when non-nil, caches a prepared statement per query so a
+	// transaction running many inserts prepares each statement once
+	stmts map[string]*sql.Stmt
+	// warnings are the data issues found by the transaction's writes,
+	// reported only once it commits
+	warnings []txWarning
+}
+
+// txWarning is a data issue held by a transaction until it commits
+type txWarning struct {
+	gutenbergID, message string
+}
+
+// begin starts a transaction on the database
+func (db *DB) begin() (*dbTx, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return &dbTx{Tx: tx, db: db}, nil
+}
+
+// beginPrepared starts a transaction that prepares each distinct query once
+// and reuses the statement for the rest of the transaction
+func (db *DB) beginPrepared() (*dbTx, error) {
+	tx, err := db.begin()
+	if err != nil {
+		return nil, err
+	}
+	tx.stmts = make(map[string]*sql.Stmt)
+	return tx, nil
+}
+
+// stmt returns the cached prepared statement for a query, preparing it on
+// first use. It returns nil when the transaction doesn't cache statements.
+func (tx *dbTx) stmt(query string) (*sql.Stmt, error) {
+	if tx.stmts == nil {
+		return nil, nil
+	}
+	if stmt, ok := tx.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := tx.Tx.Prepare(tx.db.rebind(query))
+	if err != nil {
+		return nil, err
+	}
+	tx.stmts[query] = stmt
+	return stmt, nil
+}
+
+// warn holds a data issue until the transaction commits, so a write that is
+// rolled back, and then retried or redone book by book, reports it only once
+func (tx *dbTx) warn(gutenbergID, message string) {
+	tx.warnings = append(tx.warnings, txWarning{gutenbergID, message})
+}
+
+// Commit commits the transaction, then reports the warnings it held
+func (tx *dbTx) Commit() error {
+	if err := tx.Tx.Commit(); err != nil {
+		return err
+	}
+	for _, w := range tx.warnings {
+		tx.db.warn(w.gutenbergID, w.message)
+	}
+	tx.warnings = nil
+	return nil
+}
+
+// use binds a statement prepared on the database to the transaction
+func (tx *dbTx) use(stmt *sql.Stmt) *sql.Stmt {
+	return tx.Tx.Stmt(stmt)
+}
+
+// Exec executes a query within the transaction
+func (tx *dbTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := tx.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt != nil {
+		return stmt.Exec(args...)
+	}
+	return tx.Tx.Exec(tx.db.rebind(query), args...)
+}
+
+// Query runs a query within the transaction
+func (tx *dbTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := tx.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt != nil {
+		return stmt.Query(args...)
+	}
+	return tx.Tx.Query(tx.db.rebind(query), args...)
+}
+
+// QueryRow runs a single-row query within the transaction. A failure to
+// prepare the statement is reported when the row is scanned.
+func (tx *dbTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	if stmt, err := tx.stmt(query); err == nil && stmt != nil {
+		return stmt.QueryRow(args...)
+	}
+	return tx.Tx.QueryRow(tx.db.rebind(query), args...)
+}
+
+// postgresDDL adapts the SQLite schema statements to PostgreSQL
+var postgresDDL = strings.NewReplacer(
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY",
+	"INTEGER", "BIGINT",
+	"REAL", "DOUBLE PRECISION",
+	"BLOB", "BYTEA",
+	"ADD COLUMN", "ADD COLUMN IF NOT EXISTS",
+	"CREATE VIEW IF NOT EXISTS", "CREATE OR REPLACE VIEW",
+)
+
+// ddl rewrites a schema statement for the database's driver. The schema is
+// written once for SQLite; PostgreSQL gets identity keys, 64-bit integers,
+// byte arrays, idempotent column additions and replaceable views.
+func (db *DB) ddl(stmt string) string {
+	if db.driver != DriverPostgres {
+		return stmt
+	}
+	return postgresDDL.Replace(stmt)
+}
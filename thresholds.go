@@ -0,0 +1,36 @@
+package main
+
+import "fmt"
+
+// RelationThresholds sets how many authors, subjects or formats a book may
+// have before the importer warns about it. Books over a threshold are still
+// imported in full; a zero threshold disables that check.
+type RelationThresholds struct {
+	Authors  int
+	Subjects int
+	Formats  int
+}
+
+// DefaultRelationThresholds returns thresholds well above what real catalog
+// records carry, so only likely data errors are reported
+func DefaultRelationThresholds() RelationThresholds {
+	return RelationThresholds{
+		Authors:  20,
+		Subjects: 30,
+		Formats:  50,
+	}
+}
+
+// Check returns a warning for each relation count of book above its threshold
+func (t RelationThresholds) Check(book *Book) []string {
+	var warnings []string
+	check := func(name string, count, threshold int) {
+		if threshold > 0 && count > threshold {
+			warnings = append(warnings, fmt.Sprintf("has %d %s (threshold %d)", count, name, threshold))
+		}
+	}
+	check("authors", len(book.Authors), t.Authors)
+	check("subjects", len(book.Subjects), t.Subjects)
+	check("formats", len(book.Formats), t.Formats)
+	return warnings
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRelationThresholdsCheck(t *testing.T) {
+	book := func(authors, subjects, formats int) *Book {
+		b := &Book{}
+		for i := 0; i < authors; i++ {
+			b.Authors = append(b.Authors, Author{Name: fmt.Sprintf("Author %d", i)})
+		}
+		for i := 0; i < subjects; i++ {
+			b.Subjects = append(b.Subjects, fmt.Sprintf("Subject %d", i))
+		}
+		for i := 0; i < formats; i++ {
+			b.Formats = append(b.Formats, Format{FileURL: fmt.Sprintf("https://example.org/%d", i)})
+		}
+		return b
+	}
+	thresholds := RelationThresholds{Authors: 2, Subjects: 3, Formats: 4}
+
+	tests := []struct {
+		name       string
+		thresholds RelationThresholds
+		book       *Book
+		want       []string
+	}{
+		{"at thresholds", thresholds, book(2, 3, 4), nil},
+		{"authors over", thresholds, book(3, 0, 0), []string{"has 3 authors (threshold 2)"}},
+		{"all over", thresholds, book(5, 4, 9), []string{"has 5 authors (threshold 2)", "has 4 subjects (threshold 3)", "has 9 formats (threshold 4)"}},
+		{"disabled", RelationThresholds{}, book(50, 50, 50), nil},
+		{"defaults", DefaultRelationThresholds(), book(21, 30, 51), []string{"has 21 authors (threshold 20)", "has 51 formats (threshold 50)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.thresholds.Check(tt.book); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Check = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportWarnsOverThreshold(t *testing.T) {
+	var creators strings.Builder
+	for i := 1; i <= 4; i++ {
+		fmt.Fprintf(&creators, `<dcterms:creator><pgterms:agent rdf:about="2009/agents/%d"><pgterms:name>Author %d</pgterms:name></pgterms:agent></dcterms:creator>`, i, i)
+	}
+	docs := map[string]string{
+		"1": rdfXML(ebookXML("1", "Anthology", creators.String())),
+		"2": rdfXML(ebookXML("2", "Single Author", `<dcterms:creator><pgterms:agent rdf:about="2009/agents/1"><pgterms:name>Author 1</pgterms:name></pgterms:agent></dcterms:creator>`)),
+	}
+
+	db := newTestDB(t)
+	importer := newTestImporter(db)
+	importer.SetRelationThresholds(RelationThresholds{Authors: 3})
+	importTestDocs(t, importer, docs)
+
+	want := []string{"book 1: has 4 authors (threshold 3)"}
+	if got := importer.Stats().Warnings; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+	// The warning doesn't drop any data
+	if got := queryInt(t, db, "SELECT COUNT(*) FROM book_authors ba JOIN books b ON b.id = ba.book_id WHERE b.gutenberg_id = '1'"); got != 4 {
+		t.Errorf("book 1 has %d authors stored, want 4", got)
+	}
+	if got := importer.Stats().Successful; got != 2 {
+		t.Errorf("%d books imported, want 2", got)
+	}
+}
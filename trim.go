@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Book text fields whose trimming can be configured
+const (
+	FieldTitle            = "title"
+	FieldPublisher        = "publisher"
+	FieldLicense          = "license"
+	FieldRights           = "rights"
+	FieldIssued           = "issued"
+	FieldDescription      = "description"
+	FieldSummary          = "summary"
+	FieldProductionNotes  = "production_notes"
+	FieldReadingEaseScore = "reading_ease_score"
+)
+
+// trimmableFields lists every field accepted by TrimConfig
+var trimmableFields = []string{
+	FieldTitle, FieldPublisher, FieldLicense, FieldRights, FieldIssued,
+	FieldDescription, FieldSummary, FieldProductionNotes, FieldReadingEaseScore,
+}
+
+// TrimConfig controls which book text fields have leading and trailing
+// whitespace removed during parsing. Identifiers, languages, subjects,
+// bookshelves and author fields are always trimmed since they act as keys.
+type TrimConfig map[string]bool
+
+// DefaultTrimConfig trims every field except description, whose paragraph
+// whitespace is meaningful
+func DefaultTrimConfig() TrimConfig {
+	config := TrimConfig{}
+	for _, field := range trimmableFields {
+		config[field] = true
+	}
+	config[FieldDescription] = false
+	return config
+}
+
+// ParseTrimFields builds a TrimConfig from a comma-separated spec. The
+// keywords "default", "all" and "none" reset every field to that baseline; a
+// field name enables trimming for it and "-field" disables it. Items apply in
+// order, so "all,-summary" trims everything but summary and "all,default"
+// is the default set.
+func ParseTrimFields(spec string) (TrimConfig, error) {
+	config := DefaultTrimConfig()
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		switch item {
+		case "":
+			continue
+		case "default":
+			config = DefaultTrimConfig()
+			continue
+		case "all", "none":
+			for _, field := range trimmableFields {
+				config[field] = item == "all"
+			}
+			continue
+		}
+
+		enable := !strings.HasPrefix(item, "-")
+		field := strings.TrimPrefix(strings.TrimPrefix(item, "-"), "+")
+		if _, ok := config[field]; !ok {
+			return nil, fmt.Errorf("unknown trim field %q (valid fields: %s)", field, strings.Join(trimmableFields, ", "))
+		}
+		config[field] = enable
+	}
+
+	return config, nil
+}
+
+// apply returns value trimmed if trimming is enabled for field
+func (c TrimConfig) apply(field, value string) string {
+	if c[field] {
+		return strings.TrimSpace(value)
+	}
+	return value
+}
+
+// String lists the trimmed fields
+func (c TrimConfig) String() string {
+	var fields []string
+	for field, trim := range c {
+		if trim {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestParseTrimFields(t *testing.T) {
+	defaults := DefaultTrimConfig().String()
+	all := "description,issued,license,production_notes,publisher,reading_ease_score,rights,summary,title"
+
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"", defaults, false},
+		{"default", defaults, false},
+		{"all", all, false},
+		{"none", "", false},
+		{"all,default", defaults, false},
+		{"none,default", defaults, false},
+		{"default,all", all, false},
+		{"all,none", "", false},
+		{"none,all", all, false},
+		{"all,-summary", "description,issued,license,production_notes,publisher,reading_ease_score,rights,title", false},
+		{"-summary,all", all, false},
+		{"none,title,+summary", "summary,title", false},
+		{"description", "description," + defaults, false},
+		{"all,-description,default", defaults, false},
+		{"all, ,-title", "description,issued,license,production_notes,publisher,reading_ease_score,rights,summary", false},
+		{"subtitle", "", true},
+		{"all,-authors", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			config, err := ParseTrimFields(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTrimFields(%q) = %v, want an error", tt.spec, config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTrimFields(%q): %v", tt.spec, err)
+			}
+			if got := config.String(); got != tt.want {
+				t.Errorf("ParseTrimFields(%q) trims %q, want %q", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimConfigApply(t *testing.T) {
+	config := DefaultTrimConfig()
+	tests := []struct {
+		field string
+		value string
+		want  string
+	}{
+		{FieldTitle, "  Title \n", "Title"},
+		{FieldDescription, "\n  Paragraph one.\n\n  Paragraph two.\n", "\n  Paragraph one.\n\n  Paragraph two.\n"},
+		{"unknown", " value ", " value "},
+	}
+	for _, tt := range tests {
+		if got := config.apply(tt.field, tt.value); got != tt.want {
+			t.Errorf("apply(%s, %q) = %q, want %q", tt.field, tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnmappedReport counts RDF elements that are not mapped to any parser struct field
+type UnmappedReport struct {
+	FilesScanned int
+	Counts       map[string]int
+	mapped       map[string]bool
+}
+
+// NewUnmappedReport creates an UnmappedReport using the paths mapped by RDFDocument
+func NewUnmappedReport() *UnmappedReport {
+	return &UnmappedReport{
+		Counts: make(map[string]int),
+		mapped: mappedElementPaths(reflect.TypeOf(RDFDocument{})),
+	}
+}
+
+// Scan walks the XML tokens of a document and records every element whose path
+// isn't mapped. Only the outermost unmapped element is counted; its children are
+// implied by it.
+func (r *UnmappedReport) Scan(reader io.Reader) error {
+	decoder := xml.NewDecoder(reader)
+	decoder.Strict = false
+
+	var path []string
+	unmappedDepth := 0 // depth of the outermost unmapped element, 0 if none
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read XML token: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			path = append(path, elementKey(t.Name))
+			if unmappedDepth == 0 && !r.mapped[strings.Join(path, "/")] {
+				unmappedDepth = len(path)
+				r.Counts[displayPath(path)]++
+			}
+		case xml.EndElement:
+			if len(path) == unmappedDepth {
+				unmappedDepth = 0
+			}
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+
+	r.FilesScanned++
+	return nil
+}
+
+// Print writes the report sorted by descending occurrence count
+func (r *UnmappedReport) Print(w io.Writer) {
+	paths := make([]string, 0, len(r.Counts))
+	for path := range r.Counts {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if r.Counts[paths[i]] != r.Counts[paths[j]] {
+			return r.Counts[paths[i]] > r.Counts[paths[j]]
+		}
+		return paths[i] < paths[j]
+	})
+
+	fmt.Fprintf(w, "Unmapped RDF elements (%d files scanned):\n", r.FilesScanned)
+	if len(paths) == 0 {
+		fmt.Fprintf(w, "  (none)\n")
+		return
+	}
+	for _, path := range paths {
+		fmt.Fprintf(w, "  %8d  %s\n", r.Counts[path], path)
+	}
+}
+
+// DumpUnmapped parses each file normally and scans it for unmapped elements,
+// printing the aggregated report to w. Parse failures are reported but don't
+// stop the scan.
+func DumpUnmapped(rdfFiles []string, w io.Writer) error {
+	report := NewUnmappedReport()
+
+	for _, filePath := range rdfFiles {
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+
+		if _, err := ParseRDF(bytes.NewReader(content)); err != nil {
+			fmt.Fprintf(w, "Parse error in %s: %v\n", filePath, err)
+		}
+		if err := report.Scan(bytes.NewReader(content)); err != nil {
+			fmt.Fprintf(w, "Scan error in %s: %v\n", filePath, err)
+		}
+	}
+
+	report.Print(w)
+	return nil
+}
+
+// mappedElementPaths returns the set of element paths (namespace-qualified
+// names joined by "/") that the given struct type decodes
+func mappedElementPaths(t reflect.Type) map[string]bool {
+	paths := make(map[string]bool)
+
+	// The root element name comes from the XMLName field
+	root := ""
+	if field, ok := t.FieldByName("XMLName"); ok {
+		root = tagKey(strings.Split(field.Tag.Get("xml"), ",")[0])
+	}
+	paths[root] = true
+	collectMappedPaths(t, root, paths)
+
+	return paths
+}
+
+// collectMappedPaths records the element paths of t's fields under prefix
+func collectMappedPaths(t reflect.Type, prefix string, paths map[string]bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Name == "XMLName" {
+			continue
+		}
+		tag := field.Tag.Get("xml")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" || name == "-" || opts != "" {
+			continue // attributes, chardata and untagged fields aren't elements
+		}
+
+		path := prefix + "/" + tagKey(name)
+		paths[path] = true
+
+		collectMappedPaths(field.Type, path, paths)
+	}
+}
+
+// tagKey normalizes a struct tag name ("ns local") into an element key
+func tagKey(name string) string {
+	if _, _, ok := strings.Cut(name, " "); ok {
+		return name
+	}
+	return " " + name
+}
+
+// elementKey returns the namespace-qualified key for an element name
+func elementKey(name xml.Name) string {
+	return name.Space + " " + name.Local
+}
+
+// displayPath renders an element path using the conventional RDF prefixes
+func displayPath(path []string) string {
+	parts := make([]string, len(path))
+	for i, key := range path {
+		namespace, local, _ := strings.Cut(key, " ")
+		parts[i] = "{" + namespace + "}" + local
+		for prefix, uri := range RDFNamespaces {
+			if uri == namespace {
+				parts[i] = prefix + ":" + local
+				break
+			}
+		}
+	}
+	return strings.Join(parts, " > ")
+}
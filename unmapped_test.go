@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnmappedReportScan(t *testing.T) {
+	marc := `<pgterms:marc901>note</pgterms:marc901>`
+	tests := []struct {
+		name   string
+		docs   []string
+		counts map[string]int
+		absent []string
+	}{
+		{
+			name:   "known unmapped element",
+			docs:   []string{rdfXML(ebookXML("1", "T", marc))},
+			counts: map[string]int{"rdf:RDF > pgterms:ebook > pgterms:marc901": 1},
+			absent: []string{"rdf:RDF > pgterms:ebook > dcterms:title"},
+		},
+		{
+			name:   "counted across documents",
+			docs:   []string{rdfXML(ebookXML("1", "T", marc)), rdfXML(ebookXML("2", "U", marc+marc))},
+			counts: map[string]int{"rdf:RDF > pgterms:ebook > pgterms:marc901": 3},
+		},
+		{
+			name: "only the outermost unmapped element",
+			docs: []string{rdfXML(`<cc:Work rdf:about=""><cc:license rdf:resource="x"/></cc:Work>` + ebookXML("1", "T", ""))},
+			counts: map[string]int{
+				"rdf:RDF > {http://web.resource.org/cc/}Work": 1,
+			},
+			absent: []string{"rdf:RDF > {http://web.resource.org/cc/}Work > {http://web.resource.org/cc/}license"},
+		},
+		{
+			name:   "fully mapped document",
+			docs:   []string{rdfXML(ebookXML("1", "T", `<dcterms:rights>Public domain</dcterms:rights>`))},
+			counts: map[string]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewUnmappedReport()
+			for _, doc := range tt.docs {
+				if err := report.Scan(strings.NewReader(doc)); err != nil {
+					t.Fatalf("Scan: %v", err)
+				}
+			}
+			if report.FilesScanned != len(tt.docs) {
+				t.Errorf("FilesScanned = %d, want %d", report.FilesScanned, len(tt.docs))
+			}
+			for path, want := range tt.counts {
+				if got := report.Counts[path]; got != want {
+					t.Errorf("Counts[%q] = %d, want %d (all: %v)", path, got, want, report.Counts)
+				}
+			}
+			if len(tt.counts) == 0 && len(report.Counts) != 0 {
+				t.Errorf("Counts = %v, want none", report.Counts)
+			}
+			for _, path := range tt.absent {
+				if _, ok := report.Counts[path]; ok {
+					t.Errorf("%q reported as unmapped", path)
+				}
+			}
+		})
+	}
+}
+
+func TestDumpUnmapped(t *testing.T) {
+	dir := t.TempDir()
+	docs := map[string]string{
+		"pg1.rdf": rdfXML(ebookXML("1", "T", `<pgterms:marc901>note</pgterms:marc901>`)),
+		"pg2.rdf": "<rdf:RDF",
+	}
+	files := writeRDFFiles(t, dir, docs, "pg1.rdf", "pg2.rdf")
+
+	var out bytes.Buffer
+	if err := DumpUnmapped(files, &out); err != nil {
+		t.Fatalf("DumpUnmapped: %v", err)
+	}
+	report := out.String()
+	for _, want := range []string{
+		"Unmapped RDF elements (1 files scanned):",
+		"1  rdf:RDF > pgterms:ebook > pgterms:marc901",
+		"Parse error in " + filepath.Join(dir, "pg2.rdf"),
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+}
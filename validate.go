@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Archive validation failure categories
+const (
+	failureUnreadable  = "unreadable file"
+	failureEmpty       = "empty file"
+	failureMalformed   = "malformed XML"
+	failureNoEbook     = "no ebook element"
+	failureDecode      = "decode error"
+	failureNoGutenberg = "missing Gutenberg ID"
+)
+
+// ArchiveValidation holds the result of parsing every file in an archive
+type ArchiveValidation struct {
+	TotalFiles int
+	Valid      int
+	// Failures maps a failure category to the errors recorded for it
+	Failures map[string][]string
+	mu       sync.Mutex
+}
+
+// Failed returns the total number of files that failed validation
+func (v *ArchiveValidation) Failed() int {
+	failed := 0
+	for _, errs := range v.Failures {
+		failed += len(errs)
+	}
+	return failed
+}
+
+// recordFailure adds a failure under the given category
+func (v *ArchiveValidation) recordFailure(category string, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.Failures[category] = append(v.Failures[category], err.Error())
+}
+
+// recordValid counts a file that parsed and validated cleanly
+func (v *ArchiveValidation) recordValid() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.Valid++
+}
+
+// ValidateArchive parses every RDF file without touching the database and
+// classifies each failure. Unlike a normal import nothing is written, so it is
+// safe to run repeatedly against the same archive.
+func ValidateArchive(rdfFiles []string, workers int) *ArchiveValidation {
+	result := &ArchiveValidation{
+		TotalFiles: len(rdfFiles),
+		Failures:   make(map[string][]string),
+	}
+
+	bar := newProgressBar(int64(len(rdfFiles)), "Validating archive")
+
+	fileChan := make(chan string, workers)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for filePath := range fileChan {
+				book, err := ParseRDFFile(filePath)
+				if err != nil {
+					result.recordFailure(classifyParseError(err), fmt.Errorf("%s: %w", filePath, err))
+				} else if book.GutenbergID == "" {
+					result.recordFailure(failureNoGutenberg, fmt.Errorf("no Gutenberg ID found in %s", filePath))
+				} else {
+					result.recordValid()
+				}
+				bar.Add(1)
+			}
+		}()
+	}
+
+	for _, file := range rdfFiles {
+		fileChan <- file
+	}
+	close(fileChan)
+
+	wg.Wait()
+	bar.Finish()
+
+	return result
+}
+
+// Print writes the validation summary and every failure grouped by category
+func (v *ArchiveValidation) Print(w io.Writer) {
+	fmt.Fprintf(w, "\n\nArchive Validation:\n")
+	fmt.Fprintf(w, "===================\n")
+	fmt.Fprintf(w, "Total files:     %d\n", v.TotalFiles)
+	fmt.Fprintf(w, "Valid:           %d\n", v.Valid)
+	fmt.Fprintf(w, "Failed:          %d\n", v.Failed())
+
+	if len(v.Failures) == 0 {
+		return
+	}
+
+	categories := make([]string, 0, len(v.Failures))
+	for category := range v.Failures {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	fmt.Fprintf(w, "\nFailures by category:\n")
+	for _, category := range categories {
+		fmt.Fprintf(w, "  %-22s %d\n", category+":", len(v.Failures[category]))
+	}
+
+	for _, category := range categories {
+		errs := v.Failures[category]
+		sort.Strings(errs)
+		fmt.Fprintf(w, "\n%s (%d):\n", category, len(errs))
+		for _, err := range errs {
+			fmt.Fprintf(w, "  - %s\n", err)
+		}
+	}
+}
+
+// classifyParseError maps an error from ParseRDFFile to a failure category
+func classifyParseError(err error) string {
+	var syntaxErr *xml.SyntaxError
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, ErrEmptyDocument):
+		return failureEmpty
+	case errors.Is(err, ErrNoEbook):
+		return failureNoEbook
+	case errors.As(err, &syntaxErr):
+		return failureMalformed
+	case errors.As(err, &pathErr):
+		return failureUnreadable
+	default:
+		return failureDecode
+	}
+}
+
+// Validate checks a parsed book for data that can't be right: an empty title,
+// a negative download count, an author or contributor who died before they
+// were born, and format URLs that aren't absolute http(s) URLs. It returns one
+// error per problem found, or none if the book is valid. A missing Gutenberg
+// ID is checked separately by the importer.
+func (b *Book) Validate() []error {
+	var errs []error
+	if strings.TrimSpace(b.Title) == "" {
+		errs = append(errs, errors.New("empty title"))
+	}
+	if b.DownloadCount < 0 {
+		errs = append(errs, fmt.Errorf("negative download count %d", b.DownloadCount))
+	}
+
+	checkYears := func(role string, author Author) {
+		if author.BirthYear != nil && author.DeathYear != nil && *author.DeathYear < *author.BirthYear {
+			errs = append(errs, fmt.Errorf("%s %q has death year %d before birth year %d", role, author.Name, *author.DeathYear, *author.BirthYear))
+		}
+	}
+	for _, author := range b.Authors {
+		checkYears("author", author)
+	}
+	for _, contributor := range b.Contributors {
+		checkYears("contributor", contributor.Author)
+	}
+
+	for _, format := range b.Formats {
+		if err := validateFormatURL(format.FileURL); err != nil {
+			errs = append(errs, fmt.Errorf("format %q has malformed URL %q: %w", format.Type, format.FileURL, err))
+		}
+	}
+	return errs
+}
+
+// validateFormatURL requires an absolute http or https URL with a host
+func validateFormatURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("not an http(s) URL")
+	}
+	if u.Host == "" {
+		return errors.New("no host")
+	}
+	return nil
+}
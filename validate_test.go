@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateArchiveReportsEveryFailure(t *testing.T) {
+	dir := t.TempDir()
+	docs := map[string]string{
+		"good1.rdf":     rdfXML(ebookXML("1", "One", "")),
+		"good2.rdf":     fixtureRDF(t, "2"),
+		"malformed.rdf": rdfXML(ebookXML("3", "Three", ""))[:300],
+		"empty.rdf":     " \n",
+		"noebook.rdf":   rdfXML(`<cc:Work rdf:about=""/>`),
+		"noid.rdf":      rdfXML(`<pgterms:ebook><dcterms:title>No ID</dcterms:title></pgterms:ebook>`),
+	}
+	files := writeRDFFiles(t, dir, docs, "good1.rdf", "good2.rdf", "malformed.rdf", "empty.rdf", "noebook.rdf", "noid.rdf")
+	files = append(files, filepath.Join(dir, "missing.rdf"))
+
+	for _, workers := range []int{1, 4} {
+		result := ValidateArchive(files, workers)
+		if result.TotalFiles != 7 || result.Valid != 2 || result.Failed() != 5 {
+			t.Errorf("workers=%d: total %d, valid %d, failed %d; want 7, 2, 5", workers, result.TotalFiles, result.Valid, result.Failed())
+		}
+
+		want := map[string]string{
+			failureMalformed:   "malformed.rdf",
+			failureEmpty:       "empty.rdf",
+			failureNoEbook:     "noebook.rdf",
+			failureNoGutenberg: "noid.rdf",
+			failureUnreadable:  "missing.rdf",
+		}
+		for category, file := range want {
+			errs := result.Failures[category]
+			if len(errs) != 1 || !strings.Contains(errs[0], file) {
+				t.Errorf("workers=%d: Failures[%q] = %v, want one error for %s", workers, category, errs, file)
+			}
+		}
+
+		var out bytes.Buffer
+		result.Print(&out)
+		for _, file := range want {
+			if !strings.Contains(out.String(), file) {
+				t.Errorf("workers=%d: summary doesn't list %s:\n%s", workers, file, out.String())
+			}
+		}
+	}
+}
+
+func TestClassifyParseError(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"empty", "", failureEmpty},
+		{"whitespace", "\n\t ", failureEmpty},
+		{"truncated", rdfXML(ebookXML("1", "T", ""))[:200], failureMalformed},
+		{"no ebook", rdfXML(""), failureNoEbook},
+		{"unsupported encoding", `<?xml version="1.0" encoding="shift_jis"?><rdf:RDF/>`, failureDecode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRDF(strings.NewReader(tt.doc))
+			if err == nil {
+				t.Fatal("ParseRDF succeeded")
+			}
+			if got := classifyParseError(err); got != tt.want {
+				t.Errorf("classifyParseError(%v) = %q, want %q", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBookValidate(t *testing.T) {
+	year := func(y int) *int { return &y }
+	valid := func() Book {
+		return Book{
+			GutenbergID:   "1",
+			Title:         "Title",
+			DownloadCount: 10,
+			Authors:       []Author{{Name: "Author", BirthYear: year(1800), DeathYear: year(1850)}},
+			Formats:       []Format{{Type: "text/html", FileURL: "https://www.gutenberg.org/ebooks/1.html.images"}},
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(*Book)
+		want   []string
+	}{
+		{"valid", func(b *Book) {}, nil},
+		{"empty title", func(b *Book) { b.Title = "" }, []string{"empty title"}},
+		{"whitespace title", func(b *Book) { b.Title = " \n" }, []string{"empty title"}},
+		{"negative download count", func(b *Book) { b.DownloadCount = -3 }, []string{"negative download count -3"}},
+		{"zero download count", func(b *Book) { b.DownloadCount = 0 }, nil},
+		{"author dies before birth", func(b *Book) { b.Authors[0].DeathYear = year(1790) }, []string{`author "Author" has death year 1790 before birth year 1800`}},
+		{"contributor dies before birth", func(b *Book) {
+			b.Contributors = []Contributor{{Author: Author{Name: "Editor", BirthYear: year(1900), DeathYear: year(1899)}, Role: "editor"}}
+		}, []string{`contributor "Editor" has death year 1899`}},
+		{"BCE lifespan", func(b *Book) { b.Authors[0].BirthYear, b.Authors[0].DeathYear = year(-384), year(-322) }, nil},
+		{"birth year only", func(b *Book) { b.Authors[0].DeathYear = nil }, nil},
+		{"relative format URL", func(b *Book) { b.Formats[0].FileURL = "/ebooks/1.html" }, []string{"malformed URL", "not an http(s) URL"}},
+		{"format URL without host", func(b *Book) { b.Formats[0].FileURL = "https:///ebooks/1.html" }, []string{"no host"}},
+		{"unparseable format URL", func(b *Book) { b.Formats[0].FileURL = "http://[::1" }, []string{"malformed URL"}},
+		{"every rule", func(b *Book) {
+			b.Title = ""
+			b.DownloadCount = -1
+			b.Authors[0].DeathYear = year(1700)
+			b.Formats[0].FileURL = "ftp://example.org/1.txt"
+		}, []string{"empty title", "negative download count", "death year", "malformed URL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := valid()
+			tt.modify(&book)
+			errs := book.Validate()
+			var messages []string
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			joined := strings.Join(messages, "; ")
+			if len(tt.want) == 0 {
+				if len(errs) != 0 {
+					t.Errorf("Validate() = %s, want no problems", joined)
+				}
+				return
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(joined, want) {
+					t.Errorf("Validate() = %q, want a problem containing %q", joined, want)
+				}
+			}
+		})
+	}
+}
+
+func TestImportStrictValidation(t *testing.T) {
+	badURL := `<dcterms:hasFormat><pgterms:file rdf:about="ebooks/3.txt"/></dcterms:hasFormat>`
+	docs := map[string]string{
+		"1": rdfXML(ebookXML("1", "Valid", "")),
+		"2": rdfXML(ebookXML("2", "", "")),
+		"3": rdfXML(ebookXML("3", "Relative URL", badURL)),
+	}
+	tests := []struct {
+		name         string
+		strict       bool
+		wantBooks    []string
+		wantFailed   int
+		wantWarnings int
+	}{
+		{"warn and insert", false, []string{"1", "2", "3"}, 0, 2},
+		{"strict", true, []string{"1"}, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			importer := newTestImporter(db)
+			importer.SetStrict(tt.strict)
+			importTestDocs(t, importer, docs)
+
+			if got := bookIDs(t, db); strings.Join(got, ",") != strings.Join(tt.wantBooks, ",") {
+				t.Errorf("books = %v, want %v", got, tt.wantBooks)
+			}
+			stats := importer.Stats()
+			if stats.Invalid != 2 {
+				t.Errorf("Invalid = %d, want 2", stats.Invalid)
+			}
+			if stats.Failed != tt.wantFailed {
+				t.Errorf("Failed = %d, want %d", stats.Failed, tt.wantFailed)
+			}
+			if len(stats.Warnings) != tt.wantWarnings {
+				t.Errorf("%d warnings, want %d: %v", len(stats.Warnings), tt.wantWarnings, stats.Warnings)
+			}
+		})
+	}
+}
@@ -1,69 +1,151 @@
-//go:build ignore
-// +build ignore
-
 package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 
 	_ "modernc.org/sqlite"
 )
 
-// VerifyDB verifies that the database was created and populated correctly
-func VerifyDB(dbPath string) {
-	if dbPath == "" {
-		fmt.Println("Error: database path is required")
-		os.Exit(1)
+// verifyTables are the tables whose row counts VerifyDB reports
+var verifyTables = []string{"books", "publishers", "authors", "subjects", "book_authors", "book_subjects", "bookshelves", "book_bookshelves", "formats"}
+
+// TableCount is the row count of one table, or the error counting it
+type TableCount struct {
+	Table string
+	Count int
+	Err   error
+}
+
+// SampleBook is one book from the sample query, with its authors joined by commas
+type SampleBook struct {
+	GutenbergID string
+	Title       string
+	Authors     string
+}
+
+// VerifyReport holds the outcome of VerifyDB
+type VerifyReport struct {
+	Path string
+	// Tables has one entry per verified table, in a fixed order
+	Tables    []TableCount
+	Samples   []SampleBook
+	SampleErr error
+}
+
+// Count returns the row count of a verified table, or 0 if it couldn't be counted
+func (r *VerifyReport) Count(table string) int {
+	for _, t := range r.Tables {
+		if t.Table == table {
+			return t.Count
+		}
 	}
+	return 0
+}
 
-	fmt.Printf("Verifying database: %s\n\n", dbPath)
+// Failed reports whether any table count or the sample query failed
+func (r *VerifyReport) Failed() bool {
+	for _, t := range r.Tables {
+		if t.Err != nil {
+			return true
+		}
+	}
+	return r.SampleErr != nil
+}
+
+// VerifyDB checks that the database was created and populated correctly,
+// counting the rows of each table and sampling a few books. The independent
+// queries run on up to concurrency read-only connections; the report is the
+// same regardless of concurrency. Per-table problems are recorded in the
+// report; an error is returned only if the database can't be opened at all.
+func VerifyDB(dbPath string, concurrency int) (*VerifyReport, error) {
+	if dbPath == "" {
+		return nil, errors.New("database path is required")
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-	conn, err := sql.Open("sqlite", dbPath)
+	conn, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro")
 	if err != nil {
-		fmt.Printf("Error opening database: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 	defer conn.Close()
+	// Imported databases use WAL, so readers on separate connections don't block each other
+	conn.SetMaxOpenConns(concurrency)
+	conn.SetMaxIdleConns(concurrency)
 
-	// Check if database exists and has tables
-	tables := []string{"books", "authors", "subjects", "book_authors", "book_subjects", "bookshelves", "book_bookshelves", "formats"}
+	report := &VerifyReport{
+		Path:   dbPath,
+		Tables: make([]TableCount, len(verifyTables)),
+	}
 
-	fmt.Println("Checking tables:")
-	for _, table := range tables {
-		var count int
-		err := conn.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count)
-		if err != nil {
-			fmt.Printf("  ❌ %s: ERROR - %v\n", table, err)
-		} else {
-			fmt.Printf("  ✅ %s: %d records\n", table, count)
-		}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	run := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			fn()
+		}()
 	}
 
-	// Get some statistics
-	fmt.Println("\nDatabase Statistics:")
+	for i, table := range verifyTables {
+		i, table := i, table
+		report.Tables[i].Table = table
+		run(func() {
+			report.Tables[i].Err = conn.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&report.Tables[i].Count)
+		})
+	}
+	run(func() {
+		report.Samples, report.SampleErr = sampleBooks(conn)
+	})
+	wg.Wait()
 
-	var totalBooks int
-	conn.QueryRow("SELECT COUNT(*) FROM books").Scan(&totalBooks)
-	fmt.Printf("  Total books: %d\n", totalBooks)
+	return report, nil
+}
+
+// Print writes the table counts, statistics and sample books
+func (r *VerifyReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Verifying database: %s\n\n", r.Path)
 
-	var totalAuthors int
-	conn.QueryRow("SELECT COUNT(*) FROM authors").Scan(&totalAuthors)
-	fmt.Printf("  Total authors: %d\n", totalAuthors)
+	fmt.Fprintln(w, "Checking tables:")
+	for _, t := range r.Tables {
+		if t.Err != nil {
+			fmt.Fprintf(w, "  ❌ %s: ERROR - %v\n", t.Table, t.Err)
+		} else {
+			fmt.Fprintf(w, "  ✅ %s: %d records\n", t.Table, t.Count)
+		}
+	}
 
-	var totalSubjects int
-	conn.QueryRow("SELECT COUNT(*) FROM subjects").Scan(&totalSubjects)
-	fmt.Printf("  Total subjects: %d\n", totalSubjects)
+	fmt.Fprintln(w, "\nDatabase Statistics:")
+	fmt.Fprintf(w, "  Total books: %d\n", r.Count("books"))
+	fmt.Fprintf(w, "  Total authors: %d\n", r.Count("authors"))
+	fmt.Fprintf(w, "  Total subjects: %d\n", r.Count("subjects"))
+	fmt.Fprintf(w, "  Total formats: %d\n", r.Count("formats"))
 
-	var totalFormats int
-	conn.QueryRow("SELECT COUNT(*) FROM formats").Scan(&totalFormats)
-	fmt.Printf("  Total formats: %d\n", totalFormats)
+	fmt.Fprintln(w, "\nSample books (first 5):")
+	if r.SampleErr != nil {
+		fmt.Fprintf(w, "  ❌ ERROR - %v\n", r.SampleErr)
+	}
+	for _, book := range r.Samples {
+		fmt.Fprintf(w, "  ID: %s | Title: %s | Authors: %s\n", book.GutenbergID, book.Title, book.Authors)
+	}
+}
 
-	// Sample some books
-	fmt.Println("\nSample books (first 5):")
+// sampleBooks returns the first five books with their authors
+func sampleBooks(conn *sql.DB) ([]SampleBook, error) {
 	rows, err := conn.Query(`
-		SELECT b.gutenberg_id, b.title, 
+		SELECT b.gutenberg_id, b.title,
 		       GROUP_CONCAT(a.name, ', ') as authors
 		FROM books b
 		LEFT JOIN book_authors ba ON b.id = ba.book_id
@@ -71,23 +153,18 @@ func VerifyDB(dbPath string) {
 		GROUP BY b.id
 		LIMIT 5
 	`)
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var id, title, authors sql.NullString
-			rows.Scan(&id, &title, &authors)
-			fmt.Printf("  ID: %s | Title: %s | Authors: %s\n",
-				id.String, title.String, authors.String)
-		}
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	fmt.Println("\nDatabase verification complete!")
-}
-
-func main() {
-	dbPath := "pg.db"
-	if len(os.Args) > 1 {
-		dbPath = os.Args[1]
+	var books []SampleBook
+	for rows.Next() {
+		var id, title, authors sql.NullString
+		if err := rows.Scan(&id, &title, &authors); err != nil {
+			return nil, err
+		}
+		books = append(books, SampleBook{GutenbergID: id.String, Title: title.String, Authors: authors.String})
 	}
-	VerifyDB(dbPath)
+	return books, rows.Err()
 }
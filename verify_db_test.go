@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDBConcurrency(t *testing.T) {
+	dir := t.TempDir()
+	catalog := filepath.Join(dir, "pg.db")
+	db, err := NewDB(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2", "3", "4", "5", "6", "7"} {
+		doc := rdfXML(ebookXML(id, "Book "+id, `<dcterms:creator><pgterms:agent rdf:about="2009/agents/`+id+`"><pgterms:name>Author `+id+`</pgterms:name></pgterms:agent></dcterms:creator>`+subjectXML("Fiction")))
+		insertTestBooks(t, db, parseTestRDF(t, doc))
+	}
+	db.Close()
+
+	// A database missing most tables reports each failure the same way
+	partial := filepath.Join(dir, "partial.db")
+	conn, err := sql.Open("sqlite", partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec("CREATE TABLE books (id INTEGER PRIMARY KEY, gutenberg_id TEXT, title TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantBooks  int
+		wantFailed bool
+	}{
+		{"populated", catalog, 7, false},
+		{"missing tables", partial, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var serial string
+			for _, concurrency := range []int{1, 2, 4, 16} {
+				report, err := VerifyDB(tt.path, concurrency)
+				if err != nil {
+					t.Fatalf("VerifyDB(concurrency %d): %v", concurrency, err)
+				}
+				if got := report.Count("books"); got != tt.wantBooks {
+					t.Errorf("concurrency %d: %d books, want %d", concurrency, got, tt.wantBooks)
+				}
+				if report.Failed() != tt.wantFailed {
+					t.Errorf("concurrency %d: Failed() = %v, want %v", concurrency, report.Failed(), tt.wantFailed)
+				}
+
+				var out strings.Builder
+				report.Print(&out)
+				if concurrency == 1 {
+					serial = out.String()
+				} else if out.String() != serial {
+					t.Errorf("concurrency %d output differs from serial:\n%s\nserial:\n%s", concurrency, out.String(), serial)
+				}
+			}
+		})
+	}
+
+	if _, err := VerifyDB(filepath.Join(dir, "missing.db"), 2); err == nil {
+		t.Error("VerifyDB of a missing file succeeded, want an error")
+	}
+}
+
+func TestVerifyDB(t *testing.T) {
+	catalog := filepath.Join(t.TempDir(), "pg.db")
+	db, err := NewDB(catalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := func(id, name string) string {
+		return `<dcterms:creator><pgterms:agent rdf:about="2009/agents/` + id + `"><pgterms:name>` + name + `</pgterms:name></pgterms:agent></dcterms:creator>`
+	}
+	format := `<dcterms:hasFormat><pgterms:file rdf:about="https://www.gutenberg.org/ebooks/1.epub.images"/></dcterms:hasFormat>`
+	insertTestBooks(t, db,
+		parseTestRDF(t, rdfXML(ebookXML("1", "Both Authors", agent("10", "Austen, Jane")+agent("11", "Brontë, Charlotte")+subjectXML("Fiction")+format))),
+		parseTestRDF(t, rdfXML(ebookXML("2", "Anonymous", subjectXML("Fiction")+subjectXML("Poetry")))),
+	)
+	db.Close()
+
+	tests := []struct {
+		name        string
+		path        string
+		wantErr     bool
+		wantCounts  map[string]int
+		wantSamples []SampleBook
+	}{
+		{
+			name: "seeded",
+			path: catalog,
+			wantCounts: map[string]int{
+				"books": 2, "authors": 2, "book_authors": 2,
+				"subjects": 2, "book_subjects": 3, "formats": 1,
+				"bookshelves": 0, "book_bookshelves": 0,
+			},
+			wantSamples: []SampleBook{
+				{GutenbergID: "1", Title: "Both Authors", Authors: "Austen, Jane, Brontë, Charlotte"},
+				{GutenbergID: "2", Title: "Anonymous"},
+			},
+		},
+		{name: "missing file", path: filepath.Join(t.TempDir(), "missing.db"), wantErr: true},
+		{name: "no path", path: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := VerifyDB(tt.path, 2)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("VerifyDB succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Failed() {
+				t.Errorf("Failed() = true: %+v, sample error %v", report.Tables, report.SampleErr)
+			}
+			if len(report.Tables) != len(verifyTables) {
+				t.Errorf("%d tables reported, want %d", len(report.Tables), len(verifyTables))
+			}
+			for table, want := range tt.wantCounts {
+				if got := report.Count(table); got != want {
+					t.Errorf("Count(%q) = %d, want %d", table, got, want)
+				}
+			}
+			if !reflect.DeepEqual(report.Samples, tt.wantSamples) {
+				t.Errorf("Samples = %+v, want %+v", report.Samples, tt.wantSamples)
+			}
+		})
+	}
+}